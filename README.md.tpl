@@ -15,7 +15,12 @@ This repository is organised into multiple components:
   RESP (REdis Serialization Protocol), client and server-side. It
   contains basic wrappers for readers and writers to read/write requests and
   responses.
-* [client](./client/) contains a minimalist pooled client.
+* [client](./client/) contains a minimalist pooled client, with pub/sub,
+  cluster and sentinel support.
+* [cmd/redeo-gen-append](./cmd/redeo-gen-append/) generates reflection-free
+  `AppendTo` methods for reply types.
+* [otelredeo](./otelredeo/) instruments servers with OpenTelemetry tracing
+  (separate module).
 
 For full documentation and examples, please see the individual packages and the
 official API documentation: https://godoc.org/github.com/bsm/redeo.
@@ -0,0 +1,367 @@
+package redeo
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/bsm/redeo/v2/resp"
+)
+
+// AOFFsync is the fsync policy of an append-only file.
+type AOFFsync int
+
+// Supported fsync policies.
+const (
+	// AOFFsyncEverySec syncs the file once per second, in the background.
+	AOFFsyncEverySec AOFFsync = iota
+	// AOFFsyncAlways syncs the file after every write command.
+	AOFFsyncAlways
+	// AOFFsyncNo never syncs the file explicitly, leaving it to the OS.
+	AOFFsyncNo
+)
+
+var (
+	errAOFDisabled            = errors.New("ERR AOF is disabled")
+	errAOFRewriteInProgress   = errors.New("ERR Background append only file rewriting already in progress")
+	errAOFRewriteNotSupported = errors.New("ERR AOF rewrites are not supported")
+)
+
+// AOFOptions configure append-only files.
+type AOFOptions struct {
+	// Fsync sets the fsync policy.
+	// Default: AOFFsyncEverySec
+	Fsync AOFFsync
+
+	// Rewrite is called by BGREWRITEAOF and must write commands, which
+	// recreate the current dataset. Write commands are blocked while it runs.
+	// Default: nil (rewrites are not supported)
+	Rewrite func(w *resp.RequestWriter) error
+}
+
+// AOF is an append-only file, which persists write commands. Please see
+// Server.SetAOF and Server.ReplayAOF.
+type AOF struct {
+	path string
+	opts AOFOptions
+
+	file    *os.File
+	wr      *resp.RequestWriter
+	args    [][]byte
+	dirty   bool
+	err     error         // sticky write error
+	rewrite *bytes.Buffer // writes recorded during a rewrite
+	mu      sync.Mutex
+
+	closing chan struct{}
+	closed  sync.WaitGroup
+}
+
+// OpenAOF opens an append-only file for writing, creating it if necessary.
+func OpenAOF(path string, opts *AOFOptions) (*AOF, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &AOF{
+		path:    path,
+		file:    file,
+		closing: make(chan struct{}),
+	}
+	if opts != nil {
+		a.opts = *opts
+	}
+	a.wr = resp.NewRequestWriter((*aofWriter)(a))
+
+	if a.opts.Fsync == AOFFsyncEverySec {
+		a.closed.Add(1)
+		go a.syncLoop()
+	}
+	return a, nil
+}
+
+// Path returns the file path.
+func (a *AOF) Path() string { return a.path }
+
+// Err returns the last write error, if any. Once writes have failed, the
+// server rejects all further write commands.
+func (a *AOF) Err() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.err
+}
+
+// Sync flushes pending data and syncs the file to disk.
+func (a *AOF) Sync() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.sync()
+}
+
+// Close syncs and closes the file.
+func (a *AOF) Close() error {
+	close(a.closing)
+	a.closed.Wait()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	err := a.sync()
+	if e := a.file.Close(); e != nil && err == nil {
+		err = e
+	}
+	return err
+}
+
+// Append appends a command to the file.
+func (a *AOF) Append(cmd *resp.Command) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.err != nil {
+		return a.err
+	}
+
+	a.args = a.args[:0]
+	for _, arg := range cmd.Args {
+		a.args = append(a.args, arg)
+	}
+	a.wr.WriteCmd(cmd.Name, a.args...)
+
+	if err := a.wr.Flush(); err != nil {
+		a.err = err
+		return err
+	}
+	a.dirty = true
+
+	if a.opts.Fsync == AOFFsyncAlways {
+		if err := a.file.Sync(); err != nil {
+			a.err = err
+			return err
+		}
+		a.dirty = false
+	}
+	return nil
+}
+
+// sync must be called while holding the lock.
+func (a *AOF) sync() error {
+	if err := a.wr.Flush(); err != nil {
+		return err
+	}
+	if !a.dirty || a.opts.Fsync == AOFFsyncNo {
+		return nil
+	}
+	if err := a.file.Sync(); err != nil {
+		return err
+	}
+	a.dirty = false
+	return nil
+}
+
+func (a *AOF) syncLoop() {
+	defer a.closed.Done()
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-a.closing:
+			return
+		}
+
+		a.mu.Lock()
+		if err := a.sync(); err != nil && a.err == nil {
+			a.err = err
+		}
+		a.mu.Unlock()
+	}
+}
+
+// rewriteFile rewrites the file in the background. Write commands are blocked
+// via the gate while the dataset is written, subsequent writes are buffered
+// and appended before the rewritten file replaces the original.
+func (a *AOF) rewriteFile(gate *sync.Mutex) error {
+	if a.opts.Rewrite == nil {
+		return errAOFRewriteNotSupported
+	}
+
+	a.mu.Lock()
+	if a.rewrite != nil {
+		a.mu.Unlock()
+		return errAOFRewriteInProgress
+	}
+	a.rewrite = new(bytes.Buffer)
+	a.mu.Unlock()
+
+	go func() {
+		_ = a.doRewrite(gate)
+	}()
+	return nil
+}
+
+func (a *AOF) doRewrite(gate *sync.Mutex) (err error) {
+	tmp, err := os.OpenFile(a.path+".rewrite", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		a.abortRewrite()
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tmp.Close()
+			_ = os.Remove(tmp.Name())
+			a.abortRewrite()
+		}
+	}()
+
+	gate.Lock()
+	a.mu.Lock()
+	a.rewrite.Reset()
+	a.mu.Unlock()
+
+	wr := resp.NewRequestWriter(tmp)
+	if err = a.opts.Rewrite(wr); err == nil {
+		err = wr.Flush()
+	}
+	gate.Unlock()
+
+	if err != nil {
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	select {
+	case <-a.closing:
+		return os.ErrClosed
+	default:
+	}
+	if err = a.wr.Flush(); err != nil {
+		return err
+	}
+	if _, err = tmp.Write(a.rewrite.Bytes()); err != nil {
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp.Name(), a.path); err != nil {
+		return err
+	}
+
+	_ = a.file.Close()
+	a.file, a.dirty, a.rewrite = tmp, false, nil
+	return nil
+}
+
+func (a *AOF) abortRewrite() {
+	a.mu.Lock()
+	a.rewrite = nil
+	a.mu.Unlock()
+}
+
+// aofWriter writes to the file and, during rewrites, to the rewrite buffer.
+type aofWriter AOF
+
+func (w *aofWriter) Write(p []byte) (int, error) {
+	if w.rewrite != nil {
+		w.rewrite.Write(p)
+	}
+	return w.file.Write(p)
+}
+
+// --------------------------------------------------------------------
+
+// SetAOF enables persistence of write commands into an append-only file.
+// Commands flagged as "write" in their descriptions are appended once they
+// have been executed successfully, in the order in which they were performed.
+// Once writes to the file fail, further write commands are rejected. Pass nil
+// to disable persistence.
+func (srv *Server) SetAOF(a *AOF) {
+	srv.mu.Lock()
+	srv.aof = a
+	srv.mu.Unlock()
+}
+
+// ReplayAOF replays an append-only file through the registered handlers and
+// returns the number of applied commands. It is meant to be called at startup,
+// before SetAOF. Files with a truncated tail, i.e. after a crash, are
+// truncated to the last complete command. Missing files are ignored.
+func (srv *Server) ReplayAOF(path string) (int, error) {
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if os.IsNotExist(err) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	rd := resp.NewRequestReader(file)
+	w := resp.NewResponseWriterSize(io.Discard, 4096)
+
+	var n int
+	var offset int64
+	var cmd *resp.Command
+	for offset < stat.Size() {
+		if cmd, err = rd.ReadCmd(cmd); err != nil {
+			break
+		}
+
+		srv.applyCmd(w, cmd)
+		offset += replCmdLen(cmd.Name, cmd.Args)
+		n++
+	}
+
+	switch {
+	case err == nil:
+		return n, nil
+	case errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF):
+		return n, file.Truncate(offset)
+	}
+	return n, err
+}
+
+// BGRewriteAOF returns a BGREWRITEAOF handler, which compacts the append-only
+// file in the background, using AOFOptions.Rewrite.
+// https://redis.io/commands/bgrewriteaof
+func (srv *Server) BGRewriteAOF() Handler {
+	return HandlerFunc(func(w resp.ResponseWriter, c *resp.Command) {
+		if c.ArgN() != 0 {
+			w.AppendError(WrongNumberOfArgs(c.Name))
+			return
+		}
+
+		if err := srv.rewriteAOF(); err != nil {
+			w.AppendError(err.Error())
+			return
+		}
+		w.AppendInlineString("Background append only file rewriting started")
+	})
+}
+
+func (srv *Server) rewriteAOF() error {
+	srv.mu.RLock()
+	a := srv.aof
+	srv.mu.RUnlock()
+
+	if a == nil {
+		return errAOFDisabled
+	}
+	return a.rewriteFile(&srv.writes)
+}
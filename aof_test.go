@@ -0,0 +1,213 @@
+package redeo
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	. "github.com/bsm/ginkgo/v2"
+	. "github.com/bsm/gomega"
+	"github.com/bsm/redeo/v2/resp"
+)
+
+var _ = Describe("AOF", func() {
+	var subject *Server
+	var store *testStore
+	var path, addr string
+
+	call := func(cmd string, args ...string) string {
+		cn, err := net.Dial("tcp", addr)
+		Expect(err).NotTo(HaveOccurred())
+		defer cn.Close()
+
+		w := resp.NewRequestWriter(cn)
+		w.WriteCmdString(cmd, args...)
+		Expect(w.Flush()).To(Succeed())
+
+		line, err := bufio.NewReader(cn).ReadString('\n')
+		Expect(err).NotTo(HaveOccurred())
+		return strings.TrimSpace(line)
+	}
+
+	open := func(opts *AOFOptions) *AOF {
+		a, err := OpenAOF(path, opts)
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(a.Close)
+		subject.SetAOF(a)
+		return a
+	}
+
+	readFile := func() string {
+		data, err := os.ReadFile(path)
+		Expect(err).NotTo(HaveOccurred())
+		return string(data)
+	}
+
+	replay := func() (*testStore, int) {
+		srv := NewServer(nil)
+		s := newTestStore()
+		s.register(srv)
+
+		n, err := srv.ReplayAOF(path)
+		Expect(err).NotTo(HaveOccurred())
+		return s, n
+	}
+
+	BeforeEach(func() {
+		dir, err := os.MkdirTemp("", "redeo-aof-")
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(os.RemoveAll, dir)
+		path = filepath.Join(dir, "appendonly.aof")
+
+		store = newTestStore()
+		subject = NewServer(nil)
+		store.register(subject)
+		subject.Handle("bgrewriteaof", subject.BGRewriteAOF())
+
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+		go func(srv *Server, lis net.Listener) { _ = srv.Serve(lis) }(subject, lis)
+		DeferCleanup(subject.Shutdown)
+		addr = lis.Addr().String()
+	})
+
+	It("should record successful writes", func() {
+		a := open(&AOFOptions{Fsync: AOFFsyncAlways})
+
+		Expect(call("SET", "a", "1")).To(Equal("+OK"))
+		Expect(call("SET", "b", "")).To(Equal("-ERR empty value"))
+		Expect(call("GET", "a")).To(Equal("$1"))
+		Expect(call("INCR", "n")).To(Equal(":1"))
+		Expect(a.Sync()).To(Succeed())
+
+		Expect(readFile()).To(Equal("*3\r\n$3\r\nSET\r\n$1\r\na\r\n$1\r\n1\r\n*2\r\n$4\r\nINCR\r\n$1\r\nn\r\n"))
+	})
+
+	It("should record writes with nested errors", func() {
+		a := open(nil)
+		subject.HandleFunc("mset", func(w resp.ResponseWriter, c *resp.Command) {
+			w.AppendArrayLen(2)
+			store.setHandler()(w, resp.NewCommand("set", c.Arg(0), c.Arg(1)))
+			w.AppendError("ERR skipped")
+		}, CommandDescription{Arity: 5, Flags: []string{"write"}, FirstKey: 1, LastKey: -1, KeyStepCount: 2})
+
+		Expect(call("MSET", "a", "1", "b", "2")).To(Equal("*2"))
+		Expect(call("MSET", "a", "1")).To(HavePrefix("-ERR wrong number"))
+		Expect(a.Sync()).To(Succeed())
+		Expect(readFile()).To(Equal("*5\r\n$4\r\nMSET\r\n$1\r\na\r\n$1\r\n1\r\n$1\r\nb\r\n$1\r\n2\r\n"))
+	})
+
+	It("should support all fsync policies", func() {
+		for _, fsync := range []AOFFsync{AOFFsyncEverySec, AOFFsyncAlways, AOFFsyncNo} {
+			Expect(os.Remove(path)).To(Or(Succeed(), MatchError(os.ErrNotExist)))
+
+			a, err := OpenAOF(path, &AOFOptions{Fsync: fsync})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(a.Append(resp.NewCommand("SET", resp.CommandArgument("k"), resp.CommandArgument("v")))).To(Succeed())
+			Expect(a.Close()).To(Succeed())
+			Expect(readFile()).To(Equal("*3\r\n$3\r\nSET\r\n$1\r\nk\r\n$1\r\nv\r\n"), "policy %d", fsync)
+		}
+	})
+
+	It("should replay", func() {
+		a := open(nil)
+		Expect(call("SET", "a", "1")).To(Equal("+OK"))
+		Expect(call("INCR", "n")).To(Equal(":1"))
+		Expect(call("INCR", "n")).To(Equal(":2"))
+		Expect(a.Sync()).To(Succeed())
+
+		s, n := replay()
+		Expect(n).To(Equal(3))
+		Expect(s.Dump()).To(Equal("a=1\nn=2\n"))
+	})
+
+	It("should record concurrent writes in order", func() {
+		a := open(nil)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer GinkgoRecover()
+				defer wg.Done()
+
+				for j := 0; j < 20; j++ {
+					Expect(call("SLOWSET", "k", fmt.Sprintf("%d-%d", i, j))).To(Equal("+OK"))
+				}
+			}(i)
+		}
+		wg.Wait()
+		Expect(a.Sync()).To(Succeed())
+
+		s, n := replay()
+		Expect(n).To(Equal(160))
+		Expect(s.Writes("k")).To(Equal(store.Writes("k")))
+		Expect(s.Get("k")).To(Equal(store.Get("k")))
+	})
+
+	It("should ignore missing files", func() {
+		s, n := replay()
+		Expect(n).To(Equal(0))
+		Expect(s.Dump()).To(BeEmpty())
+	})
+
+	It("should truncate incomplete tails", func() {
+		valid := "*3\r\n$3\r\nSET\r\n$1\r\na\r\n$1\r\n1\r\n"
+		Expect(os.WriteFile(path, []byte(valid+"*3\r\n$3\r\nSET\r\n$1\r\nb\r\n$3\r\n12"), 0o644)).To(Succeed())
+
+		s, n := replay()
+		Expect(n).To(Equal(1))
+		Expect(s.Dump()).To(Equal("a=1\n"))
+		Expect(readFile()).To(Equal(valid))
+	})
+
+	It("should reject writes once the file is broken", func() {
+		a, err := OpenAOF(path, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(a.file.Close()).To(Succeed())
+		DeferCleanup(func() { _ = a.Close() })
+		subject.SetAOF(a)
+
+		Expect(call("SET", "a", "1")).To(Equal("+OK"))
+		Expect(call("SET", "a", "2")).To(HavePrefix("-MISCONF Errors writing to the AOF file:"))
+		Expect(call("GET", "a")).To(Equal("$1"))
+		Expect(store.Get("a")).To(Equal("1"))
+	})
+
+	It("should rewrite in the background", func() {
+		open(&AOFOptions{
+			Rewrite: func(w *resp.RequestWriter) error {
+				for _, line := range strings.Split(strings.TrimSpace(store.Dump()), "\n") {
+					kv := strings.SplitN(line, "=", 2)
+					w.WriteCmdString("SET", kv[0], kv[1])
+				}
+				return nil
+			},
+		})
+
+		for i := 0; i < 5; i++ {
+			Expect(call("INCR", "n")).To(HavePrefix(":"))
+		}
+		Expect(call("SET", "a", "1")).To(Equal("+OK"))
+		Expect(strings.Count(readFile(), "INCR")).To(Equal(5))
+
+		Expect(call("BGREWRITEAOF")).To(Equal("+Background append only file rewriting started"))
+		Eventually(readFile).Should(Equal("*3\r\n$3\r\nSET\r\n$1\r\na\r\n$1\r\n1\r\n*3\r\n$3\r\nSET\r\n$1\r\nn\r\n$1\r\n5\r\n"))
+		Expect(filepath.Join(filepath.Dir(path), "appendonly.aof.rewrite")).NotTo(BeAnExistingFile())
+
+		Expect(call("INCR", "n")).To(Equal(":6"))
+		s, n := replay()
+		Expect(n).To(Equal(3))
+		Expect(s.Dump()).To(Equal("a=1\nn=6\n"))
+	})
+
+	It("should reject rewrites when unsupported", func() {
+		Expect(call("BGREWRITEAOF")).To(Equal("-ERR AOF is disabled"))
+		open(nil)
+		Expect(call("BGREWRITEAOF")).To(Equal("-ERR AOF rewrites are not supported"))
+	})
+})
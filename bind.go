@@ -0,0 +1,339 @@
+package redeo
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/bsm/redeo/v2/resp"
+)
+
+// Standard argument errors, consistent with redis.
+var (
+	ErrSyntax         = errors.New("ERR syntax error")
+	ErrNotAnInteger   = errors.New("ERR value is not an integer or out of range")
+	ErrNotAValidFloat = errors.New("ERR value is not a valid float")
+)
+
+// Bind parses command arguments into dst, which must be a pointer to a struct.
+// Struct fields are bound according to their `arg` tags:
+//
+//	Key   string   `arg:""`                 // required positional argument
+//	Count int      `arg:",optional"`        // optional positional argument
+//	Rest  []string `arg:",variadic"`        // remaining positional arguments
+//	NX    bool     `arg:"NX,flag,group=ex"` // keyword flag
+//	EX    *int64   `arg:"EX,option"`        // keyword followed by a value
+//	Skip  string   `arg:"-"`                // ignored
+//
+// Untagged fields are treated as required positional arguments. Required
+// arguments are bound in field order, flags and options may follow in any
+// order and are matched case-insensitively. Fields sharing a group are
+// mutually exclusive.
+//
+// Supported field types are string, []byte, resp.CommandArgument, bool,
+// int*, uint*, float* and pointers to these; variadic fields must be slices.
+// Byte slices reference the command's argument buffers and must not be
+// retained after the handler returns.
+//
+// Bind returns ErrWrongNumberOfArgs if required arguments are missing,
+// ErrSyntax for unexpected or conflicting arguments and ErrNotAnInteger or
+// ErrNotAValidFloat for invalid numeric values.
+func Bind(c *resp.Command, dst interface{}) error {
+	rv := reflect.ValueOf(dst)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("redeo: bind destination must be a non-nil struct pointer, not %T", dst)
+	}
+
+	spec, err := cachedBindSpec(rv.Type().Elem())
+	if err != nil {
+		return err
+	}
+	return spec.bind(c, rv.Elem())
+}
+
+// --------------------------------------------------------------------
+
+type bindKind uint8
+
+const (
+	bindRequired bindKind = iota
+	bindOptional
+	bindVariadic
+	bindFlag
+	bindOption
+)
+
+type bindField struct {
+	index   int
+	kind    bindKind
+	keyword string
+	group   string
+}
+
+type bindSpec struct {
+	positional []bindField // required, then optional, then variadic
+	keywords   map[string]*bindField
+	required   int
+}
+
+var bindSpecs sync.Map
+
+func cachedBindSpec(t reflect.Type) (*bindSpec, error) {
+	if v, ok := bindSpecs.Load(t); ok {
+		return v.(*bindSpec), nil
+	}
+
+	spec, err := newBindSpec(t)
+	if err != nil {
+		return nil, err
+	}
+
+	v, _ := bindSpecs.LoadOrStore(t, spec)
+	return v.(*bindSpec), nil
+}
+
+func newBindSpec(t reflect.Type) (*bindSpec, error) {
+	spec := &bindSpec{keywords: make(map[string]*bindField)}
+
+	var optional, variadic []bindField
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag, hasTag := sf.Tag.Lookup("arg")
+		if tag == "-" || sf.PkgPath != "" && !hasTag {
+			continue
+		} else if sf.PkgPath != "" {
+			return nil, fmt.Errorf("redeo: cannot bind unexported field %s.%s", t, sf.Name)
+		}
+
+		parts := strings.Split(tag, ",")
+		field := bindField{index: i, keyword: strings.ToUpper(parts[0])}
+		for _, opt := range parts[1:] {
+			switch {
+			case opt == "optional":
+				field.kind = bindOptional
+			case opt == "variadic":
+				field.kind = bindVariadic
+			case opt == "flag":
+				field.kind = bindFlag
+			case opt == "option":
+				field.kind = bindOption
+			case strings.HasPrefix(opt, "group="):
+				field.group = opt[6:]
+			default:
+				return nil, fmt.Errorf("redeo: invalid arg tag option %q on %s.%s", opt, t, sf.Name)
+			}
+		}
+
+		ft := sf.Type
+		switch field.kind {
+		case bindFlag:
+			if ft.Kind() != reflect.Bool {
+				return nil, fmt.Errorf("redeo: flag field %s.%s must be a bool", t, sf.Name)
+			}
+		case bindVariadic:
+			if ft.Kind() != reflect.Slice || isBytesType(ft) || !isBindable(ft.Elem()) {
+				return nil, fmt.Errorf("redeo: variadic field %s.%s must be a slice of a supported type", t, sf.Name)
+			}
+		default:
+			if !isBindable(ft) {
+				return nil, fmt.Errorf("redeo: cannot bind field %s.%s of type %s", t, sf.Name, ft)
+			}
+		}
+
+		switch field.kind {
+		case bindRequired:
+			if len(optional) != 0 || len(variadic) != 0 {
+				return nil, fmt.Errorf("redeo: required field %s.%s must precede optional fields", t, sf.Name)
+			}
+			spec.positional = append(spec.positional, field)
+			spec.required++
+		case bindOptional:
+			if len(variadic) != 0 {
+				return nil, fmt.Errorf("redeo: optional field %s.%s must precede variadic fields", t, sf.Name)
+			}
+			optional = append(optional, field)
+		case bindVariadic:
+			if len(variadic) != 0 {
+				return nil, fmt.Errorf("redeo: multiple variadic fields in %s", t)
+			}
+			variadic = append(variadic, field)
+		case bindFlag, bindOption:
+			if field.keyword == "" {
+				return nil, fmt.Errorf("redeo: missing keyword for field %s.%s", t, sf.Name)
+			}
+			if _, ok := spec.keywords[field.keyword]; ok {
+				return nil, fmt.Errorf("redeo: duplicate keyword %q in %s", field.keyword, t)
+			}
+			f := field
+			spec.keywords[field.keyword] = &f
+		}
+	}
+
+	spec.positional = append(spec.positional, optional...)
+	spec.positional = append(spec.positional, variadic...)
+	return spec, nil
+}
+
+func (s *bindSpec) bind(c *resp.Command, rv reflect.Value) error {
+	args := c.Args
+	if len(args) < s.required {
+		return ErrWrongNumberOfArgs(c.Name)
+	}
+
+	// reset bound fields, ignored fields are retained
+	for _, f := range s.positional {
+		fv := rv.Field(f.index)
+		fv.Set(reflect.Zero(fv.Type()))
+	}
+	for _, f := range s.keywords {
+		fv := rv.Field(f.index)
+		fv.Set(reflect.Zero(fv.Type()))
+	}
+
+	// bind required arguments
+	for i := 0; i < s.required; i++ {
+		if err := bindValue(rv.Field(s.positional[i].index), args[i]); err != nil {
+			return err
+		}
+	}
+	args = args[s.required:]
+
+	var groups map[string]struct{}
+	pos := s.required
+	for len(args) != 0 {
+		// try keywords first
+		if kw, ok := s.keywords[strings.ToUpper(args[0].String())]; ok {
+			if kw.group != "" {
+				if _, ok := groups[kw.group]; ok {
+					return ErrSyntax
+				}
+				if groups == nil {
+					groups = make(map[string]struct{}, 1)
+				}
+				groups[kw.group] = struct{}{}
+			}
+
+			fv := rv.Field(kw.index)
+			if kw.kind == bindFlag {
+				fv.SetBool(true)
+				args = args[1:]
+				continue
+			}
+
+			if len(args) < 2 {
+				return ErrSyntax
+			}
+			if err := bindValue(fv, args[1]); err != nil {
+				return err
+			}
+			args = args[2:]
+			continue
+		}
+
+		// then, remaining positional fields
+		if pos >= len(s.positional) {
+			return ErrSyntax
+		}
+
+		field := s.positional[pos]
+		fv := rv.Field(field.index)
+		if field.kind != bindVariadic {
+			if err := bindValue(fv, args[0]); err != nil {
+				return err
+			}
+			args = args[1:]
+			pos++
+			continue
+		}
+
+		// variadic fields consume all remaining arguments
+		sv := reflect.MakeSlice(fv.Type(), len(args), len(args))
+		for i, arg := range args {
+			if err := bindValue(sv.Index(i), arg); err != nil {
+				return err
+			}
+		}
+		fv.Set(sv)
+		args = nil
+	}
+	return nil
+}
+
+// --------------------------------------------------------------------
+
+var (
+	bytesType  = reflect.TypeOf([]byte(nil))
+	cmdArgType = reflect.TypeOf(resp.CommandArgument(nil))
+)
+
+func isBytesType(t reflect.Type) bool {
+	return t == bytesType || t == cmdArgType
+}
+
+func isBindable(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if isBytesType(t) {
+		return true
+	}
+
+	switch t.Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+func bindValue(v reflect.Value, arg resp.CommandArgument) error {
+	if v.Kind() == reflect.Ptr {
+		pv := reflect.New(v.Type().Elem())
+		if err := bindValue(pv.Elem(), arg); err != nil {
+			return err
+		}
+		v.Set(pv)
+		return nil
+	}
+
+	if isBytesType(v.Type()) {
+		v.SetBytes(arg)
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(string(arg))
+	case reflect.Bool:
+		b, err := strconv.ParseBool(string(arg))
+		if err != nil {
+			return ErrSyntax
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(string(arg), 10, v.Type().Bits())
+		if err != nil {
+			return ErrNotAnInteger
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(string(arg), 10, v.Type().Bits())
+		if err != nil {
+			return ErrNotAnInteger
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(string(arg), v.Type().Bits())
+		if err != nil || math.IsNaN(f) {
+			return ErrNotAValidFloat
+		}
+		v.SetFloat(f)
+	}
+	return nil
+}
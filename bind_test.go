@@ -0,0 +1,106 @@
+package redeo
+
+import (
+	. "github.com/bsm/ginkgo/v2"
+	. "github.com/bsm/gomega"
+	"github.com/bsm/redeo/v2/resp"
+)
+
+var _ = Describe("Bind", func() {
+	type setArgs struct {
+		Key     string
+		Value   []byte
+		NX      bool   `arg:"NX,flag,group=cond"`
+		XX      bool   `arg:"XX,flag,group=cond"`
+		EX      *int64 `arg:"EX,option,group=expire"`
+		PX      *int64 `arg:"PX,option,group=expire"`
+		KeepTTL bool   `arg:"KEEPTTL,flag,group=expire"`
+		ignored string
+	}
+
+	type rangeArgs struct {
+		Key    resp.CommandArgument `arg:""`
+		Min    float64
+		Max    float64
+		Limit  uint8    `arg:",optional"`
+		Fields []string `arg:",variadic"`
+		Skip   string   `arg:"-"`
+	}
+
+	cmd := func(name string, args ...string) *resp.Command {
+		c := resp.NewCommand(name)
+		for _, arg := range args {
+			c.Args = append(c.Args, resp.CommandArgument(arg))
+		}
+		return c
+	}
+
+	It("should bind positional arguments, flags and options", func() {
+		var dst setArgs
+		Expect(Bind(cmd("SET", "key", "val"), &dst)).To(Succeed())
+		Expect(dst).To(Equal(setArgs{Key: "key", Value: []byte("val")}))
+
+		Expect(Bind(cmd("SET", "key", "val", "nx", "Ex", "10"), &dst)).To(Succeed())
+		Expect(dst.Key).To(Equal("key"))
+		Expect(dst.NX).To(BeTrue())
+		Expect(dst.XX).To(BeFalse())
+		Expect(*dst.EX).To(Equal(int64(10)))
+		Expect(dst.PX).To(BeNil())
+
+		Expect(Bind(cmd("SET", "key", "val", "KEEPTTL", "XX"), &dst)).To(Succeed())
+		Expect(dst.XX).To(BeTrue())
+		Expect(dst.NX).To(BeFalse())
+		Expect(dst.KeepTTL).To(BeTrue())
+		Expect(dst.EX).To(BeNil())
+	})
+
+	It("should retain ignored fields", func() {
+		dst := rangeArgs{Limit: 5, Fields: []string{"x"}, Skip: "keep"}
+		Expect(Bind(cmd("ZRANGE", "key", "1", "2"), &dst)).To(Succeed())
+		Expect(dst).To(Equal(rangeArgs{Key: resp.CommandArgument("key"), Min: 1, Max: 2, Skip: "keep"}))
+
+		set := setArgs{NX: true, ignored: "keep"}
+		Expect(Bind(cmd("SET", "key", "val"), &set)).To(Succeed())
+		Expect(set).To(Equal(setArgs{Key: "key", Value: []byte("val"), ignored: "keep"}))
+	})
+
+	It("should bind optional and variadic arguments", func() {
+		var dst rangeArgs
+		Expect(Bind(cmd("RANGE", "key", "1", "2.5"), &dst)).To(Succeed())
+		Expect(dst).To(Equal(rangeArgs{Key: resp.CommandArgument("key"), Min: 1, Max: 2.5}))
+
+		Expect(Bind(cmd("RANGE", "key", "1", "2.5", "8", "a", "b"), &dst)).To(Succeed())
+		Expect(dst.Limit).To(Equal(uint8(8)))
+		Expect(dst.Fields).To(Equal([]string{"a", "b"}))
+	})
+
+	It("should return redis-compatible errors", func() {
+		var dst setArgs
+		Expect(Bind(cmd("SET", "key"), &dst)).To(MatchError("ERR wrong number of arguments for 'SET' command"))
+		Expect(Bind(cmd("SET", "key", "val", "NX", "XX"), &dst)).To(MatchError(ErrSyntax))
+		Expect(Bind(cmd("SET", "key", "val", "EX", "1", "PX", "1"), &dst)).To(MatchError(ErrSyntax))
+		Expect(Bind(cmd("SET", "key", "val", "EX"), &dst)).To(MatchError(ErrSyntax))
+		Expect(Bind(cmd("SET", "key", "val", "EX", "x"), &dst)).To(MatchError(ErrNotAnInteger))
+		Expect(Bind(cmd("SET", "key", "val", "BAD"), &dst)).To(MatchError(ErrSyntax))
+
+		var rng rangeArgs
+		Expect(Bind(cmd("RANGE", "key", "x", "1"), &rng)).To(MatchError(ErrNotAValidFloat))
+		Expect(Bind(cmd("RANGE", "key", "1", "1", "256"), &rng)).To(MatchError(ErrNotAnInteger))
+	})
+
+	It("should reject invalid destinations", func() {
+		Expect(Bind(cmd("SET"), nil)).To(MatchError(`redeo: bind destination must be a non-nil struct pointer, not <nil>`))
+		Expect(Bind(cmd("SET"), setArgs{})).To(MatchError(ContainSubstring(`must be a non-nil struct pointer`)))
+		Expect(Bind(cmd("SET"), &struct {
+			A []string
+		}{})).To(MatchError(`redeo: cannot bind field struct { A []string }.A of type []string`))
+		Expect(Bind(cmd("SET"), &struct {
+			A string `arg:",optional"`
+			B string
+		}{})).To(MatchError(ContainSubstring(`required field struct { A string "arg:\",optional\""; B string }.B must precede optional fields`)))
+		Expect(Bind(cmd("SET"), &struct {
+			A string `arg:",flag"`
+		}{})).To(MatchError(ContainSubstring(`must be a bool`)))
+	})
+
+})
@@ -9,11 +9,7 @@ import (
 	"github.com/bsm/redeo/v2/resp"
 )
 
-var (
-	clientInc  = uint64(0)
-	readerPool sync.Pool
-	writerPool sync.Pool
-)
+var clientInc = uint64(0)
 
 type ctxKeyClient struct{}
 
@@ -25,17 +21,33 @@ type Client struct {
 	rd *resp.RequestReader
 	wr resp.ResponseWriter
 
-	ctx    context.Context
-	closed bool
+	ctx           context.Context
+	user          string
+	proto         int32
+	invalidations int32 // subscriptions to __redis__:invalidate
+	closed        bool
+	released      int32
+
+	pushes  []byte // queued push messages
+	serving bool   // a reply is in progress
+	hooks   []func()
+	pmu     sync.Mutex
 
 	cmd  *resp.Command
 	scmd *resp.CommandStream
+	rec  errorRecorder
+	wrec errorRecorder
 }
 
-func newClient(cn net.Conn) *Client {
-	c := new(Client)
-	c.reset(cn)
-	return c
+// newClient creates a client. Read and write buffers are acquired from
+// the given pools only while there is pending data.
+func newClient(cn net.Conn, rbufs, wbufs *resp.BufferPool) *Client {
+	return &Client{
+		id: atomic.AddUint64(&clientInc, 1),
+		cn: cn,
+		rd: resp.NewPooledRequestReader(cn, rbufs),
+		wr: resp.NewPooledResponseWriter(cn, wbufs),
+	}
 }
 
 // GetClient retrieves the client from a the context.
@@ -65,33 +77,69 @@ func (c *Client) SetContext(ctx context.Context) {
 	c.ctx = ctx
 }
 
+// User returns the name of the authenticated user, if any
+func (c *Client) User() string { return c.user }
+
+// SetUser sets the name of the authenticated user, typically from
+// within an AUTH handler. Users are subject to per-user rate limits.
+func (c *Client) SetUser(name string) {
+	c.user = name
+}
+
 // RemoteAddr return the remote client address
 func (c *Client) RemoteAddr() net.Addr {
 	return c.cn.RemoteAddr()
 }
 
+// LocalAddr return the local address of the listener which
+// accepted the client connection
+func (c *Client) LocalAddr() net.Addr {
+	return c.cn.LocalAddr()
+}
+
 // Close will disconnect as soon as all pending replies have been written
 // to the client
 func (c *Client) Close() {
 	c.closed = true
 }
 
-func (c *Client) readCmd(cmd *resp.Command) (*resp.Command, error) {
+// isReleased returns true once the client has disconnected
+// and its buffers have been released.
+func (c *Client) isReleased() bool {
+	return c != nil && atomic.LoadInt32(&c.released) == 1
+}
+
+func (c *Client) readCmd(ctx context.Context, cmd *resp.Command) (*resp.Command, error) {
 	var err error
 	if cmd, err = c.rd.ReadCmd(cmd); err == nil {
-		cmd.SetContext(context.WithValue(cmd.Context(), ctxKeyClient{}, c))
+		cmd.SetContext(context.WithValue(ctx, ctxKeyClient{}, c))
 	}
 	return cmd, err
 }
 
-func (c *Client) streamCmd(cmd *resp.CommandStream) (*resp.CommandStream, error) {
+func (c *Client) streamCmd(ctx context.Context, cmd *resp.CommandStream) (*resp.CommandStream, error) {
 	var err error
 	if cmd, err = c.rd.StreamCmd(cmd); err == nil {
-		cmd.SetContext(context.WithValue(cmd.Context(), ctxKeyClient{}, c))
+		cmd.SetContext(context.WithValue(ctx, ctxKeyClient{}, c))
 	}
 	return cmd, err
 }
 
+// observe notifies the observer (if any) about a command that is about to be
+// served. It returns the writer to be passed to the handler and a callback,
+// which must be invoked once the handler has completed.
+func (c *Client) observe(ctx context.Context, o Observer, name string, argc int, setContext func(context.Context)) (resp.ResponseWriter, func()) {
+	if o == nil {
+		return c.wr, noop
+	}
+
+	ctx, done := o.ObserveCommand(ctx, c, name, argc)
+	setContext(ctx)
+
+	c.rec.reset(c.wr)
+	return &c.rec, func() { done(c.rec.msg) }
+}
+
 func (c *Client) pipeline(fn func(string) error) error {
 	for more := true; more; more = c.rd.Buffered() != 0 {
 		name, err := c.rd.PeekCmd()
@@ -99,38 +147,49 @@ func (c *Client) pipeline(fn func(string) error) error {
 			_ = c.rd.SkipCmd()
 			return err
 		}
-		if err := fn(name); err != nil {
+		c.beginReply()
+		err = fn(name)
+		if e := c.endReply(); err == nil {
+			err = e
+		}
+		if err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
+func noop() {}
+
+// onRelease registers a function, which is called once the client is
+// released. It returns false if the client has already been released.
+func (c *Client) onRelease(fn func()) bool {
+	c.pmu.Lock()
+	defer c.pmu.Unlock()
+
+	if c.isReleased() {
+		return false
+	}
+	c.hooks = append(c.hooks, fn)
+	return true
+}
+
 func (c *Client) release() {
+	c.pmu.Lock()
+	atomic.StoreInt32(&c.released, 1)
 	_ = c.cn.Close()
-	readerPool.Put(c.rd)
-	writerPool.Put(c.wr)
-}
 
-func (c *Client) reset(cn net.Conn) {
-	*c = Client{
-		id: atomic.AddUint64(&clientInc, 1),
-		cn: cn,
-	}
+	// hand back buffers
+	c.rd.Reset(nil)
+	c.wr.Reset(nil)
+	c.pushes = nil
 
-	if v := readerPool.Get(); v != nil {
-		rd := v.(*resp.RequestReader)
-		rd.Reset(cn)
-		c.rd = rd
-	} else {
-		c.rd = resp.NewRequestReader(cn)
-	}
+	hooks := c.hooks
+	c.hooks = nil
+	c.pmu.Unlock()
 
-	if v := writerPool.Get(); v != nil {
-		wr := v.(resp.ResponseWriter)
-		wr.Reset(cn)
-		c.wr = wr
-	} else {
-		c.wr = resp.NewResponseWriter(cn)
+	// hooks may push to other clients, run them without holding the lock
+	for _, fn := range hooks {
+		fn()
 	}
 }
@@ -0,0 +1,192 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+)
+
+var (
+	errBadReplyType    = errors.New("client: bad reply type")
+	errUnexpectedReply = errors.New("client: unexpected reply")
+)
+
+// Client is a high-level client, built on top of a Pool.
+type Client struct {
+	pool *Pool
+}
+
+// NewClient inits a new client with a connection pool.
+func NewClient(opt *Options, dialer func() (net.Conn, error)) (*Client, error) {
+	p, err := NewPool(opt, dialer)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{pool: p}, nil
+}
+
+// Pool returns the underlying connection pool.
+func (c *Client) Pool() *Pool { return c.pool }
+
+// Do executes a single command and returns the reply. Error replies from
+// the server are returned as ServerError. Supported argument types are
+// string, []byte, bool, int*, uint* and float*.
+func (c *Client) Do(ctx context.Context, cmd string, args ...interface{}) (Reply, error) {
+	p := c.Pipeline()
+	p.Do(cmd, args...)
+
+	replies, err := p.Exec(ctx)
+	if err != nil {
+		return Reply{}, err
+	}
+
+	rep := replies[0]
+	return rep, rep.Err()
+}
+
+// Pipeline starts a new pipeline.
+func (c *Client) Pipeline() *Pipeline {
+	return &Pipeline{client: c}
+}
+
+// Close closes the client and the underlying pool.
+func (c *Client) Close() error {
+	return c.pool.Close()
+}
+
+// --------------------------------------------------------------------
+
+// Pipeline queues commands and executes them in a single round-trip.
+type Pipeline struct {
+	client *Client
+	cmds   []pipelineCmd
+	err    error
+}
+
+type pipelineCmd struct {
+	name string
+	args [][]byte
+}
+
+// Do queues a command. Please see Client.Do for supported argument types.
+func (p *Pipeline) Do(cmd string, args ...interface{}) {
+	bargs := make([][]byte, 0, len(args))
+	for _, arg := range args {
+		b, err := appendArg(nil, arg)
+		if err != nil && p.err == nil {
+			p.err = err
+		}
+		bargs = append(bargs, b)
+	}
+	p.cmds = append(p.cmds, pipelineCmd{name: cmd, args: bargs})
+}
+
+// Len returns the number of queued commands.
+func (p *Pipeline) Len() int { return len(p.cmds) }
+
+// Reset discards all queued commands.
+func (p *Pipeline) Reset() {
+	p.cmds = p.cmds[:0]
+	p.err = nil
+}
+
+// Exec executes all queued commands in a single round-trip and resets the
+// pipeline. It returns one reply per queued command. Error replies from the
+// server are available via Reply.Err(). The returned error is only set on
+// argument, I/O or protocol errors.
+//
+// The context deadline is applied to the connection. If the context is
+// cancelled, pending I/O is interrupted and the context error is returned.
+func (p *Pipeline) Exec(ctx context.Context) ([]Reply, error) {
+	defer p.Reset()
+
+	if p.err != nil {
+		return nil, p.err
+	}
+	if len(p.cmds) == 0 {
+		return nil, nil
+	}
+
+	cn, err := p.client.pool.GetContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer p.client.pool.Put(cn)
+
+	for _, cmd := range p.cmds {
+		cn.WriteCmd(cmd.name, cmd.args...)
+	}
+	if err := cn.Flush(); err != nil {
+		cn.MarkFailed()
+		return nil, contextError(ctx, err)
+	}
+
+	replies := make([]Reply, len(p.cmds))
+	for i := range replies {
+		if replies[i], err = ReadReply(cn); err != nil {
+			cn.MarkFailed()
+			return nil, contextError(ctx, err)
+		}
+	}
+	return replies, nil
+}
+
+// contextError returns the context error if the context
+// is done, or err otherwise.
+func contextError(ctx context.Context, err error) error {
+	if e := ctx.Err(); e != nil {
+		return e
+	}
+
+	// socket deadlines may expire marginally before the context
+	if ne, ok := err.(net.Error); ok && ne.Timeout() {
+		if dl, ok := ctx.Deadline(); ok && !time.Now().Before(dl) {
+			return context.DeadlineExceeded
+		}
+	}
+	return err
+}
+
+// --------------------------------------------------------------------
+
+func appendArg(dst []byte, v interface{}) ([]byte, error) {
+	switch v := v.(type) {
+	case string:
+		return append(dst, v...), nil
+	case []byte:
+		return append(dst, v...), nil
+	case bool:
+		if v {
+			return append(dst, '1'), nil
+		}
+		return append(dst, '0'), nil
+	case int:
+		return strconv.AppendInt(dst, int64(v), 10), nil
+	case int8:
+		return strconv.AppendInt(dst, int64(v), 10), nil
+	case int16:
+		return strconv.AppendInt(dst, int64(v), 10), nil
+	case int32:
+		return strconv.AppendInt(dst, int64(v), 10), nil
+	case int64:
+		return strconv.AppendInt(dst, v, 10), nil
+	case uint:
+		return strconv.AppendUint(dst, uint64(v), 10), nil
+	case uint8:
+		return strconv.AppendUint(dst, uint64(v), 10), nil
+	case uint16:
+		return strconv.AppendUint(dst, uint64(v), 10), nil
+	case uint32:
+		return strconv.AppendUint(dst, uint64(v), 10), nil
+	case uint64:
+		return strconv.AppendUint(dst, v, 10), nil
+	case float32:
+		return strconv.AppendFloat(dst, float64(v), 'f', -1, 32), nil
+	case float64:
+		return strconv.AppendFloat(dst, v, 'f', -1, 64), nil
+	}
+	return dst, fmt.Errorf("client: unsupported argument type %T", v)
+}
@@ -0,0 +1,414 @@
+package client_test
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/bsm/ginkgo/v2"
+	. "github.com/bsm/gomega"
+	"github.com/bsm/pool"
+	"github.com/bsm/redeo/v2"
+	"github.com/bsm/redeo/v2/client"
+	"github.com/bsm/redeo/v2/resp"
+)
+
+var _ = Describe("Client", func() {
+	var subject *client.Client
+
+	BeforeEach(func() {
+		var err error
+		subject, err = client.NewClient(&client.Options{Options: pool.Options{InitialSize: 1}}, testServer.Dial)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(subject.Close()).To(Succeed())
+	})
+
+	It("should execute commands", func() {
+		rep, err := subject.Do(ctx, "PING")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rep.Type).To(Equal(resp.TypeInline))
+		Expect(rep.String()).To(Equal("PONG"))
+
+		rep, err = subject.Do(ctx, "ECHO", []byte("hello"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rep.String()).To(Equal("hello"))
+
+		rep, err = subject.Do(ctx, "SET", "key", 33)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rep.Bool()).To(BeTrue())
+
+		rep, err = subject.Do(ctx, "GET", "key")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rep.Int()).To(Equal(int64(33)))
+
+		rep, err = subject.Do(ctx, "GET", "missing")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rep.IsNil()).To(BeTrue())
+
+		rep, err = subject.Do(ctx, "KEYS")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rep.Strings()).To(Equal([]string{"key"}))
+	})
+
+	It("should return server errors", func() {
+		rep, err := subject.Do(ctx, "ECHO")
+		Expect(err).To(Equal(client.ServerError("ERR wrong number of arguments for 'ECHO' command")))
+		Expect(rep.Type).To(Equal(resp.TypeError))
+
+		_, err = subject.Do(ctx, "BAD")
+		Expect(err).To(MatchError("ERR unknown command 'BAD'"))
+
+		// connection should be reused
+		Expect(subject.Pool().Len()).To(Equal(1))
+	})
+
+	It("should reject unsupported arguments", func() {
+		_, err := subject.Do(ctx, "ECHO", struct{}{})
+		Expect(err).To(MatchError("client: unsupported argument type struct {}"))
+	})
+
+	It("should execute pipelines", func() {
+		pipe := subject.Pipeline()
+		pipe.Do("PING")
+		pipe.Do("SET", "key", "val")
+		pipe.Do("ECHO")
+		pipe.Do("GET", "key")
+		Expect(pipe.Len()).To(Equal(4))
+
+		replies, err := pipe.Exec(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(replies).To(HaveLen(4))
+		Expect(pipe.Len()).To(Equal(0))
+
+		Expect(replies[0].Interface()).To(Equal("PONG"))
+		Expect(replies[1].Interface()).To(Equal("OK"))
+		Expect(replies[2].Err()).To(MatchError("ERR wrong number of arguments for 'ECHO' command"))
+		Expect(replies[3].Interface()).To(Equal("val"))
+	})
+
+	It("should mark connections as failed on I/O errors", func() {
+		_, err := subject.Do(ctx, "KILL")
+		Expect(err).To(HaveOccurred())
+		Expect(subject.Pool().Len()).To(Equal(0))
+
+		rep, err := subject.Do(ctx, "PING")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rep.String()).To(Equal("PONG"))
+	})
+
+	It("should apply context deadlines", func() {
+		cctx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+		defer cancel()
+
+		start := time.Now()
+		_, err := subject.Do(cctx, "SLEEP", 300)
+		Expect(err).To(Equal(context.DeadlineExceeded))
+		Expect(time.Since(start)).To(BeNumerically("<", 250*time.Millisecond))
+		Expect(subject.Pool().Len()).To(Equal(0))
+	})
+
+	It("should interrupt on context cancellation", func() {
+		cctx, cancel := context.WithCancel(ctx)
+		time.AfterFunc(20*time.Millisecond, cancel)
+
+		start := time.Now()
+		_, err := subject.Pipeline().Exec(cctx)
+		Expect(err).NotTo(HaveOccurred())
+
+		pipe := subject.Pipeline()
+		pipe.Do("PING")
+		pipe.Do("SLEEP", 300)
+		_, err = pipe.Exec(cctx)
+		Expect(err).To(Equal(context.Canceled))
+		Expect(time.Since(start)).To(BeNumerically("<", 250*time.Millisecond))
+		Expect(subject.Pool().Len()).To(Equal(0))
+
+		_, err = subject.Do(cctx, "PING")
+		Expect(err).To(Equal(context.Canceled))
+	})
+
+	It("should reset deadlines before connections are returned", func() {
+		cctx, cancel := context.WithTimeout(ctx, time.Second)
+		defer cancel()
+
+		cn, err := subject.Pool().GetContext(cctx)
+		Expect(err).NotTo(HaveOccurred())
+		subject.Pool().Put(cn)
+		Expect(subject.Pool().Len()).To(Equal(1))
+
+		cn, err = subject.Pool().Get()
+		Expect(err).NotTo(HaveOccurred())
+		defer subject.Pool().Put(cn)
+
+		cancel()
+		cn.WriteCmdString("PING")
+		Expect(cn.Flush()).To(Succeed())
+		Expect(cn.ReadInlineString()).To(Equal("PONG"))
+	})
+})
+
+var _ = Describe("Pool", func() {
+	var subject *client.Pool
+	var opt *client.Options
+
+	BeforeEach(func() {
+		opt = &client.Options{Options: pool.Options{InitialSize: 1}}
+	})
+
+	JustBeforeEach(func() {
+		var err error
+		subject, err = client.NewPool(opt, testServer.Dial)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(subject.Close()).To(Succeed())
+	})
+
+	It("should reuse clean connections", func() {
+		cn, err := subject.Get()
+		Expect(err).NotTo(HaveOccurred())
+		cn.WriteCmdString("PING")
+		Expect(cn.Flush()).To(Succeed())
+		Expect(cn.ReadInlineString()).To(Equal("PONG"))
+		subject.Put(cn)
+
+		Expect(subject.Stats()).To(Equal(client.PoolStats{Idle: 1}))
+	})
+
+	It("should discard connections with unflushed commands", func() {
+		cn, err := subject.Get()
+		Expect(err).NotTo(HaveOccurred())
+		cn.WriteCmdString("PING")
+		subject.Put(cn)
+
+		Expect(subject.Stats()).To(Equal(client.PoolStats{DiscardedDirty: 1}))
+	})
+
+	It("should discard connections with delayed replies", func() {
+		cn, err := subject.Get()
+		Expect(err).NotTo(HaveOccurred())
+		cn.WriteCmdString("SLEEP", "50")
+		Expect(cn.Flush()).To(Succeed())
+		subject.Put(cn)
+		Expect(subject.Stats()).To(Equal(client.PoolStats{DiscardedDirty: 1}))
+
+		cn, err = subject.Get()
+		Expect(err).NotTo(HaveOccurred())
+		defer subject.Put(cn)
+
+		cn.WriteCmdString("ECHO", "x")
+		Expect(cn.Flush()).To(Succeed())
+		Expect(cn.ReadBulkString()).To(Equal("x"))
+	})
+
+	It("should reuse connections after reading nested replies", func() {
+		cn, err := subject.Get()
+		Expect(err).NotTo(HaveOccurred())
+		cn.WriteCmdString("SET", "key", "val")
+		cn.WriteCmdString("KEYS")
+		Expect(cn.Flush()).To(Succeed())
+		Expect(cn.ReadInlineString()).To(Equal("OK"))
+		Expect(cn.ReadArrayLen()).To(Equal(1))
+		subject.Put(cn)
+		Expect(subject.Stats()).To(Equal(client.PoolStats{DiscardedDirty: 1}))
+
+		cn, err = subject.Get()
+		Expect(err).NotTo(HaveOccurred())
+		cn.WriteCmdString("KEYS")
+		Expect(cn.Flush()).To(Succeed())
+		Expect(cn.ReadArrayLen()).To(Equal(1))
+		Expect(cn.ReadBulkString()).To(Equal("key"))
+		subject.Put(cn)
+		Expect(subject.Stats()).To(Equal(client.PoolStats{Idle: 1, DiscardedDirty: 1}))
+	})
+
+	It("should discard connections with unread replies", func() {
+		cn, err := subject.Get()
+		Expect(err).NotTo(HaveOccurred())
+		cn.WriteCmdString("PING")
+		cn.WriteCmdString("PING")
+		Expect(cn.Flush()).To(Succeed())
+		Expect(cn.ReadInlineString()).To(Equal("PONG"))
+		subject.Put(cn)
+
+		Expect(subject.Stats()).To(Equal(client.PoolStats{DiscardedDirty: 1}))
+	})
+
+	Describe("with DrainDirty", func() {
+		BeforeEach(func() {
+			opt.DrainDirty = true
+			opt.DrainTimeout = 100 * time.Millisecond
+		})
+
+		It("should drain dirty connections", func() {
+			cn, err := subject.Get()
+			Expect(err).NotTo(HaveOccurred())
+			cn.WriteCmdString("ECHO", "a")
+			cn.WriteCmdString("ECHO", "b")
+			Expect(cn.Flush()).To(Succeed())
+			Expect(cn.ReadBulkString()).To(Equal("a"))
+			cn.WriteCmdString("SET", "key", "value")
+			subject.Put(cn)
+			Expect(subject.Stats()).To(Equal(client.PoolStats{Idle: 1, Drained: 1}))
+
+			cn, err = subject.Get()
+			Expect(err).NotTo(HaveOccurred())
+			defer subject.Put(cn)
+
+			cn.WriteCmdString("GET", "key")
+			Expect(cn.Flush()).To(Succeed())
+			Expect(cn.PeekType()).To(Equal(resp.TypeNil))
+			Expect(cn.ReadNil()).To(Succeed())
+		})
+
+		It("should discard connections that cannot be drained", func() {
+			cn, err := subject.Get()
+			Expect(err).NotTo(HaveOccurred())
+			cn.WriteCmdString("SLEEP", "300")
+			Expect(cn.Flush()).To(Succeed())
+			cn.WriteCmdString("PING")
+			subject.Put(cn)
+
+			Expect(subject.Stats()).To(Equal(client.PoolStats{DiscardedDirty: 1}))
+		})
+	})
+
+	Describe("with PingOnBorrow", func() {
+		BeforeEach(func() {
+			opt.PingOnBorrow = true
+		})
+
+		It("should discard unhealthy connections", func() {
+			cn, err := subject.Get()
+			Expect(err).NotTo(HaveOccurred())
+			cn.WriteCmdString("QUIT")
+			Expect(cn.Flush()).To(Succeed())
+			Expect(cn.ReadInlineString()).To(Equal("OK"))
+			subject.Put(cn)
+			Expect(subject.Len()).To(Equal(1))
+
+			time.Sleep(10 * time.Millisecond)
+			cn, err = subject.Get()
+			Expect(err).NotTo(HaveOccurred())
+			defer subject.Put(cn)
+
+			cn.WriteCmdString("ECHO", "x")
+			Expect(cn.Flush()).To(Succeed())
+			Expect(cn.ReadBulkString()).To(Equal("x"))
+			Expect(subject.Stats().FailedHealthChecks).To(Equal(int64(1)))
+		})
+	})
+})
+
+// --------------------------------------------------------------------
+
+var ctx = context.Background()
+
+type server struct {
+	*redeo.Server
+	lis    net.Listener
+	broker *redeo.PubSubBroker
+	data   map[string]string
+	mu     sync.Mutex
+}
+
+func newServer() *server {
+	s := &server{
+		Server: redeo.NewServer(nil),
+		broker: redeo.NewPubSubBroker(),
+		data:   make(map[string]string),
+	}
+	s.Handle("ping", redeo.Ping())
+	s.Handle("subscribe", s.broker.Subscribe())
+	s.Handle("psubscribe", s.broker.PSubscribe())
+	s.Handle("unsubscribe", s.broker.Unsubscribe())
+	s.Handle("punsubscribe", s.broker.PUnsubscribe())
+	s.Handle("publish", s.broker.Publish())
+	s.Handle("echo", redeo.Echo())
+	s.HandleFunc("set", func(w resp.ResponseWriter, c *resp.Command) {
+		if c.ArgN() != 2 {
+			w.AppendError(redeo.WrongNumberOfArgs(c.Name))
+			return
+		}
+		s.mu.Lock()
+		s.data[c.Arg(0).String()] = c.Arg(1).String()
+		s.mu.Unlock()
+		w.AppendOK()
+	})
+	s.HandleFunc("get", func(w resp.ResponseWriter, c *resp.Command) {
+		s.mu.Lock()
+		v, ok := s.data[c.Arg(0).String()]
+		s.mu.Unlock()
+		if !ok {
+			w.AppendNil()
+			return
+		}
+		w.AppendBulkString(v)
+	})
+	s.HandleFunc("keys", func(w resp.ResponseWriter, c *resp.Command) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		w.AppendArrayLen(len(s.data))
+		for k := range s.data {
+			w.AppendBulkString(k)
+		}
+	})
+	s.HandleFunc("sleep", func(w resp.ResponseWriter, c *resp.Command) {
+		ms, _ := c.Arg(0).Int()
+		time.Sleep(time.Duration(ms) * time.Millisecond)
+		w.AppendOK()
+	})
+	s.HandleFunc("kill", func(w resp.ResponseWriter, c *resp.Command) {
+		redeo.GetClient(c.Context()).Close()
+	})
+	s.HandleFunc("quit", func(w resp.ResponseWriter, c *resp.Command) {
+		w.AppendOK()
+		_ = w.Flush()
+		redeo.GetClient(c.Context()).Close()
+	})
+	return s
+}
+
+func (s *server) Dial() (net.Conn, error) {
+	return net.Dial("tcp", s.lis.Addr().String())
+}
+
+func (s *server) Listen() {
+	var err error
+	s.lis, err = net.Listen("tcp", "127.0.0.1:0")
+	Expect(err).NotTo(HaveOccurred())
+
+	go func() { _ = s.Serve(s.lis) }()
+}
+
+func (s *server) Reset() {
+	s.mu.Lock()
+	s.data = make(map[string]string)
+	s.mu.Unlock()
+}
+
+var testServer = newServer()
+
+var _ = BeforeSuite(func() {
+	testServer.Listen()
+})
+
+var _ = AfterSuite(func() {
+	Expect(testServer.lis.Close()).To(Succeed())
+})
+
+var _ = AfterEach(func() {
+	testServer.Reset()
+})
+
+func TestSuite(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "redeo/client")
+}
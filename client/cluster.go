@@ -0,0 +1,536 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/bsm/redeo/v2/resp"
+)
+
+// NumSlots is the number of hash slots in a redis cluster.
+const NumSlots = 16384
+
+var (
+	errNoClusterNodes   = errors.New("client: no reachable cluster nodes")
+	errTooManyRedirects = errors.New("client: too many cluster redirects")
+)
+
+// ClusterOptions contains options for cluster clients.
+type ClusterOptions struct {
+	// Addrs is a list of seed node addresses, used to discover
+	// the cluster topology.
+	Addrs []string
+
+	// Dialer is used to connect to individual nodes.
+	// Default: TCP connection to addr
+	Dialer func(addr string) (net.Conn, error)
+
+	// Pool contains options for the per-node connection pools.
+	Pool Options
+
+	// MaxRedirects limits the number of MOVED/ASK redirects
+	// that are followed for a single command.
+	// Default: 5
+	MaxRedirects int
+}
+
+func (o *ClusterOptions) norm() ClusterOptions {
+	var oo ClusterOptions
+	if o != nil {
+		oo = *o
+	}
+	if len(oo.Addrs) == 0 {
+		oo.Addrs = []string{"127.0.0.1:6379"}
+	}
+	if oo.Dialer == nil {
+		oo.Dialer = func(addr string) (net.Conn, error) {
+			return net.Dial("tcp", addr)
+		}
+	}
+	if oo.MaxRedirects <= 0 {
+		oo.MaxRedirects = 5
+	}
+	return oo
+}
+
+// ClusterClient is a client for redis clusters. It maintains a connection
+// pool per node and routes commands to the nodes owning the respective
+// hash slots.
+type ClusterClient struct {
+	opt ClusterOptions
+
+	slots []string // slot -> node address
+	nodes map[string]*clusterNode
+	mu    sync.RWMutex
+
+	refreshing int32
+}
+
+// NewClusterClient inits a new cluster client and discovers the
+// cluster topology via the seed nodes.
+func NewClusterClient(opt *ClusterOptions) (*ClusterClient, error) {
+	c := &ClusterClient{
+		opt:   opt.norm(),
+		nodes: make(map[string]*clusterNode),
+	}
+	if err := c.Refresh(context.Background()); err != nil {
+		_ = c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// Do executes a single command. Commands are routed by their first
+// argument, which is assumed to be the key; commands without arguments are
+// sent to a random node. MOVED and ASK redirections are followed
+// transparently.
+func (c *ClusterClient) Do(ctx context.Context, cmd string, args ...interface{}) (Reply, error) {
+	var key []byte
+	if len(args) != 0 {
+		var err error
+		if key, err = appendArg([]byte{}, args[0]); err != nil {
+			return Reply{}, err
+		}
+	}
+	return c.DoKey(ctx, key, cmd, args...)
+}
+
+// DoKey executes a single command on the node owning the given key.
+// A nil key routes the command to a random node. Please see Do for details.
+func (c *ClusterClient) DoKey(ctx context.Context, key []byte, cmd string, args ...interface{}) (Reply, error) {
+	addr := c.nodeAddr(key)
+	asking := false
+
+	for i := 0; i <= c.opt.MaxRedirects; i++ {
+		node, err := c.node(addr)
+		if err != nil {
+			return Reply{}, err
+		}
+
+		rep, err := node.do(ctx, asking, cmd, args...)
+		node.release()
+		if err != nil {
+			return Reply{}, err
+		}
+
+		kind, slot, target, ok := parseRedirect(rep)
+		if !ok {
+			return rep, rep.Err()
+		}
+
+		switch kind {
+		case "MOVED":
+			c.mu.Lock()
+			c.slots[slot] = target
+			c.mu.Unlock()
+			c.refreshAsync()
+			asking = false
+		case "ASK":
+			asking = true
+		}
+		addr = target
+	}
+	return Reply{}, errTooManyRedirects
+}
+
+// Refresh reloads the cluster topology.
+func (c *ClusterClient) Refresh(ctx context.Context) error {
+	c.mu.RLock()
+	addrs := make([]string, 0, len(c.nodes)+len(c.opt.Addrs))
+	for addr := range c.nodes {
+		addrs = append(addrs, addr)
+	}
+	c.mu.RUnlock()
+	addrs = append(addrs, c.opt.Addrs...)
+
+	err := errNoClusterNodes
+	for _, addr := range addrs {
+		var slots []string
+		if slots, err = c.fetchSlots(ctx, addr); err == nil {
+			c.updateSlots(slots)
+			return nil
+		}
+	}
+	return err
+}
+
+// Close closes all node connection pools.
+func (c *ClusterClient) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var err error
+	for addr, node := range c.nodes {
+		if e := node.close(); e != nil && err == nil {
+			err = e
+		}
+		delete(c.nodes, addr)
+	}
+	return err
+}
+
+func (c *ClusterClient) refreshAsync() {
+	if !atomic.CompareAndSwapInt32(&c.refreshing, 0, 1) {
+		return
+	}
+	go func() {
+		defer atomic.StoreInt32(&c.refreshing, 0)
+		_ = c.Refresh(context.Background())
+	}()
+}
+
+func (c *ClusterClient) nodeAddr(key []byte) string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if key != nil && len(c.slots) == NumSlots {
+		if addr := c.slots[Slot(key)]; addr != "" {
+			return addr
+		}
+	}
+
+	// pick a random node
+	n := rand.Intn(len(c.nodes) + 1)
+	for addr := range c.nodes {
+		if n--; n < 0 {
+			return addr
+		}
+	}
+	return c.opt.Addrs[0]
+}
+
+// node returns the node for addr, creating it if necessary. Nodes must be
+// released after use.
+func (c *ClusterClient) node(addr string) (*clusterNode, error) {
+	c.mu.RLock()
+	node, ok := c.nodes[addr]
+	if ok {
+		node.acquire()
+	}
+	c.mu.RUnlock()
+	if ok {
+		return node, nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if node, ok := c.nodes[addr]; ok {
+		node.acquire()
+		return node, nil
+	}
+
+	opt := c.opt.Pool
+	pool, err := NewPool(&opt, func() (net.Conn, error) { return c.opt.Dialer(addr) })
+	if err != nil {
+		return nil, err
+	}
+	node = &clusterNode{Client: &Client{pool: pool}}
+	node.acquire()
+	c.nodes[addr] = node
+	return node, nil
+}
+
+// fetchSlots retrieves slot ownership from a node, via CLUSTER SLOTS
+// or CLUSTER SHARDS.
+func (c *ClusterClient) fetchSlots(ctx context.Context, addr string) ([]string, error) {
+	node, err := c.node(addr)
+	if err != nil {
+		return nil, err
+	}
+	defer node.release()
+
+	host, _, _ := net.SplitHostPort(addr)
+	rep, err := node.Do(ctx, "CLUSTER", "SLOTS")
+	if err == nil {
+		return parseClusterSlots(rep, host)
+	} else if _, ok := err.(ServerError); !ok {
+		return nil, err
+	}
+
+	if rep, err = node.Do(ctx, "CLUSTER", "SHARDS"); err != nil {
+		return nil, err
+	}
+	return parseClusterShards(rep, host)
+}
+
+// updateSlots applies new slot ownership and retires nodes which are no
+// longer part of the cluster. Their pools are closed once in-flight
+// commands have completed.
+func (c *ClusterClient) updateSlots(slots []string) {
+	owners := make(map[string]struct{})
+	for _, addr := range slots {
+		owners[addr] = struct{}{}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.slots = slots
+	for addr, node := range c.nodes {
+		if _, ok := owners[addr]; !ok {
+			node.retire()
+			delete(c.nodes, addr)
+		}
+	}
+}
+
+// --------------------------------------------------------------------
+
+// clusterNode is a reference-counted node client.
+type clusterNode struct {
+	*Client
+
+	refs    int32 // number of in-flight users
+	retired int32 // removed from the cluster, close once unused
+	closed  int32
+}
+
+func (n *clusterNode) acquire() { atomic.AddInt32(&n.refs, 1) }
+
+func (n *clusterNode) release() {
+	if atomic.AddInt32(&n.refs, -1) == 0 && atomic.LoadInt32(&n.retired) == 1 {
+		_ = n.close()
+	}
+}
+
+func (n *clusterNode) retire() {
+	atomic.StoreInt32(&n.retired, 1)
+	if atomic.LoadInt32(&n.refs) == 0 {
+		_ = n.close()
+	}
+}
+
+func (n *clusterNode) close() error {
+	if !atomic.CompareAndSwapInt32(&n.closed, 0, 1) {
+		return nil
+	}
+	return n.Client.Close()
+}
+
+// do executes a command, optionally preceded by ASKING. Server errors are
+// returned as part of the reply.
+func (n *clusterNode) do(ctx context.Context, asking bool, cmd string, args ...interface{}) (Reply, error) {
+	if !asking {
+		rep, err := n.Do(ctx, cmd, args...)
+		if err != nil && rep.Err() == nil {
+			return Reply{}, err
+		}
+		return rep, nil
+	}
+
+	p := n.Pipeline()
+	p.Do("ASKING")
+	p.Do(cmd, args...)
+
+	replies, err := p.Exec(ctx)
+	if err != nil {
+		return Reply{}, err
+	}
+	return replies[1], nil
+}
+
+// --------------------------------------------------------------------
+
+// Slot returns the cluster hash slot of a key. If the key contains a hash
+// tag, i.e. a non-empty substring enclosed in {}, only the tag is hashed.
+func Slot(key []byte) int {
+	if start := bytes.IndexByte(key, '{'); start > -1 {
+		if end := bytes.IndexByte(key[start+1:], '}'); end > 0 {
+			key = key[start+1 : start+1+end]
+		}
+	}
+	return int(crc16(key) % NumSlots)
+}
+
+// crc16 implements CRC16-CCITT (XMODEM), as used by redis cluster.
+func crc16(b []byte) uint16 {
+	var crc uint16
+	for _, x := range b {
+		crc = crc<<8 ^ crc16tab[byte(crc>>8)^x]
+	}
+	return crc
+}
+
+var crc16tab = func() (tab [256]uint16) {
+	for i := range tab {
+		crc := uint16(i) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+		tab[i] = crc
+	}
+	return
+}()
+
+// parseRedirect parses MOVED and ASK error replies.
+func parseRedirect(rep Reply) (kind string, slot int, addr string, ok bool) {
+	if rep.Type != resp.TypeError {
+		return
+	}
+
+	parts := strings.Fields(rep.str)
+	if len(parts) != 3 || (parts[0] != "MOVED" && parts[0] != "ASK") {
+		return
+	}
+
+	n, err := strconv.Atoi(parts[1])
+	if err != nil || n < 0 || n >= NumSlots {
+		return
+	}
+	return parts[0], n, parts[2], true
+}
+
+func parseClusterSlots(rep Reply, host string) ([]string, error) {
+	ranges, err := rep.Array()
+	if err != nil {
+		return nil, err
+	}
+
+	slots := make([]string, NumSlots)
+	for _, r := range ranges {
+		elems, err := r.Array()
+		if err != nil {
+			return nil, err
+		} else if len(elems) < 3 {
+			return nil, errUnexpectedReply
+		}
+
+		start, err := elems[0].Int()
+		if err != nil {
+			return nil, err
+		}
+		end, err := elems[1].Int()
+		if err != nil {
+			return nil, err
+		}
+
+		master, err := elems[2].Array()
+		if err != nil {
+			return nil, err
+		} else if len(master) < 2 {
+			return nil, errUnexpectedReply
+		}
+
+		ip, _ := master[0].String()
+		port, err := master[1].String()
+		if err != nil {
+			return nil, err
+		}
+		if err := assignSlots(slots, start, end, joinHostPort(ip, port, host)); err != nil {
+			return nil, err
+		}
+	}
+	return slots, nil
+}
+
+func parseClusterShards(rep Reply, host string) ([]string, error) {
+	shards, err := rep.Array()
+	if err != nil {
+		return nil, err
+	}
+
+	slots := make([]string, NumSlots)
+	for _, shard := range shards {
+		attrs, err := replyMap(shard)
+		if err != nil {
+			return nil, err
+		}
+
+		nodes, err := attrs["nodes"].Array()
+		if err != nil {
+			return nil, err
+		}
+
+		var addr string
+		for _, node := range nodes {
+			nattrs, err := replyMap(node)
+			if err != nil {
+				return nil, err
+			}
+			if role, _ := nattrs["role"].String(); role != "master" {
+				continue
+			}
+
+			ip, _ := nattrs["endpoint"].String()
+			if ip == "" || ip == "?" {
+				ip, _ = nattrs["ip"].String()
+			}
+			port, err := nattrs["port"].String()
+			if err != nil {
+				return nil, err
+			}
+			addr = joinHostPort(ip, port, host)
+		}
+		if addr == "" {
+			continue
+		}
+
+		ranges, err := attrs["slots"].Array()
+		if err != nil {
+			return nil, err
+		}
+		for i := 0; i+1 < len(ranges); i += 2 {
+			start, err := ranges[i].Int()
+			if err != nil {
+				return nil, err
+			}
+			end, err := ranges[i+1].Int()
+			if err != nil {
+				return nil, err
+			}
+			if err := assignSlots(slots, start, end, addr); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return slots, nil
+}
+
+// replyMap converts a flat key/value array reply into a map.
+func replyMap(rep Reply) (map[string]Reply, error) {
+	elems, err := rep.Array()
+	if err != nil {
+		return nil, err
+	}
+
+	m := make(map[string]Reply, len(elems)/2)
+	for i := 0; i+1 < len(elems); i += 2 {
+		key, err := elems[i].String()
+		if err != nil {
+			return nil, err
+		}
+		m[key] = elems[i+1]
+	}
+	return m, nil
+}
+
+func assignSlots(slots []string, start, end int64, addr string) error {
+	if start < 0 || end >= NumSlots || start > end {
+		return errUnexpectedReply
+	}
+	for i := start; i <= end; i++ {
+		slots[i] = addr
+	}
+	return nil
+}
+
+// joinHostPort builds a node address, falling back on the host of the
+// queried node if the ip is unknown.
+func joinHostPort(ip, port, host string) string {
+	if ip == "" || ip == "?" {
+		ip = host
+	}
+	return net.JoinHostPort(ip, port)
+}
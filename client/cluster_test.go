@@ -0,0 +1,396 @@
+package client_test
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/bsm/ginkgo/v2"
+	. "github.com/bsm/gomega"
+	"github.com/bsm/redeo/v2"
+	"github.com/bsm/redeo/v2/client"
+	"github.com/bsm/redeo/v2/resp"
+)
+
+var _ = Describe("Slot", func() {
+	It("should calculate hash slots", func() {
+		Expect(client.Slot([]byte("123456789"))).To(Equal(0x31C3))
+		Expect(client.Slot([]byte("foo"))).To(Equal(12182))
+		Expect(client.Slot([]byte("bar"))).To(Equal(5061))
+		Expect(client.Slot([]byte(""))).To(Equal(0))
+	})
+
+	It("should support hash tags", func() {
+		Expect(client.Slot([]byte("{user1000}.following"))).To(Equal(client.Slot([]byte("user1000"))))
+		Expect(client.Slot([]byte("{user1000}.followers"))).To(Equal(client.Slot([]byte("user1000"))))
+		Expect(client.Slot([]byte("foo{}{bar}"))).NotTo(Equal(client.Slot([]byte("bar"))))
+		Expect(client.Slot([]byte("foo{{bar}}zap"))).To(Equal(client.Slot([]byte("{bar"))))
+		Expect(client.Slot([]byte("foo{bar}{zap}"))).To(Equal(client.Slot([]byte("bar"))))
+	})
+})
+
+var _ = Describe("ClusterClient", func() {
+	var subject *client.ClusterClient
+	var cluster *fakeCluster
+	var opt *client.ClusterOptions
+
+	BeforeEach(func() {
+		cluster = newFakeCluster(3)
+		opt = &client.ClusterOptions{Addrs: []string{cluster.nodes[1].Addr()}}
+	})
+
+	JustBeforeEach(func() {
+		var err error
+		subject, err = client.NewClusterClient(opt)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(subject.Close()).To(Succeed())
+		cluster.Close()
+	})
+
+	It("should route commands by key", func() {
+		keys := []string{"foo", "bar", "c", "{user1}.a", "{user1}.b"}
+		for _, key := range keys {
+			Expect(subject.Do(ctx, "SET", key, "v:"+key)).To(HaveField("Type", resp.TypeInline))
+		}
+		for _, key := range keys {
+			rep, err := subject.Do(ctx, "GET", key)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(rep.String()).To(Equal("v:" + key))
+		}
+
+		Expect(cluster.nodes[0].Keys()).To(ConsistOf("bar"))
+		Expect(cluster.nodes[1].Keys()).To(ConsistOf("c", "{user1}.a", "{user1}.b"))
+		Expect(cluster.nodes[2].Keys()).To(ConsistOf("foo"))
+	})
+
+	It("should follow MOVED redirects and refresh", func() {
+		Expect(cluster.Calls()).To(Equal(1))
+		cluster.Move(client.Slot([]byte("foo")), 0)
+
+		_, err := subject.Do(ctx, "SET", "foo", "bar")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cluster.nodes[0].Keys()).To(ConsistOf("foo"))
+		Expect(cluster.nodes[2].Keys()).To(BeEmpty())
+		Eventually(cluster.Calls).Should(Equal(2))
+
+		_, err = subject.Do(ctx, "SET", "foo", "baz")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cluster.Redirects()).To(Equal(1))
+	})
+
+	It("should follow ASK redirects", func() {
+		cluster.Ask(client.Slot([]byte("foo")), 1)
+
+		_, err := subject.Do(ctx, "SET", "foo", "bar")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cluster.nodes[1].Keys()).To(ConsistOf("foo"))
+		Expect(cluster.nodes[2].Keys()).To(BeEmpty())
+		Expect(cluster.Calls()).To(Equal(1))
+	})
+
+	It("should retire removed nodes once in-flight commands complete", func() {
+		_, err := subject.Do(ctx, "SET", "foo", "bar")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cluster.nodes[2].Info().NumClients()).To(Equal(1))
+
+		errs := make(chan error, 1)
+		go func() {
+			_, err := subject.Do(ctx, "SLEEP", "foo", 100)
+			errs <- err
+		}()
+		Eventually(cluster.nodes[2].Info().TotalCommands).Should(Equal(int64(2)))
+
+		// move all slots of the third node
+		for slot := 0; slot < client.NumSlots; slot++ {
+			if slot*3/client.NumSlots == 2 {
+				cluster.Move(slot, 0)
+			}
+		}
+		Expect(subject.Refresh(ctx)).To(Succeed())
+
+		// the refresh may have queried the third node via an extra connection
+		Expect(cluster.nodes[2].Info().NumClients()).To(BeNumerically(">=", 1))
+
+		Eventually(errs).Should(Receive(BeNil()))
+		Eventually(cluster.nodes[2].Info().NumClients).Should(Equal(0))
+	})
+
+	It("should return server errors", func() {
+		_, err := subject.Do(ctx, "SET", "foo")
+		Expect(err).To(MatchError("ERR wrong number of arguments for 'SET' command"))
+	})
+
+	It("should limit redirects", func() {
+		cluster.Ask(client.Slot([]byte("foo")), 1)
+		cluster.nodes[1].rejectAsking = true
+
+		_, err := subject.Do(ctx, "SET", "foo", "bar")
+		Expect(err).To(MatchError("client: too many cluster redirects"))
+	})
+
+	Describe("without CLUSTER SLOTS", func() {
+		BeforeEach(func() {
+			cluster.noSlots = true
+		})
+
+		It("should discover via CLUSTER SHARDS", func() {
+			for _, key := range []string{"foo", "bar", "c"} {
+				_, err := subject.Do(ctx, "SET", key, "v")
+				Expect(err).NotTo(HaveOccurred())
+			}
+			Expect(cluster.nodes[0].Keys()).To(ConsistOf("bar"))
+			Expect(cluster.nodes[1].Keys()).To(ConsistOf("c"))
+			Expect(cluster.nodes[2].Keys()).To(ConsistOf("foo"))
+			Expect(cluster.Redirects()).To(Equal(0))
+		})
+	})
+})
+
+// --------------------------------------------------------------------
+
+type fakeCluster struct {
+	nodes   []*fakeNode
+	owners  [client.NumSlots]int
+	ask     map[int]int
+	noSlots bool
+
+	calls     int
+	redirects int
+	mu        sync.Mutex
+}
+
+func newFakeCluster(n int) *fakeCluster {
+	c := &fakeCluster{ask: make(map[int]int)}
+	for i := 0; i < n; i++ {
+		c.nodes = append(c.nodes, newFakeNode(c, i))
+	}
+	for slot := range c.owners {
+		c.owners[slot] = slot * n / client.NumSlots
+	}
+	return c
+}
+
+func (c *fakeCluster) Move(slot, node int) {
+	c.mu.Lock()
+	c.owners[slot] = node
+	c.mu.Unlock()
+}
+
+func (c *fakeCluster) Ask(slot, node int) {
+	c.mu.Lock()
+	c.ask[slot] = node
+	c.mu.Unlock()
+}
+
+func (c *fakeCluster) Calls() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.calls
+}
+
+func (c *fakeCluster) Redirects() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.redirects
+}
+
+func (c *fakeCluster) Close() {
+	for _, n := range c.nodes {
+		_ = n.lis.Close()
+	}
+}
+
+func (c *fakeCluster) serveCluster(w resp.ResponseWriter, cmd *resp.Command) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	type slotRange struct{ start, end, node int }
+	var ranges []slotRange
+	for slot, node := range c.owners {
+		if n := len(ranges); n != 0 && ranges[n-1].node == node {
+			ranges[n-1].end = slot
+		} else {
+			ranges = append(ranges, slotRange{start: slot, end: slot, node: node})
+		}
+	}
+
+	switch strings.ToLower(cmd.Arg(0).String()) {
+	case "slots":
+		if c.noSlots {
+			w.AppendError("ERR unknown subcommand 'SLOTS'")
+			return
+		}
+
+		c.calls++
+		w.AppendArrayLen(len(ranges))
+		for _, r := range ranges {
+			w.AppendArrayLen(3)
+			w.AppendInt(int64(r.start))
+			w.AppendInt(int64(r.end))
+			w.AppendArrayLen(3)
+			w.AppendBulkString("")
+			w.AppendInt(int64(c.nodes[r.node].Port()))
+			w.AppendBulkString("node" + strconv.Itoa(r.node))
+		}
+	case "shards":
+		c.calls++
+		w.AppendArrayLen(len(c.nodes))
+		for i, n := range c.nodes {
+			var owned []slotRange
+			for _, r := range ranges {
+				if r.node == i {
+					owned = append(owned, r)
+				}
+			}
+
+			w.AppendArrayLen(4)
+			w.AppendBulkString("slots")
+			w.AppendArrayLen(len(owned) * 2)
+			for _, r := range owned {
+				w.AppendInt(int64(r.start))
+				w.AppendInt(int64(r.end))
+			}
+			w.AppendBulkString("nodes")
+			w.AppendArrayLen(1)
+			w.AppendArrayLen(10)
+			w.AppendBulkString("id")
+			w.AppendBulkString("node" + strconv.Itoa(i))
+			w.AppendBulkString("port")
+			w.AppendInt(int64(n.Port()))
+			w.AppendBulkString("ip")
+			w.AppendBulkString("127.0.0.1")
+			w.AppendBulkString("endpoint")
+			w.AppendBulkString("127.0.0.1")
+			w.AppendBulkString("role")
+			w.AppendBulkString("master")
+		}
+	default:
+		w.AppendError("ERR unknown subcommand")
+	}
+}
+
+// redirect returns a MOVED/ASK error if the key is not served by the node.
+func (c *fakeCluster) redirect(n *fakeNode, key string, asking bool) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	slot := client.Slot([]byte(key))
+	owner := c.owners[slot]
+	target, migrating := c.ask[slot]
+
+	var msg string
+	switch {
+	case migrating && target == n.id && asking && !n.rejectAsking:
+		return ""
+	case migrating && owner == n.id:
+		msg = "ASK " + strconv.Itoa(slot) + " " + c.nodes[target].Addr()
+	case owner != n.id:
+		msg = "MOVED " + strconv.Itoa(slot) + " " + c.nodes[owner].Addr()
+	default:
+		return ""
+	}
+	c.redirects++
+	return msg
+}
+
+type fakeNode struct {
+	*redeo.Server
+	id           int
+	lis          net.Listener
+	data         map[string]string
+	asking       map[uint64]bool
+	rejectAsking bool
+	mu           sync.Mutex
+}
+
+func newFakeNode(c *fakeCluster, id int) *fakeNode {
+	n := &fakeNode{
+		Server: redeo.NewServer(nil),
+		id:     id,
+		data:   make(map[string]string),
+		asking: make(map[uint64]bool),
+	}
+
+	n.HandleFunc("cluster", c.serveCluster)
+	n.HandleFunc("asking", func(w resp.ResponseWriter, cmd *resp.Command) {
+		n.mu.Lock()
+		n.asking[redeo.GetClient(cmd.Context()).ID()] = true
+		n.mu.Unlock()
+		w.AppendOK()
+	})
+	n.HandleFunc("set", func(w resp.ResponseWriter, cmd *resp.Command) {
+		if cmd.ArgN() != 2 {
+			w.AppendError(redeo.WrongNumberOfArgs(cmd.Name))
+			return
+		}
+
+		key := cmd.Arg(0).String()
+		if msg := c.redirect(n, key, n.popAsking(cmd)); msg != "" {
+			w.AppendError(msg)
+			return
+		}
+
+		n.mu.Lock()
+		n.data[key] = cmd.Arg(1).String()
+		n.mu.Unlock()
+		w.AppendOK()
+	})
+	n.HandleFunc("sleep", func(w resp.ResponseWriter, cmd *resp.Command) {
+		ms, _ := cmd.Arg(1).Int()
+		time.Sleep(time.Duration(ms) * time.Millisecond)
+		w.AppendOK()
+	})
+	n.HandleFunc("get", func(w resp.ResponseWriter, cmd *resp.Command) {
+		key := cmd.Arg(0).String()
+		if msg := c.redirect(n, key, n.popAsking(cmd)); msg != "" {
+			w.AppendError(msg)
+			return
+		}
+
+		n.mu.Lock()
+		v, ok := n.data[key]
+		n.mu.Unlock()
+		if !ok {
+			w.AppendNil()
+			return
+		}
+		w.AppendBulkString(v)
+	})
+
+	var err error
+	n.lis, err = net.Listen("tcp", "127.0.0.1:0")
+	Expect(err).NotTo(HaveOccurred())
+	go func() { _ = n.Serve(n.lis) }()
+
+	return n
+}
+
+func (n *fakeNode) Addr() string { return n.lis.Addr().String() }
+func (n *fakeNode) Port() int    { return n.lis.Addr().(*net.TCPAddr).Port }
+
+func (n *fakeNode) Keys() []string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	keys := make([]string, 0, len(n.data))
+	for key := range n.data {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+func (n *fakeNode) popAsking(cmd *resp.Command) bool {
+	id := redeo.GetClient(cmd.Context()).ID()
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	asking := n.asking[id]
+	delete(n.asking, id)
+	return asking
+}
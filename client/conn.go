@@ -1,8 +1,10 @@
 package client
 
 import (
+	"context"
 	"io"
 	"net"
+	"sync/atomic"
 	"time"
 
 	"github.com/bsm/redeo/v2/resp"
@@ -80,11 +82,19 @@ type conn struct {
 	*resp.RequestWriter
 	resp.ResponseReader
 
-	failed bool
+	failed int32
+	gen    int64
+
+	pending int64 // number of commands awaiting a reply, accessed atomically
+	nested  []int // remaining elements of partially read arrays
+
+	deadline bool
+	stop     chan struct{}
+	done     chan struct{}
 }
 
 // MarkFailed implements Conn interface.
-func (c *conn) MarkFailed() { c.failed = true }
+func (c *conn) MarkFailed() { atomic.StoreInt32(&c.failed, 1) }
 
 // UnreadBytes implements Conn interface.
 func (c *conn) UnreadBytes() int { return c.ResponseReader.Buffered() }
@@ -93,6 +103,198 @@ func (c *conn) UnreadBytes() int { return c.ResponseReader.Buffered() }
 func (c *conn) UnflushedBytes() int { return c.RequestWriter.Buffered() }
 
 // Close implements Conn interface.
-func (c *conn) Close() error { c.failed = true; return c.Conn.Close() }
+func (c *conn) Close() error { c.MarkFailed(); return c.Conn.Close() }
+
+func (c *conn) isFailed() bool { return atomic.LoadInt32(&c.failed) == 1 }
+
+// isDirty returns true if the connection has unread or unflushed bytes, or
+// if replies to written commands have not been (fully) read.
+func (c *conn) isDirty() bool {
+	return atomic.LoadInt64(&c.pending) != 0 || len(c.nested) != 0 || c.UnreadBytes() != 0 || c.UnflushedBytes() != 0
+}
+
+// WriteCmd implements Conn interface.
+func (c *conn) WriteCmd(cmd string, args ...[]byte) {
+	c.RequestWriter.WriteCmd(cmd, args...)
+	atomic.AddInt64(&c.pending, 1)
+}
+
+// WriteCmdString implements Conn interface.
+func (c *conn) WriteCmdString(cmd string, args ...string) {
+	c.RequestWriter.WriteCmdString(cmd, args...)
+	atomic.AddInt64(&c.pending, 1)
+}
+
+// WriteMultiBulkSize implements Conn interface.
+func (c *conn) WriteMultiBulkSize(n int) error {
+	if err := c.RequestWriter.WriteMultiBulkSize(n); err != nil {
+		return err
+	}
+	atomic.AddInt64(&c.pending, 1)
+	return nil
+}
+
+// ReadNil implements Conn interface.
+func (c *conn) ReadNil() error {
+	err := c.ResponseReader.ReadNil()
+	return c.replied(err)
+}
+
+// ReadBulkString implements Conn interface.
+func (c *conn) ReadBulkString() (string, error) {
+	s, err := c.ResponseReader.ReadBulkString()
+	return s, c.replied(err)
+}
+
+// ReadBulk implements Conn interface.
+func (c *conn) ReadBulk(p []byte) ([]byte, error) {
+	p, err := c.ResponseReader.ReadBulk(p)
+	return p, c.replied(err)
+}
+
+// StreamBulk implements Conn interface.
+func (c *conn) StreamBulk() (io.ReadCloser, error) {
+	rc, err := c.ResponseReader.StreamBulk()
+	return rc, c.replied(err)
+}
+
+// ReadInt implements Conn interface.
+func (c *conn) ReadInt() (int64, error) {
+	n, err := c.ResponseReader.ReadInt()
+	return n, c.replied(err)
+}
+
+// ReadError implements Conn interface.
+func (c *conn) ReadError() (string, error) {
+	s, err := c.ResponseReader.ReadError()
+	return s, c.replied(err)
+}
+
+// ReadInlineString implements Conn interface.
+func (c *conn) ReadInlineString() (string, error) {
+	s, err := c.ResponseReader.ReadInlineString()
+	return s, c.replied(err)
+}
+
+// ReadArrayLen implements Conn interface.
+func (c *conn) ReadArrayLen() (int, error) {
+	n, err := c.ResponseReader.ReadArrayLen()
+	if err != nil {
+		return n, err
+	}
+	if n > 0 {
+		c.nested = append(c.nested, n)
+		return n, nil
+	}
+	return n, c.replied(nil)
+}
+
+// ReadMapLen implements resp.MapReader interface.
+func (c *conn) ReadMapLen() (int, error) {
+	n, err := c.ResponseReader.(resp.MapReader).ReadMapLen()
+	if err != nil {
+		return n, err
+	}
+	if n > 0 {
+		c.nested = append(c.nested, 2*n)
+		return n, nil
+	}
+	return n, c.replied(nil)
+}
+
+// Scan implements Conn interface.
+func (c *conn) Scan(vv ...interface{}) error {
+	for _, v := range vv {
+		t, err := c.ResponseReader.PeekType()
+		if err != nil {
+			return err
+		}
+
+		// server errors are consumed before they are returned
+		if err := c.ResponseReader.Scan(v); err != nil {
+			if t == resp.TypeError {
+				_ = c.replied(nil)
+			}
+			return err
+		}
+		_ = c.replied(nil)
+	}
+	return nil
+}
+
+// replied registers a complete value, unless err is non-nil. Values complete
+// the innermost partially read array or, at the top level, a reply.
+func (c *conn) replied(err error) error {
+	if err != nil {
+		return err
+	}
+
+	for n := len(c.nested); n != 0; n = len(c.nested) {
+		if c.nested[n-1]--; c.nested[n-1] != 0 {
+			return nil
+		}
+		c.nested = c.nested[:n-1]
+	}
+
+	// out-of-band messages, i.e. pub/sub, arrive without a command
+	for {
+		n := atomic.LoadInt64(&c.pending)
+		if n == 0 || atomic.CompareAndSwapInt64(&c.pending, n, n-1) {
+			return nil
+		}
+	}
+}
+
+// resetReplies forgets about pending replies.
+func (c *conn) resetReplies() {
+	atomic.StoreInt64(&c.pending, 0)
+	c.nested = c.nested[:0]
+}
+
+// bind applies the context deadline to the connection and interrupts pending
+// I/O when the context is cancelled. Interrupted connections are marked as
+// failed.
+func (c *conn) bind(ctx context.Context) error {
+	if dl, ok := ctx.Deadline(); ok {
+		if err := c.Conn.SetDeadline(dl); err != nil {
+			return err
+		}
+		c.deadline = true
+	}
+
+	cancel := ctx.Done()
+	if cancel == nil {
+		return nil
+	}
+
+	c.stop = make(chan struct{})
+	c.done = make(chan struct{})
+	go func() {
+		defer close(c.done)
+
+		select {
+		case <-cancel:
+			c.MarkFailed()
+			_ = c.Conn.SetDeadline(aLongTimeAgo)
+		case <-c.stop:
+		}
+	}()
+	return nil
+}
+
+// unbind releases the context, bound via bind.
+func (c *conn) unbind() {
+	if c.stop != nil {
+		close(c.stop)
+		<-c.done
+		c.stop, c.done = nil, nil
+	}
+	if c.deadline {
+		_ = c.Conn.SetDeadline(time.Time{})
+		c.deadline = false
+	}
+}
+
+var aLongTimeAgo = time.Unix(1, 0)
 
 func (c *conn) madeByRedeo() {}
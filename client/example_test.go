@@ -1,7 +1,9 @@
 package client_test
 
 import (
+	"context"
 	"fmt"
+	"time"
 
 	"github.com/bsm/pool"
 	"github.com/bsm/redeo/v2/client"
@@ -62,3 +64,56 @@ func ExamplePool() {
 	// OK
 	// 1
 }
+
+func ExampleClient() {
+	client, _ := client.NewClient(&client.Options{
+		Options: pool.Options{InitialSize: 1},
+	}, nil)
+	defer client.Close()
+
+	// Execute a single command
+	rep, err := client.Do(context.Background(), "ECHO", "HEllO")
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(rep.String())
+}
+
+func ExamplePipeline() {
+	client, _ := client.NewClient(&client.Options{
+		Options: pool.Options{InitialSize: 1},
+	}, nil)
+	defer client.Close()
+
+	// Build pipeline
+	pipe := client.Pipeline()
+	pipe.Do("SET", "key", "value")
+	pipe.Do("GET", "key")
+	pipe.Do("DEL", "key")
+
+	// Execute pipeline
+	replies, err := pipe.Exec(context.Background())
+	if err != nil {
+		panic(err)
+	}
+	for _, rep := range replies {
+		fmt.Println(rep.Interface())
+	}
+}
+
+func ExamplePubSub() {
+	sub := client.NewPubSub(&client.PubSubOptions{
+		PingInterval: 10 * time.Second,
+	})
+	defer sub.Close()
+
+	// Subscribe to channels
+	if err := sub.Subscribe(context.Background(), "news", "alerts"); err != nil {
+		panic(err)
+	}
+
+	// Consume messages
+	for msg := range sub.Channel() {
+		fmt.Println(msg.Channel, msg.Payload)
+	}
+}
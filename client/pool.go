@@ -3,51 +3,182 @@
 package client
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"net"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/bsm/pool"
 	"github.com/bsm/redeo/v2/resp"
 )
 
+// Options contains pool options.
+type Options struct {
+	pool.Options
+
+	// DrainDirty attempts to drain dirty connections on Put, instead of
+	// discarding them. Connections are dirty if they have unread or unflushed
+	// bytes, or if replies to sent commands have not been read. Unflushed
+	// commands are dropped, pending replies are consumed until the server has
+	// caught up.
+	// Default: false (discard dirty connections)
+	DrainDirty bool
+
+	// DrainTimeout limits the time spent draining a dirty connection.
+	// Default: 1s
+	DrainTimeout time.Duration
+
+	// PingOnBorrow sends a PING to verify the health of a connection before
+	// it is returned by Get. Unhealthy connections are discarded.
+	// Default: false
+	PingOnBorrow bool
+
+	// ReadBufferSize sets the initial size of per-connection read buffers.
+	// Default: 64KB
+	ReadBufferSize int
+
+	// WriteBufferSize sets the initial size of per-connection write buffers.
+	// Default: 64KB
+	WriteBufferSize int
+}
+
+func (o *Options) norm() *Options {
+	var oo Options
+	if o != nil {
+		oo = *o
+	}
+	if oo.DrainTimeout <= 0 {
+		oo.DrainTimeout = time.Second
+	}
+	if oo.ReadBufferSize <= 0 {
+		oo.ReadBufferSize = resp.MaxBufferSize
+	}
+	if oo.WriteBufferSize <= 0 {
+		oo.WriteBufferSize = resp.MaxBufferSize
+	}
+	return &oo
+}
+
+// PoolStats contains pool statistics.
+type PoolStats struct {
+	// Idle is the number of idle connections.
+	Idle int
+	// DiscardedDirty is the number of connections discarded because
+	// they had unread or unflushed bytes or pending replies.
+	DiscardedDirty int64
+	// Drained is the number of dirty connections that were successfully
+	// drained and returned to the pool.
+	Drained int64
+	// FailedHealthChecks is the number of connections discarded
+	// because of failed health checks.
+	FailedHealthChecks int64
+}
+
 // Pool is a minimalist redis client connection pool
 type Pool struct {
 	conns   *pool.Pool
+	gen     int64
+	cmu     sync.RWMutex
+	dialer  func() (net.Conn, error)
+	opt     *Options
 	readers sync.Pool
 	writers sync.Pool
+
+	onClose func()
+	closed  bool
+
+	discardedDirty     int64
+	drained            int64
+	failedHealthChecks int64
 }
 
 // New initializes a new pool with a custom dialer
 func New(opt *pool.Options, dialer func() (net.Conn, error)) (*Pool, error) {
+	var oo *Options
+	if opt != nil {
+		oo = &Options{Options: *opt}
+	}
+	return NewPool(oo, dialer)
+}
+
+// NewPool initializes a new pool with extended options and a custom dialer.
+func NewPool(opt *Options, dialer func() (net.Conn, error)) (*Pool, error) {
 	if dialer == nil {
 		dialer = func() (net.Conn, error) {
 			return net.Dial("tcp", "127.0.0.1:6379")
 		}
 	}
 
-	conns, err := pool.New(opt, dialer)
+	opt = opt.norm()
+	conns, err := pool.New(&opt.Options, dialer)
 	if err != nil {
 		return nil, err
 	}
 
 	return &Pool{
-		conns: conns,
+		conns:  conns,
+		dialer: dialer,
+		opt:    opt,
 	}, nil
 }
 
 // Get returns a connection
 func (p *Pool) Get() (Conn, error) {
-	cn, err := p.conns.Get()
-	if err != nil {
+	return p.GetContext(context.Background())
+}
+
+// GetContext returns a connection, bound to the context. The context deadline
+// is applied to the socket and pending reads/writes are interrupted if the
+// context is cancelled before the connection is returned via Put.
+// Interrupted connections are marked as failed and will not be reused.
+func (p *Pool) GetContext(ctx context.Context) (Conn, error) {
+	if err := ctx.Err(); err != nil {
 		return nil, err
 	}
 
-	return &conn{
-		Conn: cn,
+	for attempts := p.Len(); ; attempts-- {
+		p.cmu.RLock()
+		gen := p.gen
+		cn, err := p.conns.Get()
+		p.cmu.RUnlock()
+		if err != nil {
+			return nil, err
+		}
 
-		RequestWriter:  p.newRequestWriter(cn),
-		ResponseReader: p.newResponseReader(cn),
-	}, nil
+		cs := &conn{
+			Conn: cn,
+			gen:  gen,
+
+			RequestWriter:  p.newRequestWriter(cn),
+			ResponseReader: p.newResponseReader(cn),
+		}
+		if err := cs.bind(ctx); err != nil {
+			_ = cs.Close()
+			return nil, err
+		}
+
+		if !p.opt.PingOnBorrow {
+			return cs, nil
+		}
+
+		err = ping(cs)
+		if err == nil {
+			return cs, nil
+		}
+
+		atomic.AddInt64(&p.failedHealthChecks, 1)
+		cs.unbind()
+		_ = cs.Close()
+
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		} else if attempts < 1 {
+			return nil, err
+		}
+	}
 }
 
 // Put allows to return a connection back to the pool.
@@ -58,28 +189,106 @@ func (p *Pool) Put(cn Conn) {
 	cs, ok := cn.(*conn)
 	if !ok {
 		return
-	} else if cs.failed {
+	}
+
+	cs.unbind()
+	if cs.isFailed() {
 		_ = cs.Close()
 		return
 	}
 
+	if cs.isDirty() {
+		if !p.opt.DrainDirty || drain(cs, p.opt.DrainTimeout) != nil {
+			atomic.AddInt64(&p.discardedDirty, 1)
+			_ = cs.Close()
+			return
+		}
+		atomic.AddInt64(&p.drained, 1)
+	}
+
 	p.writers.Put(cs.RequestWriter)
 	p.readers.Put(cs.ResponseReader)
+
+	p.cmu.RLock()
+	defer p.cmu.RUnlock()
+
+	if cs.gen != p.gen {
+		_ = cs.Conn.Close()
+		return
+	}
 	p.conns.Put(cs.Conn)
 }
 
+// Len returns the number of idle connections in the pool.
+func (p *Pool) Len() int {
+	p.cmu.RLock()
+	defer p.cmu.RUnlock()
+
+	return p.conns.Len()
+}
+
+// Stats returns pool statistics.
+func (p *Pool) Stats() PoolStats {
+	return PoolStats{
+		Idle:               p.Len(),
+		DiscardedDirty:     atomic.LoadInt64(&p.discardedDirty),
+		Drained:            atomic.LoadInt64(&p.drained),
+		FailedHealthChecks: atomic.LoadInt64(&p.failedHealthChecks),
+	}
+}
+
 // Close closes the client and all underlying connections
 func (p *Pool) Close() error {
+	if p.onClose != nil {
+		p.onClose()
+	}
+
+	p.cmu.Lock()
+	defer p.cmu.Unlock()
+
+	p.closed = true
 	return p.conns.Close()
 }
 
+// rebuild replaces all idle connections with a fresh set. Connections which
+// are currently in use will be closed when returned via Put. Idle connections
+// are discarded even if the fresh set cannot be established.
+func (p *Pool) rebuild() error {
+	conns, err := pool.New(&p.opt.Options, p.dialer)
+	if err != nil {
+		// fall back on an empty pool, which dials on demand
+		opt := p.opt.Options
+		opt.InitialSize = 0
+		if conns, err2 := pool.New(&opt, p.dialer); err2 == nil {
+			_ = p.swap(conns)
+		}
+		return err
+	}
+	return p.swap(conns)
+}
+
+// swap replaces the underlying pool and closes the old one.
+func (p *Pool) swap(conns *pool.Pool) error {
+	p.cmu.Lock()
+	if p.closed {
+		p.cmu.Unlock()
+		return conns.Close()
+	}
+	old := p.conns
+	p.conns = conns
+	p.gen++
+	p.cmu.Unlock()
+
+	return old.Close()
+}
+
 func (p *Pool) newRequestWriter(cn net.Conn) *resp.RequestWriter {
 	if v := p.writers.Get(); v != nil {
 		w := v.(*resp.RequestWriter)
 		w.Reset(cn)
 		return w
 	}
-	return resp.NewRequestWriter(cn)
+	return resp.NewRequestWriterSize(cn, p.opt.WriteBufferSize)
 }
 
 func (p *Pool) newResponseReader(cn net.Conn) resp.ResponseReader {
@@ -88,5 +297,54 @@ func (p *Pool) newResponseReader(cn net.Conn) resp.ResponseReader {
 		r.Reset(cn)
 		return r
 	}
-	return resp.NewResponseReader(cn)
+	return resp.NewResponseReaderSize(cn, p.opt.ReadBufferSize)
+}
+
+// --------------------------------------------------------------------
+
+func ping(cn *conn) error {
+	cn.WriteCmdString("PING")
+	if err := cn.Flush(); err != nil {
+		return err
+	}
+
+	s, err := cn.ReadInlineString()
+	if err != nil {
+		return err
+	} else if s != "PONG" {
+		return errUnexpectedReply
+	}
+	return nil
+}
+
+// drain drops unflushed commands and consumes pending replies until an
+// ECHO with a unique token is returned by the server.
+func drain(cn *conn, timeout time.Duration) error {
+	if err := cn.Conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return err
+	}
+
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return err
+	}
+	mark := hex.EncodeToString(token)
+
+	cn.RequestWriter.Reset(cn.Conn)
+	cn.WriteCmdString("ECHO", mark)
+	if err := cn.Flush(); err != nil {
+		return err
+	}
+
+	for {
+		rep, err := ReadReply(cn)
+		if err != nil {
+			return err
+		}
+		if rep.Type == resp.TypeBulk && rep.str == mark {
+			break
+		}
+	}
+	cn.resetReplies()
+	return cn.Conn.SetDeadline(time.Time{})
 }
@@ -0,0 +1,405 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+var errPubSubClosed = errors.New("client: pubsub is closed")
+
+// PubSubOptions contains options for subscriber connections.
+type PubSubOptions struct {
+	// Dialer is used to establish (and re-establish) the connection.
+	// Default: TCP connection to 127.0.0.1:6379
+	Dialer func() (net.Conn, error)
+
+	// OnMessage is an optional callback. If set, messages are passed
+	// to the callback instead of being delivered on the Channel.
+	// Callbacks are invoked sequentially from the receive loop.
+	OnMessage func(*Message)
+
+	// ChannelSize is the size of the message channel buffer.
+	// Default: 100
+	ChannelSize int
+
+	// PingInterval is the interval at which PING commands are
+	// sent to the server. The connection is considered broken if
+	// nothing is received for two consecutive intervals.
+	// Default: 30s
+	PingInterval time.Duration
+
+	// MinReconnectBackoff is the initial delay before reconnecting.
+	// Default: 100ms
+	MinReconnectBackoff time.Duration
+
+	// MaxReconnectBackoff is the maximum delay before reconnecting.
+	// Default: 5s
+	MaxReconnectBackoff time.Duration
+}
+
+func (o *PubSubOptions) norm() PubSubOptions {
+	var oo PubSubOptions
+	if o != nil {
+		oo = *o
+	}
+	if oo.Dialer == nil {
+		oo.Dialer = func() (net.Conn, error) {
+			return net.Dial("tcp", "127.0.0.1:6379")
+		}
+	}
+	if oo.ChannelSize <= 0 {
+		oo.ChannelSize = 100
+	}
+	if oo.PingInterval <= 0 {
+		oo.PingInterval = 30 * time.Second
+	}
+	if oo.MinReconnectBackoff <= 0 {
+		oo.MinReconnectBackoff = 100 * time.Millisecond
+	}
+	if oo.MaxReconnectBackoff < oo.MinReconnectBackoff {
+		oo.MaxReconnectBackoff = 5 * time.Second
+		if oo.MaxReconnectBackoff < oo.MinReconnectBackoff {
+			oo.MaxReconnectBackoff = oo.MinReconnectBackoff
+		}
+	}
+	return oo
+}
+
+// Message is a message received from a subscribed channel.
+type Message struct {
+	// Channel is the name of the channel.
+	Channel string
+	// Pattern is the matching pattern, for messages
+	// received via PSubscribe.
+	Pattern string
+	// Payload is the message payload.
+	Payload string
+}
+
+// PubSub is a subscriber, holding a dedicated connection. Subscriptions are
+// retained and automatically re-applied when the connection is
+// re-established after failures.
+type PubSub struct {
+	opt  PubSubOptions
+	msgs chan *Message
+
+	cn       *conn
+	channels map[string]struct{}
+	patterns map[string]struct{}
+	mu       sync.Mutex
+
+	closing   chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewPubSub inits a new subscriber. The connection is established
+// in the background.
+func NewPubSub(opt *PubSubOptions) *PubSub {
+	p := &PubSub{
+		opt:      opt.norm(),
+		channels: make(map[string]struct{}),
+		patterns: make(map[string]struct{}),
+		closing:  make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	if p.opt.OnMessage == nil {
+		p.msgs = make(chan *Message, p.opt.ChannelSize)
+	}
+
+	go p.run()
+	return p
+}
+
+// Channel returns the message channel. It returns nil if an OnMessage
+// callback is configured. The channel is closed when the subscriber is
+// closed. Please note that the subscriber stops receiving until the
+// channel is drained, once the channel buffer is full.
+func (p *PubSub) Channel() <-chan *Message { return p.msgs }
+
+// Subscribe subscribes to channels. The subscriptions are retained and
+// re-applied on reconnect, even if an error is returned.
+func (p *PubSub) Subscribe(ctx context.Context, channels ...string) error {
+	return p.update(ctx, "SUBSCRIBE", channels)
+}
+
+// PSubscribe subscribes to channel patterns. The subscriptions are retained
+// and re-applied on reconnect, even if an error is returned.
+func (p *PubSub) PSubscribe(ctx context.Context, patterns ...string) error {
+	return p.update(ctx, "PSUBSCRIBE", patterns)
+}
+
+// Unsubscribe unsubscribes from channels, or from all channels if
+// none are given.
+func (p *PubSub) Unsubscribe(ctx context.Context, channels ...string) error {
+	return p.update(ctx, "UNSUBSCRIBE", channels)
+}
+
+// PUnsubscribe unsubscribes from channel patterns, or from all patterns
+// if none are given.
+func (p *PubSub) PUnsubscribe(ctx context.Context, patterns ...string) error {
+	return p.update(ctx, "PUNSUBSCRIBE", patterns)
+}
+
+// Close closes the subscriber and the underlying connection.
+func (p *PubSub) Close() error {
+	p.closeOnce.Do(func() {
+		close(p.closing)
+
+		p.mu.Lock()
+		if p.cn != nil {
+			_ = p.cn.Close()
+		}
+		p.mu.Unlock()
+	})
+	<-p.done
+	return nil
+}
+
+func (p *PubSub) isClosing() bool {
+	select {
+	case <-p.closing:
+		return true
+	default:
+		return false
+	}
+}
+
+func (p *PubSub) update(ctx context.Context, cmd string, names []string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.isClosing() {
+		return errPubSubClosed
+	}
+
+	switch cmd {
+	case "SUBSCRIBE":
+		addNames(p.channels, names)
+	case "PSUBSCRIBE":
+		addNames(p.patterns, names)
+	case "UNSUBSCRIBE":
+		removeNames(p.channels, names)
+	case "PUNSUBSCRIBE":
+		removeNames(p.patterns, names)
+	}
+
+	// the subscriptions are applied on (re-)connect
+	if p.cn == nil {
+		return nil
+	}
+
+	if dl, ok := ctx.Deadline(); ok {
+		if err := p.cn.SetWriteDeadline(dl); err != nil {
+			return err
+		}
+		defer p.cn.SetWriteDeadline(time.Time{})
+	}
+
+	p.cn.WriteCmdString(cmd, names...)
+	if err := p.cn.Flush(); err != nil {
+		_ = p.cn.Close()
+		return contextError(ctx, err)
+	}
+	return nil
+}
+
+func (p *PubSub) run() {
+	defer close(p.done)
+	if p.msgs != nil {
+		defer close(p.msgs)
+	}
+
+	var backoff time.Duration
+	for {
+		cn, err := p.connect()
+		if err == errPubSubClosed {
+			return
+		} else if err != nil {
+			if backoff *= 2; backoff < p.opt.MinReconnectBackoff {
+				backoff = p.opt.MinReconnectBackoff
+			} else if backoff > p.opt.MaxReconnectBackoff {
+				backoff = p.opt.MaxReconnectBackoff
+			}
+
+			select {
+			case <-p.closing:
+				return
+			case <-time.After(backoff):
+			}
+			continue
+		}
+		backoff = 0
+
+		stop := make(chan struct{})
+		pinged := make(chan struct{})
+		go func() {
+			defer close(pinged)
+			p.ping(cn, stop)
+		}()
+
+		p.receive(cn)
+		close(stop)
+		<-pinged
+
+		p.mu.Lock()
+		p.cn = nil
+		p.mu.Unlock()
+		_ = cn.Close()
+
+		if p.isClosing() {
+			return
+		}
+	}
+}
+
+// connect establishes a connection and re-applies subscriptions.
+func (p *PubSub) connect() (*conn, error) {
+	nc, err := p.opt.Dialer()
+	if err != nil {
+		return nil, err
+	}
+	cn := Wrap(nc).(*conn)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.isClosing() {
+		_ = cn.Close()
+		return nil, errPubSubClosed
+	}
+
+	if len(p.channels) != 0 {
+		cn.WriteCmdString("SUBSCRIBE", mapKeys(p.channels)...)
+	}
+	if len(p.patterns) != 0 {
+		cn.WriteCmdString("PSUBSCRIBE", mapKeys(p.patterns)...)
+	}
+	if err := cn.Flush(); err != nil {
+		_ = cn.Close()
+		return nil, err
+	}
+
+	p.cn = cn
+	return cn, nil
+}
+
+// ping sends periodic PINGs until stopped.
+func (p *PubSub) ping(cn *conn, stop <-chan struct{}) {
+	ticker := time.NewTicker(p.opt.PingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		p.mu.Lock()
+		cn.WriteCmdString("PING")
+		err := cn.Flush()
+		p.mu.Unlock()
+
+		if err != nil {
+			_ = cn.Close()
+			return
+		}
+	}
+}
+
+// receive reads replies until the connection fails.
+func (p *PubSub) receive(cn *conn) {
+	for {
+		if err := cn.SetReadDeadline(time.Now().Add(2 * p.opt.PingInterval)); err != nil {
+			return
+		}
+
+		rep, err := ReadReply(cn)
+		if err != nil {
+			return
+		}
+
+		if msg := parseMessage(rep); msg != nil && !p.deliver(msg) {
+			return
+		}
+	}
+}
+
+func (p *PubSub) deliver(msg *Message) bool {
+	if p.opt.OnMessage != nil {
+		p.opt.OnMessage(msg)
+		return true
+	}
+
+	select {
+	case p.msgs <- msg:
+		return true
+	case <-p.closing:
+		return false
+	}
+}
+
+// --------------------------------------------------------------------
+
+// parseMessage extracts messages from replies. Subscription
+// confirmations, PONGs and errors are ignored.
+func parseMessage(rep Reply) *Message {
+	arr, err := rep.Array()
+	if err != nil || len(arr) < 3 {
+		return nil
+	}
+
+	kind, _ := arr[0].String()
+	switch strings.ToLower(kind) {
+	case "message":
+		msg := new(Message)
+		msg.Channel, _ = arr[1].String()
+		msg.Payload, _ = arr[2].String()
+		return msg
+	case "pmessage":
+		if len(arr) < 4 {
+			return nil
+		}
+		msg := new(Message)
+		msg.Pattern, _ = arr[1].String()
+		msg.Channel, _ = arr[2].String()
+		msg.Payload, _ = arr[3].String()
+		return msg
+	}
+	return nil
+}
+
+func addNames(set map[string]struct{}, names []string) {
+	for _, name := range names {
+		set[name] = struct{}{}
+	}
+}
+
+func removeNames(set map[string]struct{}, names []string) {
+	if len(names) == 0 {
+		for name := range set {
+			delete(set, name)
+		}
+		return
+	}
+	for _, name := range names {
+		delete(set, name)
+	}
+}
+
+func mapKeys(set map[string]struct{}) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	return keys
+}
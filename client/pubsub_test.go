@@ -0,0 +1,155 @@
+package client_test
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	. "github.com/bsm/ginkgo/v2"
+	. "github.com/bsm/gomega"
+	"github.com/bsm/redeo/v2/client"
+)
+
+var _ = Describe("PubSub", func() {
+	var subject *client.PubSub
+	var opt *client.PubSubOptions
+	var dials int32
+	var last net.Conn
+	var mu sync.Mutex
+
+	var lastConn = func() net.Conn {
+		mu.Lock()
+		defer mu.Unlock()
+		return last
+	}
+
+	var publish = func(name, msg string) func() int64 {
+		return func() int64 { return testServer.broker.PublishMessage(name, msg) }
+	}
+
+	BeforeEach(func() {
+		atomic.StoreInt32(&dials, 0)
+		opt = &client.PubSubOptions{
+			Dialer: func() (net.Conn, error) {
+				atomic.AddInt32(&dials, 1)
+				cn, err := testServer.Dial()
+				mu.Lock()
+				last = cn
+				mu.Unlock()
+				return cn, err
+			},
+			MinReconnectBackoff: 10 * time.Millisecond,
+		}
+	})
+
+	JustBeforeEach(func() {
+		subject = client.NewPubSub(opt)
+	})
+
+	AfterEach(func() {
+		Expect(subject.Close()).To(Succeed())
+	})
+
+	It("should subscribe and deliver messages", func() {
+		Expect(subject.Subscribe(ctx, "foo0", "bar0")).To(Succeed())
+		Eventually(publish("foo0", "x")).Should(Equal(int64(1)))
+		Eventually(subject.Channel()).Should(Receive(Equal(&client.Message{Channel: "foo0", Payload: "x"})))
+
+		Expect(publish("bar0", "y")()).To(Equal(int64(1)))
+		Eventually(subject.Channel()).Should(Receive(Equal(&client.Message{Channel: "bar0", Payload: "y"})))
+	})
+
+	It("should subscribe to patterns", func() {
+		Expect(subject.PSubscribe(ctx, "news.*")).To(Succeed())
+		Eventually(publish("news.tech", "x")).Should(Equal(int64(1)))
+		Eventually(subject.Channel()).Should(Receive(Equal(&client.Message{Channel: "news.tech", Pattern: "news.*", Payload: "x"})))
+		Expect(publish("sport.foot", "y")()).To(Equal(int64(0)))
+	})
+
+	It("should unsubscribe", func() {
+		Expect(subject.Subscribe(ctx, "foo2", "bar2")).To(Succeed())
+		Expect(subject.PSubscribe(ctx, "b*")).To(Succeed())
+		Eventually(publish("bar2", "x")).Should(Equal(int64(2)))
+
+		Expect(subject.Unsubscribe(ctx, "bar2")).To(Succeed())
+		Eventually(publish("bar2", "x")).Should(Equal(int64(1)))
+		Expect(subject.PUnsubscribe(ctx)).To(Succeed())
+		Eventually(publish("bar2", "x")).Should(Equal(int64(0)))
+		Expect(publish("foo2", "x")()).To(Equal(int64(1)))
+	})
+
+	It("should close the message channel", func() {
+		Expect(subject.Close()).To(Succeed())
+		Eventually(subject.Channel()).Should(BeClosed())
+		Expect(subject.Subscribe(ctx, "foo3")).To(MatchError("client: pubsub is closed"))
+	})
+
+	It("should reconnect and resubscribe", func() {
+		Expect(subject.Subscribe(ctx, "foo4")).To(Succeed())
+		Eventually(publish("foo4", "x")).Should(Equal(int64(1)))
+		Expect(lastConn().Close()).To(Succeed())
+
+		Eventually(func() int32 { return atomic.LoadInt32(&dials) }).Should(Equal(int32(2)))
+		Eventually(func() *client.Message {
+			publish("foo4", "y")()
+			select {
+			case msg := <-subject.Channel():
+				return msg
+			case <-time.After(10 * time.Millisecond):
+				return nil
+			}
+		}).Should(Equal(&client.Message{Channel: "foo4", Payload: "y"}))
+	})
+
+	Describe("with callback", func() {
+		var received chan *client.Message
+
+		BeforeEach(func() {
+			received = make(chan *client.Message, 10)
+			opt.OnMessage = func(msg *client.Message) { received <- msg }
+		})
+
+		It("should deliver messages via callback", func() {
+			Expect(subject.Channel()).To(BeNil())
+			Expect(subject.Subscribe(ctx, "foo5")).To(Succeed())
+			Eventually(publish("foo5", "x")).Should(Equal(int64(1)))
+			Eventually(received).Should(Receive(Equal(&client.Message{Channel: "foo5", Payload: "x"})))
+		})
+	})
+
+	Describe("with unresponsive server", func() {
+		var lis net.Listener
+
+		BeforeEach(func() {
+			var err error
+			lis, err = net.Listen("tcp", "127.0.0.1:0")
+			Expect(err).NotTo(HaveOccurred())
+
+			go func() {
+				for {
+					cn, err := lis.Accept()
+					if err != nil {
+						return
+					}
+					defer cn.Close()
+				}
+			}()
+
+			opt.PingInterval = 10 * time.Millisecond
+			opt.Dialer = func() (net.Conn, error) {
+				atomic.AddInt32(&dials, 1)
+				return net.Dial("tcp", lis.Addr().String())
+			}
+		})
+
+		AfterEach(func() {
+			Expect(lis.Close()).To(Succeed())
+		})
+
+		It("should reconnect when pings are not answered", func() {
+			Expect(subject.Subscribe(ctx, "foo6")).To(Succeed())
+			Eventually(func() int32 { return atomic.LoadInt32(&dials) }).Should(BeNumerically(">=", 3))
+		})
+	})
+})
@@ -0,0 +1,186 @@
+package client
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/bsm/redeo/v2/resp"
+)
+
+// ServerError is returned for error replies sent by the server.
+type ServerError string
+
+// Error implements the error interface.
+func (e ServerError) Error() string { return string(e) }
+
+// Reply is a generic server reply.
+type Reply struct {
+	// Type is the reply type.
+	Type resp.ResponseType
+
+	str   string
+	num   int64
+	array []Reply
+}
+
+// Err returns a ServerError if the reply is an error reply.
+func (r Reply) Err() error {
+	if r.Type == resp.TypeError {
+		return ServerError(r.str)
+	}
+	return nil
+}
+
+// IsNil returns true for nil replies.
+func (r Reply) IsNil() bool { return r.Type == resp.TypeNil }
+
+// String returns bulk, inline and integer replies as a string.
+func (r Reply) String() (string, error) {
+	switch r.Type {
+	case resp.TypeBulk, resp.TypeInline:
+		return r.str, nil
+	case resp.TypeInt:
+		return strconv.FormatInt(r.num, 10), nil
+	}
+	return "", r.typeErr("string")
+}
+
+// Bytes returns bulk and inline replies as bytes.
+func (r Reply) Bytes() ([]byte, error) {
+	switch r.Type {
+	case resp.TypeBulk, resp.TypeInline:
+		return []byte(r.str), nil
+	}
+	return nil, r.typeErr("bytes")
+}
+
+// Int returns integer replies, and parses numeric bulk and inline replies.
+func (r Reply) Int() (int64, error) {
+	switch r.Type {
+	case resp.TypeInt:
+		return r.num, nil
+	case resp.TypeBulk, resp.TypeInline:
+		return strconv.ParseInt(r.str, 10, 64)
+	}
+	return 0, r.typeErr("int")
+}
+
+// Float parses numeric replies as a float.
+func (r Reply) Float() (float64, error) {
+	switch r.Type {
+	case resp.TypeInt:
+		return float64(r.num), nil
+	case resp.TypeBulk, resp.TypeInline:
+		return strconv.ParseFloat(r.str, 64)
+	}
+	return 0, r.typeErr("float")
+}
+
+// Bool returns true for integer replies of 1 and "OK" status replies.
+func (r Reply) Bool() (bool, error) {
+	switch r.Type {
+	case resp.TypeInt:
+		return r.num == 1, nil
+	case resp.TypeInline:
+		return r.str == "OK", nil
+	case resp.TypeNil:
+		return false, nil
+	}
+	return false, r.typeErr("bool")
+}
+
+// Array returns the elements of array replies.
+func (r Reply) Array() ([]Reply, error) {
+	switch r.Type {
+	case resp.TypeArray:
+		return r.array, nil
+	case resp.TypeNil:
+		return nil, nil
+	}
+	return nil, r.typeErr("array")
+}
+
+// Strings returns array replies as a slice of strings.
+func (r Reply) Strings() ([]string, error) {
+	arr, err := r.Array()
+	if err != nil {
+		return nil, err
+	}
+
+	strs := make([]string, len(arr))
+	for i, elem := range arr {
+		if elem.IsNil() {
+			continue
+		}
+		if strs[i], err = elem.String(); err != nil {
+			return nil, err
+		}
+	}
+	return strs, nil
+}
+
+// Interface returns the reply as a native value, i.e. string, int64,
+// nil, ServerError or []interface{}.
+func (r Reply) Interface() interface{} {
+	switch r.Type {
+	case resp.TypeBulk, resp.TypeInline:
+		return r.str
+	case resp.TypeInt:
+		return r.num
+	case resp.TypeError:
+		return ServerError(r.str)
+	case resp.TypeArray:
+		vv := make([]interface{}, len(r.array))
+		for i, elem := range r.array {
+			vv[i] = elem.Interface()
+		}
+		return vv
+	}
+	return nil
+}
+
+func (r Reply) typeErr(target string) error {
+	if err := r.Err(); err != nil {
+		return err
+	}
+	return fmt.Errorf("client: cannot convert %s reply to %s", r.Type, target)
+}
+
+// --------------------------------------------------------------------
+
+// ReadReply reads a generic reply from the parser.
+func ReadReply(r resp.ResponseParser) (Reply, error) {
+	t, err := r.PeekType()
+	if err != nil {
+		return Reply{}, err
+	}
+
+	rep := Reply{Type: t}
+	switch t {
+	case resp.TypeBulk:
+		rep.str, err = r.ReadBulkString()
+	case resp.TypeInline:
+		rep.str, err = r.ReadInlineString()
+	case resp.TypeError:
+		rep.str, err = r.ReadError()
+	case resp.TypeInt:
+		rep.num, err = r.ReadInt()
+	case resp.TypeNil:
+		err = r.ReadNil()
+	case resp.TypeArray:
+		var n int
+		if n, err = r.ReadArrayLen(); err != nil {
+			break
+		}
+
+		rep.array = make([]Reply, n)
+		for i := 0; i < n; i++ {
+			if rep.array[i], err = ReadReply(r); err != nil {
+				break
+			}
+		}
+	default:
+		err = errBadReplyType
+	}
+	return rep, err
+}
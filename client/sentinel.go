@@ -0,0 +1,251 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+var errNoSentinels = errors.New("client: no sentinel addresses given")
+
+// SentinelOptions contains options for sentinel-aware pools.
+type SentinelOptions struct {
+	// MasterName is the name of the monitored master.
+	MasterName string
+
+	// Sentinels is a list of sentinel addresses.
+	Sentinels []string
+
+	// Dialer is used to connect to sentinels and masters.
+	// Default: TCP connection to addr
+	Dialer func(addr string) (net.Conn, error)
+
+	// Pool contains options for the master connection pool.
+	Pool Options
+
+	// Timeout limits the time spent querying each sentinel.
+	// Default: 1s
+	Timeout time.Duration
+
+	// PingInterval is the interval at which the sentinel
+	// subscription is checked.
+	// Default: 30s
+	PingInterval time.Duration
+}
+
+func (o *SentinelOptions) norm() SentinelOptions {
+	var oo SentinelOptions
+	if o != nil {
+		oo = *o
+	}
+	oo.Sentinels = append([]string(nil), oo.Sentinels...)
+	if oo.Timeout <= 0 {
+		oo.Timeout = time.Second
+	}
+	if oo.Dialer == nil {
+		timeout := oo.Timeout
+		oo.Dialer = func(addr string) (net.Conn, error) {
+			return net.DialTimeout("tcp", addr, timeout)
+		}
+	}
+	return oo
+}
+
+// NewSentinelPool inits a new pool of connections to the master, as
+// resolved via sentinels. The pool subscribes to +switch-master events and
+// rebuilds itself on failover. Connections which are in use during a
+// failover are closed once returned via Put. Idle connections to the old
+// master are dropped, even if the new master cannot be reached yet.
+func NewSentinelPool(opt *SentinelOptions) (*Pool, error) {
+	s := &sentinel{opt: opt.norm()}
+	if len(s.opt.Sentinels) == 0 {
+		return nil, errNoSentinels
+	}
+
+	addr, err := s.resolve()
+	if err != nil {
+		return nil, err
+	}
+	s.master = addr
+
+	poolOpt := s.opt.Pool
+	p, err := NewPool(&poolOpt, func() (net.Conn, error) {
+		return s.opt.Dialer(s.masterAddr())
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.pool = p
+
+	s.sub = NewPubSub(&PubSubOptions{
+		Dialer:       s.dialSentinel,
+		OnMessage:    s.onMessage,
+		PingInterval: s.opt.PingInterval,
+	})
+	p.onClose = func() { _ = s.sub.Close() }
+
+	if err := s.sub.Subscribe(context.Background(), "+switch-master"); err != nil {
+		_ = p.Close()
+		return nil, err
+	}
+	return p, nil
+}
+
+// NewSentinelClient inits a new client, backed by a sentinel-aware pool.
+func NewSentinelClient(opt *SentinelOptions) (*Client, error) {
+	p, err := NewSentinelPool(opt)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{pool: p}, nil
+}
+
+// --------------------------------------------------------------------
+
+type sentinel struct {
+	opt  SentinelOptions
+	pool *Pool
+	sub  *PubSub
+
+	master  string
+	epoch   int64 // incremented on every master switch
+	next    int   // next sentinel to dial for subscriptions
+	dialled bool
+	mu      sync.Mutex
+
+	rebuilding sync.Mutex // serializes pool rebuilds
+}
+
+func (s *sentinel) masterAddr() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.master
+}
+
+// resolve queries the sentinels for the current master address. Sentinels
+// which respond successfully are moved to the front of the list.
+func (s *sentinel) resolve() (string, error) {
+	s.mu.Lock()
+	sentinels := append([]string(nil), s.opt.Sentinels...)
+	s.mu.Unlock()
+
+	var err error
+	for i, addr := range sentinels {
+		var master string
+		if master, err = s.queryMaster(addr); err != nil {
+			continue
+		}
+
+		if i != 0 {
+			s.mu.Lock()
+			s.opt.Sentinels = append(append([]string{addr}, sentinels[:i]...), sentinels[i+1:]...)
+			s.mu.Unlock()
+		}
+		return master, nil
+	}
+	return "", err
+}
+
+func (s *sentinel) queryMaster(addr string) (string, error) {
+	nc, err := s.opt.Dialer(addr)
+	if err != nil {
+		return "", err
+	}
+	defer nc.Close()
+
+	if err := nc.SetDeadline(time.Now().Add(s.opt.Timeout)); err != nil {
+		return "", err
+	}
+
+	cn := Wrap(nc)
+	cn.WriteCmdString("SENTINEL", "get-master-addr-by-name", s.opt.MasterName)
+	if err := cn.Flush(); err != nil {
+		return "", err
+	}
+
+	rep, err := ReadReply(cn)
+	if err != nil {
+		return "", err
+	} else if rep.IsNil() {
+		return "", fmt.Errorf("client: sentinel %s does not know master %q", addr, s.opt.MasterName)
+	}
+
+	hostPort, err := rep.Strings()
+	if err != nil {
+		return "", err
+	} else if len(hostPort) != 2 {
+		return "", errUnexpectedReply
+	}
+	return net.JoinHostPort(hostPort[0], hostPort[1]), nil
+}
+
+// dialSentinel connects the subscription to the next sentinel. On
+// reconnect, the master is re-resolved to catch up with missed events.
+func (s *sentinel) dialSentinel() (net.Conn, error) {
+	s.mu.Lock()
+	addr := s.opt.Sentinels[s.next%len(s.opt.Sentinels)]
+	s.next++
+	reconnect := s.dialled
+	s.mu.Unlock()
+
+	cn, err := s.opt.Dialer(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	s.dialled = true
+	s.mu.Unlock()
+
+	if reconnect {
+		if master, err := s.resolve(); err == nil {
+			s.switchMaster(master)
+		}
+	}
+	return cn, nil
+}
+
+// onMessage handles +switch-master events, with payloads in the format of
+// "<master name> <old ip> <old port> <new ip> <new port>".
+func (s *sentinel) onMessage(msg *Message) {
+	parts := strings.Fields(msg.Payload)
+	if len(parts) != 5 || parts[0] != s.opt.MasterName {
+		return
+	}
+	s.switchMaster(net.JoinHostPort(parts[3], parts[4]))
+}
+
+func (s *sentinel) switchMaster(addr string) {
+	s.mu.Lock()
+	changed := s.master != addr
+	s.master = addr
+	s.epoch++
+	epoch := s.epoch
+	s.mu.Unlock()
+
+	// rebuild in the background, without blocking the subscription
+	if changed {
+		go s.rebuild(epoch)
+	}
+}
+
+// rebuild rebuilds the pool after a master switch. Rebuilds run one at a
+// time, so a slow rebuild can never replace the connections of a later one.
+// Rebuilds which have been superseded by another switch are skipped.
+func (s *sentinel) rebuild(epoch int64) {
+	s.rebuilding.Lock()
+	defer s.rebuilding.Unlock()
+
+	s.mu.Lock()
+	stale := s.epoch != epoch
+	s.mu.Unlock()
+
+	if !stale {
+		_ = s.pool.rebuild()
+	}
+}
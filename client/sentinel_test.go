@@ -0,0 +1,235 @@
+package client_test
+
+import (
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	. "github.com/bsm/ginkgo/v2"
+	. "github.com/bsm/gomega"
+	"github.com/bsm/pool"
+	"github.com/bsm/redeo/v2"
+	"github.com/bsm/redeo/v2/client"
+	"github.com/bsm/redeo/v2/resp"
+)
+
+var _ = Describe("Sentinel", func() {
+	var subject *client.Client
+	var sentinels []*fakeSentinel
+	var masters []*fakeMaster
+	var opt *client.SentinelOptions
+
+	BeforeEach(func() {
+		masters = []*fakeMaster{newFakeMaster("m1"), newFakeMaster("m2")}
+		sentinels = []*fakeSentinel{newFakeSentinel(masters[0]), newFakeSentinel(masters[0])}
+		opt = &client.SentinelOptions{
+			MasterName: "mymaster",
+			Sentinels:  []string{sentinels[0].Addr(), sentinels[1].Addr()},
+			Pool:       client.Options{Options: pool.Options{InitialSize: 1}},
+		}
+	})
+
+	JustBeforeEach(func() {
+		var err error
+		subject, err = client.NewSentinelClient(opt)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(subject.Close()).To(Succeed())
+		for _, s := range sentinels {
+			s.Close()
+		}
+		for _, m := range masters {
+			_ = m.lis.Close()
+		}
+	})
+
+	var whoami = func() string {
+		rep, err := subject.Do(ctx, "WHOAMI")
+		Expect(err).NotTo(HaveOccurred())
+		s, err := rep.String()
+		Expect(err).NotTo(HaveOccurred())
+		return s
+	}
+
+	It("should connect to the master", func() {
+		Expect(whoami()).To(Equal("m1"))
+		Expect(subject.Pool().Len()).To(Equal(1))
+	})
+
+	It("should rebuild the pool on failover", func() {
+		Expect(whoami()).To(Equal("m1"))
+		Eventually(sentinels[0].Subscribers).Should(Equal(int64(1)))
+
+		for _, s := range sentinels {
+			s.Failover(masters[1])
+		}
+		Eventually(whoami).Should(Equal("m2"))
+		Expect(subject.Pool().Len()).To(Equal(1))
+	})
+
+	It("should drop idle connections if the new master is unreachable", func() {
+		Expect(whoami()).To(Equal("m1"))
+		Expect(masters[0].Info().NumClients()).To(Equal(1))
+		Eventually(sentinels[0].Subscribers).Should(Equal(int64(1)))
+
+		Expect(masters[1].lis.Close()).To(Succeed())
+		for _, s := range sentinels {
+			s.Failover(masters[1])
+		}
+		Eventually(subject.Pool().Len).Should(Equal(0))
+		Eventually(masters[0].Info().NumClients).Should(Equal(0))
+
+		_, err := subject.Do(ctx, "WHOAMI")
+		Expect(err).To(HaveOccurred())
+	})
+
+	Describe("with slow masters", func() {
+		var release chan struct{}
+		var dials int32
+
+		BeforeEach(func() {
+			masters = append(masters, newFakeMaster("m3"))
+			release = make(chan struct{})
+			dials = 0
+
+			slow := masters[1].Addr()
+			opt.Dialer = func(addr string) (net.Conn, error) {
+				if addr == slow {
+					atomic.AddInt32(&dials, 1)
+					<-release
+				}
+				return net.Dial("tcp", addr)
+			}
+		})
+
+		It("should apply back to back failovers in order", func() {
+			Expect(whoami()).To(Equal("m1"))
+			Eventually(sentinels[0].Subscribers).Should(Equal(int64(1)))
+
+			sentinels[0].Failover(masters[1])
+			Eventually(func() int32 { return atomic.LoadInt32(&dials) }).Should(Equal(int32(1)))
+			sentinels[0].Failover(masters[2])
+			time.Sleep(20 * time.Millisecond)
+			close(release)
+
+			Eventually(whoami).Should(Equal("m3"))
+			Consistently(whoami, "100ms").Should(Equal("m3"))
+			Eventually(masters[1].Info().NumClients).Should(Equal(0))
+		})
+	})
+
+	It("should ignore other masters", func() {
+		Eventually(sentinels[0].Subscribers).Should(Equal(int64(1)))
+		sentinels[0].broker.PublishMessage("+switch-master", "other "+masters[0].Addr()+" "+masters[1].Addr())
+		Consistently(whoami, "50ms").Should(Equal("m1"))
+	})
+
+	Describe("with unavailable sentinels", func() {
+		BeforeEach(func() {
+			sentinels[0].Close()
+		})
+
+		It("should fall back on other sentinels", func() {
+			Expect(whoami()).To(Equal("m1"))
+			Eventually(sentinels[1].Subscribers).Should(Equal(int64(1)))
+
+			sentinels[1].Failover(masters[1])
+			Eventually(whoami).Should(Equal("m2"))
+		})
+	})
+
+	It("should fail on unknown masters", func() {
+		opt.MasterName = "unknown"
+		_, err := client.NewSentinelPool(opt)
+		Expect(err).To(MatchError(ContainSubstring(`does not know master "unknown"`)))
+	})
+})
+
+// --------------------------------------------------------------------
+
+type fakeMaster struct {
+	*redeo.Server
+	lis net.Listener
+}
+
+func newFakeMaster(name string) *fakeMaster {
+	m := &fakeMaster{Server: redeo.NewServer(nil)}
+	m.HandleFunc("whoami", func(w resp.ResponseWriter, _ *resp.Command) {
+		w.AppendBulkString(name)
+	})
+
+	var err error
+	m.lis, err = net.Listen("tcp", "127.0.0.1:0")
+	Expect(err).NotTo(HaveOccurred())
+	go func() { _ = m.Serve(m.lis) }()
+
+	return m
+}
+
+func (m *fakeMaster) Addr() string { return m.lis.Addr().String() }
+
+type fakeSentinel struct {
+	*redeo.Server
+	lis    net.Listener
+	broker *redeo.PubSubBroker
+	master *fakeMaster
+	mu     sync.Mutex
+}
+
+func newFakeSentinel(master *fakeMaster) *fakeSentinel {
+	s := &fakeSentinel{
+		Server: redeo.NewServer(nil),
+		broker: redeo.NewPubSubBroker(),
+		master: master,
+	}
+	s.Handle("subscribe", s.broker.Subscribe())
+	s.Handle("ping", redeo.Ping())
+	s.HandleFunc("sentinel", func(w resp.ResponseWriter, c *resp.Command) {
+		if !strings.EqualFold(c.Arg(0).String(), "get-master-addr-by-name") {
+			w.AppendError("ERR unknown subcommand")
+			return
+		}
+		if c.Arg(1).String() != "mymaster" {
+			w.AppendNil()
+			return
+		}
+
+		s.mu.Lock()
+		host, port, _ := net.SplitHostPort(s.master.Addr())
+		s.mu.Unlock()
+
+		w.AppendArrayLen(2)
+		w.AppendBulkString(host)
+		w.AppendBulkString(port)
+	})
+
+	var err error
+	s.lis, err = net.Listen("tcp", "127.0.0.1:0")
+	Expect(err).NotTo(HaveOccurred())
+	go func() { _ = s.Serve(s.lis) }()
+
+	return s
+}
+
+func (s *fakeSentinel) Addr() string { return s.lis.Addr().String() }
+func (s *fakeSentinel) Close()       { _ = s.lis.Close() }
+
+// Subscribers returns the number of +switch-master subscribers.
+func (s *fakeSentinel) Subscribers() int64 {
+	return s.broker.PublishMessage("+switch-master", "ping")
+}
+
+func (s *fakeSentinel) Failover(master *fakeMaster) {
+	s.mu.Lock()
+	old := s.master
+	s.master = master
+	s.mu.Unlock()
+
+	oldHost, oldPort, _ := net.SplitHostPort(old.Addr())
+	newHost, newPort, _ := net.SplitHostPort(master.Addr())
+	s.broker.PublishMessage("+switch-master", strings.Join([]string{"mymaster", oldHost, oldPort, newHost, newPort}, " "))
+}
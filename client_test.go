@@ -1,13 +1,60 @@
 package redeo
 
 import (
+	"strings"
+
 	. "github.com/bsm/ginkgo/v2"
 	. "github.com/bsm/gomega"
+	"github.com/bsm/redeo/v2/resp"
 )
 
 var _ = Describe("Client", func() {
 	It("should generate IDs", func() {
-		a, b := newClient(&mockConn{}), newClient(&mockConn{})
+		a, b := newClient(&mockConn{}, testBuffers, testBuffers), newClient(&mockConn{}, testBuffers, testBuffers)
 		Expect(b.ID() - 1).To(Equal(a.ID()))
 	})
+
+	It("should acquire buffers lazily", func() {
+		rbufs, wbufs := resp.NewBufferPool(1024), resp.NewBufferPool(2048)
+		cn := &mockConn{}
+		c := newClient(cn, rbufs, wbufs)
+		Expect(rbufs.InUse()).To(BeZero())
+		Expect(wbufs.InUse()).To(BeZero())
+
+		// small requests are served from the idle buffer
+		cn.WriteString("PING\r\n")
+		Expect(c.rd.PeekCmd()).To(Equal("PING"))
+		Expect(c.rd.SkipCmd()).To(Succeed())
+		Expect(rbufs.InUse()).To(BeZero())
+
+		// large requests acquire a buffer
+		cn.WriteString("ECHO " + strings.Repeat("x", 600) + "\r\n")
+		Expect(c.rd.PeekCmd()).To(Equal("ECHO"))
+		Expect(rbufs.InUse()).To(Equal(int64(1024)))
+
+		cmd, err := c.rd.ReadCmd(nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cmd.Arg(0)).To(HaveLen(600))
+
+		c.wr.AppendBulk(cmd.Arg(0))
+		Expect(wbufs.InUse()).To(Equal(int64(2048)))
+		Expect(c.wr.Flush()).To(Succeed())
+		Expect(wbufs.InUse()).To(BeZero())
+		cn.Reset()
+
+		// buffers are released once drained
+		_, err = c.rd.PeekCmd()
+		Expect(err).To(HaveOccurred())
+		Expect(rbufs.InUse()).To(BeZero())
+
+		cn.WriteString("ECHO " + strings.Repeat("x", 600))
+		_, _ = c.rd.PeekCmd()
+		c.wr.AppendOK()
+		Expect(rbufs.InUse()).To(Equal(int64(1024)))
+		Expect(wbufs.InUse()).To(Equal(int64(2048)))
+
+		c.release()
+		Expect(rbufs.InUse()).To(BeZero())
+		Expect(wbufs.InUse()).To(BeZero())
+	})
 })
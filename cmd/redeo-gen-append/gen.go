@@ -0,0 +1,572 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/token"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const annotation = "//redeo:append"
+
+type generator struct {
+	pkg     string
+	types   map[string]*ast.TypeSpec
+	methods map[string]map[string]bool // type name -> method names
+	marked  map[string]bool
+	order   []string
+	imports map[string]bool
+
+	vars   map[string]int  // variable name counters, per method
+	inline map[string]bool // struct types inlined by the current method
+}
+
+func newGenerator(pkg string) *generator {
+	return &generator{
+		pkg:     pkg,
+		types:   make(map[string]*ast.TypeSpec),
+		methods: make(map[string]map[string]bool),
+		marked:  make(map[string]bool),
+		imports: map[string]bool{"github.com/bsm/redeo/v2/resp": true},
+	}
+}
+
+// load indexes type and method declarations and marks the types to
+// generate methods for.
+func (g *generator) load(files []*ast.File, names []string) error {
+	for _, file := range files {
+		for _, decl := range file.Decls {
+			switch decl := decl.(type) {
+			case *ast.GenDecl:
+				if decl.Tok != token.TYPE {
+					continue
+				}
+				for _, spec := range decl.Specs {
+					ts := spec.(*ast.TypeSpec)
+					if ts.TypeParams != nil {
+						continue
+					}
+
+					name := ts.Name.Name
+					g.types[name] = ts
+
+					doc := ts.Doc
+					if doc == nil && !decl.Lparen.IsValid() {
+						doc = decl.Doc
+					}
+					if names == nil && isAnnotated(doc) {
+						g.mark(name)
+					}
+				}
+			case *ast.FuncDecl:
+				if decl.Recv == nil || len(decl.Recv.List) == 0 {
+					continue
+				}
+				if name := typeName(decl.Recv.List[0].Type); name != "" {
+					if g.methods[name] == nil {
+						g.methods[name] = make(map[string]bool)
+					}
+					g.methods[name][decl.Name.Name] = true
+				}
+			}
+		}
+	}
+
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if _, ok := g.types[name]; !ok {
+			return fmt.Errorf("type %s not found in package %s", name, g.pkg)
+		}
+		g.mark(name)
+	}
+	if len(g.order) == 0 {
+		return fmt.Errorf("no types to generate in package %s", g.pkg)
+	}
+	return nil
+}
+
+func (g *generator) mark(name string) {
+	if !g.marked[name] {
+		g.marked[name] = true
+		g.order = append(g.order, name)
+	}
+}
+
+// generate returns the formatted source.
+func (g *generator) generate() ([]byte, error) {
+	var body bytes.Buffer
+	for _, name := range g.order {
+		if err := g.method(&body, g.types[name]); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+	}
+
+	var std, ext []string
+	for path := range g.imports {
+		if strings.Contains(strings.SplitN(path, "/", 2)[0], ".") {
+			ext = append(ext, path)
+		} else {
+			std = append(std, path)
+		}
+	}
+	sort.Strings(std)
+	sort.Strings(ext)
+
+	var src bytes.Buffer
+	src.WriteString("// Code generated by redeo-gen-append. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&src, "package %s\n\nimport (\n", g.pkg)
+	for _, path := range std {
+		fmt.Fprintf(&src, "\t%q\n", path)
+	}
+	if len(std) != 0 {
+		src.WriteString("\n")
+	}
+	for _, path := range ext {
+		fmt.Fprintf(&src, "\t%q\n", path)
+	}
+	src.WriteString(")\n")
+	body.WriteTo(&src)
+
+	return format.Source(src.Bytes())
+}
+
+func (g *generator) method(b *bytes.Buffer, ts *ast.TypeSpec) error {
+	name := ts.Name.Name
+	g.vars = make(map[string]int)
+	g.inline = map[string]bool{name: true}
+
+	fmt.Fprintf(b, "\n// AppendTo implements resp.CustomResponse.\n")
+	if st, ok := ts.Type.(*ast.StructType); ok {
+		fmt.Fprintf(b, "func (r *%s) AppendTo(w resp.ResponseWriter) {\n", name)
+		if err := g.structValue(b, st, "r"); err != nil {
+			return err
+		}
+	} else {
+		fmt.Fprintf(b, "func (r %s) AppendTo(w resp.ResponseWriter) {\n", name)
+		if err := g.value(b, ts.Type, "r", fieldOpts{}, true); err != nil {
+			return err
+		}
+	}
+	b.WriteString("}\n")
+	return nil
+}
+
+// --------------------------------------------------------------------
+
+type fieldOpts struct {
+	omitEmpty bool
+	ms        bool
+	str       bool
+}
+
+type field struct {
+	name string
+	x    string
+	typ  ast.Expr
+	opts fieldOpts
+	cond string
+}
+
+// structFields collects the fields of a struct, following the same rules
+// as the reflective encoder.
+func (g *generator) structFields(st *ast.StructType, x string) ([]field, error) {
+	var fields []field
+	for _, f := range st.Fields.List {
+		var tag string
+		var hasTag bool
+		if f.Tag != nil {
+			s, err := strconv.Unquote(f.Tag.Value)
+			if err != nil {
+				return nil, err
+			}
+			tag, hasTag = reflect.StructTag(s).Lookup("resp")
+		}
+		if tag == "-" {
+			continue
+		}
+
+		names := make([]string, 0, len(f.Names))
+		for _, n := range f.Names {
+			names = append(names, n.Name)
+		}
+
+		if len(f.Names) == 0 {
+			name := typeName(f.Type)
+			if name == "" {
+				return nil, fmt.Errorf("unsupported embedded field %s", exprString(f.Type))
+			}
+
+			if _, isPtr := f.Type.(*ast.StarExpr); !hasTag && !isPtr {
+				if _, isSel := f.Type.(*ast.SelectorExpr); isSel {
+					return nil, fmt.Errorf("unable to flatten embedded field %s", exprString(f.Type))
+				}
+				if sub, ok := g.underlying(f.Type).(*ast.StructType); ok {
+					if g.inline[name] {
+						return nil, fmt.Errorf("recursive embedded field %s", name)
+					}
+					g.inline[name] = true
+					nested, err := g.structFields(sub, x+"."+name)
+					delete(g.inline, name)
+					if err != nil {
+						return nil, err
+					}
+					fields = append(fields, nested...)
+					continue
+				}
+			}
+			names = append(names, name)
+		}
+
+		parts := strings.Split(tag, ",")
+		var opts fieldOpts
+		for _, opt := range parts[1:] {
+			switch opt {
+			case "ms":
+				opts.ms = true
+			case "omitempty":
+				opts.omitEmpty = true
+			case "string":
+				opts.str = true
+			}
+		}
+
+		for _, name := range names {
+			if !ast.IsExported(name) {
+				continue
+			}
+
+			fd := field{name: parts[0], x: x + "." + name, typ: f.Type, opts: opts}
+			if fd.name == "" {
+				fd.name = name
+			}
+			fields = append(fields, fd)
+		}
+	}
+	return fields, nil
+}
+
+// structValue appends a struct as a flat field/value array.
+func (g *generator) structValue(b *bytes.Buffer, st *ast.StructType, x string) error {
+	fields, err := g.structFields(st, x)
+	if err != nil {
+		return err
+	}
+
+	static, dynamic := 0, 0
+	for i := range fields {
+		f := &fields[i]
+		if !f.opts.omitEmpty {
+			static++
+			continue
+		}
+		if f.cond, err = g.nonEmpty(f.typ, f.x); err != nil {
+			return fmt.Errorf("field %s: %w", f.name, err)
+		}
+		dynamic++
+	}
+
+	if dynamic == 0 {
+		fmt.Fprintf(b, "resp.AppendMapLen(w, %d)\n", static)
+	} else {
+		n := g.newVar("n")
+		fmt.Fprintf(b, "%s := %d\n", n, static)
+		for _, f := range fields {
+			if f.cond != "" {
+				fmt.Fprintf(b, "if %s {\n%s++\n}\n", f.cond, n)
+			}
+		}
+		fmt.Fprintf(b, "resp.AppendMapLen(w, %s)\n", n)
+	}
+
+	for _, f := range fields {
+		if f.cond != "" {
+			fmt.Fprintf(b, "if %s {\n", f.cond)
+		}
+		fmt.Fprintf(b, "w.AppendBulkString(%q)\n", f.name)
+		if err := g.value(b, f.typ, f.x, f.opts, false); err != nil {
+			return fmt.Errorf("field %s: %w", f.name, err)
+		}
+		if f.cond != "" {
+			b.WriteString("}\n")
+		}
+	}
+	return nil
+}
+
+// value appends the value of x, of type typ. The named flag indicates that
+// x is of a named type, with typ as the underlying type.
+func (g *generator) value(b *bytes.Buffer, typ ast.Expr, x string, opts fieldOpts, named bool) error {
+	switch t := typ.(type) {
+	case *ast.ParenExpr:
+		return g.value(b, t.X, x, opts, named)
+	case *ast.Ident:
+		if ts, ok := g.types[t.Name]; ok {
+			return g.namedValue(b, ts, x, opts)
+		}
+		return g.builtinValue(b, t.Name, x, named)
+	case *ast.SelectorExpr:
+		if opts.str {
+			fmt.Fprintf(b, "w.AppendBulkString(%s.String())\n", operand(x))
+			return nil
+		}
+
+		switch exprString(t) {
+		case "time.Time":
+			if opts.ms {
+				g.imports["time"] = true
+				fmt.Fprintf(b, "w.AppendInt(%s.UnixNano() / int64(time.Millisecond))\n", operand(x))
+			} else {
+				fmt.Fprintf(b, "resp.AppendTime(w, %s)\n", x)
+			}
+			return nil
+		case "time.Duration":
+			g.imports["time"] = true
+			unit := "time.Second"
+			if opts.ms {
+				unit = "time.Millisecond"
+			}
+			fmt.Fprintf(b, "w.AppendInt(int64(%s / %s))\n", x, unit)
+			return nil
+		}
+		g.fallback(b, x)
+		return nil
+	case *ast.StarExpr:
+		fmt.Fprintf(b, "if %s == nil {\nw.AppendNil()\n} else {\n", x)
+		if id, ok := t.X.(*ast.Ident); ok && g.hasMethod(id.Name, "AppendTo") {
+			fmt.Fprintf(b, "%s.AppendTo(w)\n", x)
+		} else if opts.str && g.isStringer(t.X) {
+			fmt.Fprintf(b, "w.AppendBulkString(%s.String())\n", x)
+		} else {
+			// struct fields are accessible via pointers
+			elem := "*" + x
+			if _, ok := g.underlying(t.X).(*ast.StructType); ok {
+				elem = x
+			}
+			if err := g.value(b, t.X, elem, fieldOpts{}, false); err != nil {
+				return err
+			}
+		}
+		b.WriteString("}\n")
+		return nil
+	case *ast.ArrayType:
+		if t.Len == nil && isByte(t.Elt) {
+			fmt.Fprintf(b, "w.AppendBulk(%s)\n", convert("[]byte", x, named))
+			return nil
+		}
+		i := g.newVar("i")
+		fmt.Fprintf(b, "w.AppendArrayLen(len(%s))\nfor %s := range %s {\n", x, i, x)
+		if err := g.value(b, t.Elt, operand(x)+"["+i+"]", fieldOpts{}, false); err != nil {
+			return err
+		}
+		b.WriteString("}\n")
+		return nil
+	case *ast.MapType:
+		k, v := g.newVar("k"), g.newVar("v")
+		fmt.Fprintf(b, "resp.AppendMapLen(w, len(%s))\nfor %s, %s := range %s {\n", x, k, v, x)
+		if err := g.value(b, t.Key, k, fieldOpts{}, false); err != nil {
+			return err
+		}
+		if err := g.value(b, t.Value, v, fieldOpts{}, false); err != nil {
+			return err
+		}
+		b.WriteString("}\n")
+		return nil
+	case *ast.StructType:
+		return g.structValue(b, t, x)
+	case *ast.InterfaceType:
+		g.fallback(b, x)
+		return nil
+	}
+	return fmt.Errorf("unsupported type %s", exprString(typ))
+}
+
+func (g *generator) namedValue(b *bytes.Buffer, ts *ast.TypeSpec, x string, opts fieldOpts) error {
+	name := ts.Name.Name
+	switch {
+	case opts.str && g.hasMethod(name, "String"):
+		fmt.Fprintf(b, "w.AppendBulkString(%s.String())\n", operand(x))
+		return nil
+	case g.hasMethod(name, "AppendTo"):
+		fmt.Fprintf(b, "%s.AppendTo(w)\n", operand(x))
+		return nil
+	case g.hasMethod(name, "Error"), g.hasMethod(name, "MarshalText"):
+		g.fallback(b, x)
+		return nil
+	}
+
+	if st, ok := ts.Type.(*ast.StructType); ok {
+		if g.inline[name] {
+			return fmt.Errorf("recursive type %s must be annotated", name)
+		}
+		g.inline[name] = true
+		defer delete(g.inline, name)
+
+		return g.structValue(b, st, x)
+	}
+	return g.value(b, ts.Type, x, opts, true)
+}
+
+func (g *generator) builtinValue(b *bytes.Buffer, name, x string, named bool) error {
+	switch name {
+	case "string":
+		fmt.Fprintf(b, "w.AppendBulkString(%s)\n", convert("string", x, named))
+	case "bool":
+		fmt.Fprintf(b, "if %s {\nw.AppendInt(1)\n} else {\nw.AppendInt(0)\n}\n", x)
+	case "int64":
+		fmt.Fprintf(b, "w.AppendInt(%s)\n", convert("int64", x, named))
+	case "int", "int8", "int16", "int32", "rune", "uint", "uint8", "uint16", "uint32", "uint64", "uintptr", "byte":
+		fmt.Fprintf(b, "w.AppendInt(int64(%s))\n", x)
+	case "float32":
+		fmt.Fprintf(b, "resp.AppendFloat(w, float64(%s), 32)\n", x)
+	case "float64":
+		fmt.Fprintf(b, "resp.AppendFloat(w, %s, 64)\n", convert("float64", x, named))
+	case "error", "any":
+		g.fallback(b, x)
+	default:
+		return fmt.Errorf("unsupported type %s", name)
+	}
+	return nil
+}
+
+// fallback delegates to the reflective encoder.
+func (g *generator) fallback(b *bytes.Buffer, x string) {
+	fmt.Fprintf(b, "if err := w.Append(%s); err != nil {\nw.AppendError(\"ERR \" + err.Error())\n}\n", x)
+}
+
+// nonEmpty returns a condition which is true if x is not empty.
+func (g *generator) nonEmpty(typ ast.Expr, x string) (string, error) {
+	switch t := typ.(type) {
+	case *ast.ParenExpr:
+		return g.nonEmpty(t.X, x)
+	case *ast.Ident:
+		if ts, ok := g.types[t.Name]; ok {
+			return g.nonEmpty(ts.Type, x)
+		}
+		switch t.Name {
+		case "string":
+			return "len(" + x + ") != 0", nil
+		case "bool":
+			return x, nil
+		case "error", "any":
+			return x + " != nil", nil
+		case "int", "int8", "int16", "int32", "int64", "rune",
+			"uint", "uint8", "uint16", "uint32", "uint64", "uintptr", "byte",
+			"float32", "float64":
+			return x + " != 0", nil
+		}
+	case *ast.SelectorExpr:
+		switch exprString(t) {
+		case "time.Time":
+			return "!" + x + ".IsZero()", nil
+		case "time.Duration":
+			return x + " != 0", nil
+		}
+	case *ast.StarExpr, *ast.InterfaceType, *ast.FuncType, *ast.ChanType:
+		return x + " != nil", nil
+	case *ast.ArrayType, *ast.MapType:
+		return "len(" + x + ") != 0", nil
+	}
+	return "", fmt.Errorf("omitempty is not supported for %s", exprString(typ))
+}
+
+// underlying resolves named types declared in the package.
+func (g *generator) underlying(typ ast.Expr) ast.Expr {
+	for i := 0; i < len(g.types); i++ {
+		id, ok := typ.(*ast.Ident)
+		if !ok {
+			break
+		}
+		ts, ok := g.types[id.Name]
+		if !ok {
+			break
+		}
+		typ = ts.Type
+	}
+	return typ
+}
+
+func (g *generator) hasMethod(typeName, method string) bool {
+	if method == "AppendTo" && g.marked[typeName] {
+		return true
+	}
+	return g.methods[typeName][method]
+}
+
+// isStringer reports whether typ may implement fmt.Stringer. Types from
+// other packages are assumed to.
+func (g *generator) isStringer(typ ast.Expr) bool {
+	switch t := typ.(type) {
+	case *ast.Ident:
+		return g.hasMethod(t.Name, "String")
+	case *ast.SelectorExpr:
+		return true
+	}
+	return false
+}
+
+func (g *generator) newVar(prefix string) string {
+	n := g.vars[prefix]
+	g.vars[prefix]++
+	if n == 0 {
+		return prefix
+	}
+	return prefix + strconv.Itoa(n)
+}
+
+// --------------------------------------------------------------------
+
+func isAnnotated(doc *ast.CommentGroup) bool {
+	if doc == nil {
+		return false
+	}
+	for _, c := range doc.List {
+		if strings.TrimSpace(c.Text) == annotation {
+			return true
+		}
+	}
+	return false
+}
+
+// typeName returns the name of a (pointer to a) named type.
+func typeName(typ ast.Expr) string {
+	switch t := typ.(type) {
+	case *ast.Ident:
+		return t.Name
+	case *ast.StarExpr:
+		return typeName(t.X)
+	case *ast.SelectorExpr:
+		return t.Sel.Name
+	}
+	return ""
+}
+
+func isByte(typ ast.Expr) bool {
+	id, ok := typ.(*ast.Ident)
+	return ok && (id.Name == "byte" || id.Name == "uint8")
+}
+
+func convert(typ, x string, named bool) string {
+	if !named {
+		return x
+	}
+	return typ + "(" + x + ")"
+}
+
+// operand wraps dereferenced expressions in parentheses.
+func operand(x string) string {
+	if strings.HasPrefix(x, "*") {
+		return "(" + x + ")"
+	}
+	return x
+}
+
+func exprString(typ ast.Expr) string {
+	var b bytes.Buffer
+	_ = format.Node(&b, token.NewFileSet(), typ)
+	return b.String()
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"flag"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/bsm/ginkgo/v2"
+	. "github.com/bsm/gomega"
+)
+
+var update = flag.Bool("update", false, "Update golden files")
+
+var _ = Describe("generator", func() {
+	generate := func(src string, types ...string) ([]byte, error) {
+		fset := token.NewFileSet()
+		file, err := parser.ParseFile(fset, "src.go", src, parser.ParseComments)
+		Expect(err).NotTo(HaveOccurred())
+
+		g := newGenerator(file.Name.Name)
+		if err := g.load(sortedFiles(&ast.Package{Files: map[string]*ast.File{"src.go": file}}), types); err != nil {
+			return nil, err
+		}
+		return g.generate()
+	}
+
+	DescribeTable("should match golden files",
+		func(name string) {
+			src, err := os.ReadFile(filepath.Join("testdata", name+".go"))
+			Expect(err).NotTo(HaveOccurred())
+
+			out, err := generate(string(src))
+			Expect(err).NotTo(HaveOccurred())
+
+			golden := filepath.Join("testdata", name+".golden")
+			if *update {
+				Expect(os.WriteFile(golden, out, 0o644)).To(Succeed())
+			}
+
+			exp, err := os.ReadFile(golden)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(out)).To(Equal(string(exp)))
+		},
+		Entry("users", "users"),
+	)
+
+	It("should select types by name", func() {
+		out, err := generate("package x\n\ntype A struct{ N float32 }\n\ntype B []A\n", "B")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(out)).To(ContainSubstring("func (r B) AppendTo(w resp.ResponseWriter) {"))
+		Expect(string(out)).To(ContainSubstring("resp.AppendFloat(w, float64(r[i].N), 32)"))
+		Expect(string(out)).NotTo(ContainSubstring("func (r *A) AppendTo"))
+	})
+
+	It("should fail on bad input", func() {
+		_, err := generate("package x\n\ntype A struct{}\n")
+		Expect(err).To(MatchError("no types to generate in package x"))
+
+		_, err = generate("package x\n\ntype A struct{}\n", "B")
+		Expect(err).To(MatchError("type B not found in package x"))
+
+		_, err = generate("package x\n\n//redeo:append\ntype A struct{ C chan int }\n")
+		Expect(err).To(MatchError("A: field C: unsupported type chan int"))
+
+		_, err = generate("package x\n\n//redeo:append\ntype A struct{ B *B }\n\ntype B struct{ Next *B }\n")
+		Expect(err).To(MatchError(ContainSubstring("recursive type B must be annotated")))
+	})
+})
+
+func TestSuite(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "cmd/redeo-gen-append")
+}
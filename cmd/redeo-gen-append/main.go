@@ -0,0 +1,128 @@
+// Command redeo-gen-append generates AppendTo methods, implementing
+// resp.CustomResponse, for annotated types. Generated methods produce the
+// same output as the reflection-based ResponseWriter.Append, but
+// without the reflection overhead.
+//
+// Types are selected via the -type flag or by annotating them with a
+// //redeo:append comment:
+//
+//	//go:generate go run github.com/bsm/redeo/v2/cmd/redeo-gen-append
+//
+//	//redeo:append
+//	type User struct {
+//		Name  string `resp:"name"`
+//		Email string `resp:"email,omitempty"`
+//	}
+//
+// Struct fields support the same `resp` tags as Append. Values of
+// types which cannot be resolved within the package, with the exception
+// of time.Time and time.Duration, are delegated to Append at runtime.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+var flags struct {
+	types  string
+	output string
+}
+
+func init() {
+	flag.StringVar(&flags.types, "type", "", "Comma-separated list of type names (default: types annotated with //redeo:append)")
+	flag.StringVar(&flags.output, "output", "redeo_append.go", "The output file name; use a _test.go suffix to generate for test packages")
+}
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("redeo-gen-append: ")
+	flag.Parse()
+
+	if err := run(); err != nil {
+		log.Fatalln(err)
+	}
+}
+
+func run() error {
+	dir := "."
+	if flag.NArg() != 0 {
+		dir = flag.Arg(0)
+	}
+
+	output := filepath.Base(flags.output)
+	withTests := strings.HasSuffix(output, "_test.go")
+
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, dir, func(fi os.FileInfo) bool {
+		name := fi.Name()
+		return name != output && (withTests || !strings.HasSuffix(name, "_test.go"))
+	}, parser.ParseComments)
+	if err != nil {
+		return err
+	}
+
+	pkg, err := selectPackage(pkgs, os.Getenv("GOFILE"))
+	if err != nil {
+		return err
+	}
+
+	var types []string
+	if flags.types != "" {
+		types = strings.Split(flags.types, ",")
+	}
+
+	g := newGenerator(pkg.Name)
+	if err := g.load(sortedFiles(pkg), types); err != nil {
+		return err
+	}
+
+	src, err := g.generate()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, flags.output), src, 0o644)
+}
+
+// selectPackage picks the package containing file, as set by go generate.
+func selectPackage(pkgs map[string]*ast.Package, file string) (*ast.Package, error) {
+	if file != "" {
+		for _, pkg := range pkgs {
+			for name := range pkg.Files {
+				if filepath.Base(name) == file {
+					return pkg, nil
+				}
+			}
+		}
+	}
+
+	if len(pkgs) != 1 {
+		return nil, fmt.Errorf("expected a single package, found %d", len(pkgs))
+	}
+	for _, pkg := range pkgs {
+		return pkg, nil
+	}
+	return nil, nil
+}
+
+func sortedFiles(pkg *ast.Package) []*ast.File {
+	names := make([]string, 0, len(pkg.Files))
+	for name := range pkg.Files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	files := make([]*ast.File, 0, len(names))
+	for _, name := range names {
+		files = append(files, pkg.Files[name])
+	}
+	return files
+}
@@ -0,0 +1,55 @@
+package fixture
+
+import (
+	"net"
+	"time"
+)
+
+// Meta is embedded and flattened.
+type Meta struct {
+	Version int `resp:"version"`
+}
+
+// Address is inlined into annotated types.
+type Address struct {
+	City string `resp:"city"`
+	Zip  uint16 `resp:"zip,omitempty"`
+}
+
+// Score is a named float.
+type Score float64
+
+// Level implements fmt.Stringer.
+type Level int
+
+func (l Level) String() string { return "level" }
+
+//redeo:append
+type User struct {
+	Meta
+	ID      int64             `resp:"id"`
+	Name    string            `resp:"name"`
+	Email   string            `resp:"email,omitempty"`
+	Admin   bool              `resp:"admin"`
+	Score   Score             `resp:"score"`
+	Ratio   float32           `resp:"ratio,omitempty"`
+	Level   Level             `resp:"level,string"`
+	Created time.Time         `resp:"created"`
+	Updated time.Time         `resp:"updated,ms"`
+	TTL     time.Duration     `resp:"ttl"`
+	Tags    []string          `resp:"tags"`
+	Home    *Address          `resp:"home"`
+	Work    Address           `resp:"work"`
+	Attrs   map[string]string `resp:"attrs,omitempty"`
+	Raw     []byte            `resp:"raw"`
+	IP      net.IP            `resp:"ip"`
+	Extra   interface{}       `resp:"extra"`
+	Skip    string            `resp:"-"`
+	private string
+}
+
+//redeo:append
+type Users []User
+
+//redeo:append
+type Friends map[string]*User
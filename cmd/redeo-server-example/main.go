@@ -32,6 +32,9 @@ func run() error {
 	srv.Handle("info", redeo.Info(srv))
 	srv.Handle("publish", broker.Publish())
 	srv.Handle("subscribe", broker.Subscribe())
+	srv.Handle("psubscribe", broker.PSubscribe())
+	srv.Handle("unsubscribe", broker.Unsubscribe())
+	srv.Handle("punsubscribe", broker.PUnsubscribe())
 
 	lis, err := net.Listen("tcp", flags.addr)
 	if err != nil {
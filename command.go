@@ -0,0 +1,351 @@
+package redeo
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/bsm/redeo/v2/resp"
+)
+
+// CommandDescriptions returns a command handler, supporting
+// COMMAND, COMMAND COUNT, COMMAND INFO, COMMAND GETKEYS, COMMAND DOCS
+// and COMMAND LIST.
+// https://redis.io/commands/command
+type CommandDescriptions []CommandDescription
+
+func (s CommandDescriptions) ServeRedeo(w resp.ResponseWriter, c *resp.Command) {
+	if c.ArgN() == 0 {
+		w.AppendArrayLen(len(s))
+		for i := range s {
+			appendCommandInfo(w, &s[i], "")
+		}
+		return
+	}
+
+	sub := strings.ToLower(c.Arg(0).String())
+	args := c.Args[1:]
+
+	switch sub {
+	case "count":
+		if len(args) != 0 {
+			w.AppendError(WrongNumberOfArgs(c.Name + "|" + sub))
+			return
+		}
+		w.AppendInt(int64(len(s)))
+	case "info":
+		if len(args) == 0 {
+			s.ServeRedeo(w, resp.NewCommand(c.Name))
+			return
+		}
+
+		w.AppendArrayLen(len(args))
+		for _, name := range args {
+			if d, parent := s.find(name.String()); d != nil {
+				appendCommandInfo(w, d, parent)
+			} else {
+				w.AppendNil()
+			}
+		}
+	case "getkeys":
+		if len(args) == 0 {
+			w.AppendError(WrongNumberOfArgs(c.Name + "|" + sub))
+			return
+		}
+		s.serveGetKeys(w, args)
+	case "docs":
+		s.serveDocs(w, args)
+	case "list":
+		s.serveList(w, args)
+	default:
+		w.AppendError("ERR Unknown " + strings.ToLower(c.Name) + " subcommand '" + c.Arg(0).String() + "'")
+	}
+}
+
+// find finds a command description by name. Sub-commands can be
+// addressed as "command|subcommand". Returns the description and the
+// normalised name of the parent command, if a sub-command was found.
+func (s CommandDescriptions) find(name string) (*CommandDescription, string) {
+	name = strings.ToLower(name)
+	parent, sub := name, ""
+	if pos := strings.IndexByte(name, '|'); pos > -1 {
+		parent, sub = name[:pos], name[pos+1:]
+	}
+
+	for i := range s {
+		d := &s[i]
+		if strings.ToLower(d.Name) != parent {
+			continue
+		}
+		if sub == "" {
+			return d, ""
+		}
+		for j := range d.SubCommands {
+			sd := &d.SubCommands[j]
+			if subCommandName(parent, sd.Name) == name {
+				return sd, parent
+			}
+		}
+		return nil, ""
+	}
+	return nil, ""
+}
+
+func (s CommandDescriptions) serveGetKeys(w resp.ResponseWriter, args []resp.CommandArgument) {
+	d, _ := s.find(args[0].String())
+	if d != nil && len(d.SubCommands) != 0 && len(args) > 1 {
+		if sd, _ := s.find(args[0].String() + "|" + args[1].String()); sd != nil {
+			d = sd
+		}
+	}
+
+	switch {
+	case d == nil:
+		w.AppendError("ERR Invalid command specified")
+		return
+	case !d.acceptsArgs(len(args) - 1):
+		w.AppendError("ERR Invalid number of arguments specified for command")
+		return
+	case d.FirstKey < 1:
+		w.AppendError("ERR The command has no key arguments")
+		return
+	}
+
+	cmd := resp.NewCommand(args[0].String(), args[1:]...)
+	cmd.SetKeySpec(d.FirstKey, d.LastKey, d.KeyStepCount)
+	keys := cmd.Keys()
+
+	w.AppendArrayLen(len(keys))
+	for _, key := range keys {
+		w.AppendBulk(key)
+	}
+}
+
+func (s CommandDescriptions) serveDocs(w resp.ResponseWriter, args []resp.CommandArgument) {
+	if len(args) == 0 {
+		w.AppendArrayLen(len(s) * 2)
+		for i := range s {
+			w.AppendBulkString(strings.ToLower(s[i].Name))
+			appendCommandDocs(w, &s[i], "")
+		}
+		return
+	}
+
+	type match struct {
+		desc   *CommandDescription
+		parent string
+	}
+
+	matches := make([]match, 0, len(args))
+	for _, name := range args {
+		if d, parent := s.find(name.String()); d != nil {
+			matches = append(matches, match{desc: d, parent: parent})
+		}
+	}
+
+	w.AppendArrayLen(len(matches) * 2)
+	for _, m := range matches {
+		w.AppendBulkString(subCommandName(m.parent, m.desc.Name))
+		appendCommandDocs(w, m.desc, m.parent)
+	}
+}
+
+func (s CommandDescriptions) serveList(w resp.ResponseWriter, args []resp.CommandArgument) {
+	filter := func(*CommandDescription) bool { return true }
+
+	switch len(args) {
+	case 0:
+	case 3:
+		if strings.ToLower(args[0].String()) != "filterby" {
+			w.AppendError("ERR syntax error")
+			return
+		}
+
+		value := args[2].String()
+		switch strings.ToLower(args[1].String()) {
+		case "aclcat":
+			cat := "@" + strings.TrimPrefix(strings.ToLower(value), "@")
+			filter = func(d *CommandDescription) bool {
+				for _, c := range d.ACLCategories {
+					if aclCategory(c) == cat {
+						return true
+					}
+				}
+				return false
+			}
+		case "pattern":
+			pattern := strings.ToLower(value)
+			filter = func(d *CommandDescription) bool {
+				return matchPattern(pattern, strings.ToLower(d.Name))
+			}
+		case "module":
+			filter = func(*CommandDescription) bool { return false }
+		default:
+			w.AppendError("ERR syntax error")
+			return
+		}
+	default:
+		w.AppendError("ERR syntax error")
+		return
+	}
+
+	names := make([]string, 0, len(s))
+	for i := range s {
+		if filter(&s[i]) {
+			names = append(names, strings.ToLower(s[i].Name))
+		}
+	}
+
+	w.AppendArrayLen(len(names))
+	for _, name := range names {
+		w.AppendBulkString(name)
+	}
+}
+
+// --------------------------------------------------------------------
+
+func appendCommandInfo(w resp.ResponseWriter, d *CommandDescription, parent string) {
+	w.AppendArrayLen(10)
+	w.AppendBulkString(subCommandName(parent, d.Name))
+	w.AppendInt(d.Arity)
+	appendStrings(w, d.Flags)
+	w.AppendInt(d.FirstKey)
+	w.AppendInt(d.LastKey)
+	w.AppendInt(d.KeyStepCount)
+
+	w.AppendArrayLen(len(d.ACLCategories))
+	for _, cat := range d.ACLCategories {
+		w.AppendBulkString(aclCategory(cat))
+	}
+	appendStrings(w, d.Tips)
+
+	// key specifications, derived from first/last/step
+	if d.FirstKey > 0 {
+		lastKey := d.LastKey
+		if lastKey >= 0 {
+			lastKey -= d.FirstKey
+		}
+		keyStep := d.KeyStepCount
+		if keyStep < 1 {
+			keyStep = 1
+		}
+
+		w.AppendArrayLen(1)
+		w.AppendArrayLen(6)
+		w.AppendBulkString("flags")
+		w.AppendArrayLen(0)
+		w.AppendBulkString("begin_search")
+		w.AppendArrayLen(4)
+		w.AppendBulkString("type")
+		w.AppendBulkString("index")
+		w.AppendBulkString("spec")
+		w.AppendArrayLen(2)
+		w.AppendBulkString("index")
+		w.AppendInt(d.FirstKey)
+		w.AppendBulkString("find_keys")
+		w.AppendArrayLen(4)
+		w.AppendBulkString("type")
+		w.AppendBulkString("range")
+		w.AppendBulkString("spec")
+		w.AppendArrayLen(6)
+		w.AppendBulkString("lastkey")
+		w.AppendInt(lastKey)
+		w.AppendBulkString("keystep")
+		w.AppendInt(keyStep)
+		w.AppendBulkString("limit")
+		w.AppendInt(0)
+	} else {
+		w.AppendArrayLen(0)
+	}
+
+	name := subCommandName(parent, d.Name)
+	w.AppendArrayLen(len(d.SubCommands))
+	for i := range d.SubCommands {
+		appendCommandInfo(w, &d.SubCommands[i], name)
+	}
+}
+
+func appendCommandDocs(w resp.ResponseWriter, d *CommandDescription, parent string) {
+	fields := [][2]string{
+		{"summary", d.Summary},
+		{"since", d.Since},
+		{"group", d.Group},
+		{"complexity", d.Complexity},
+	}
+
+	n := 0
+	for _, f := range fields {
+		if f[1] != "" {
+			n += 2
+		}
+	}
+	if len(d.SubCommands) != 0 {
+		n += 2
+	}
+
+	w.AppendArrayLen(n)
+	for _, f := range fields {
+		if f[1] != "" {
+			w.AppendBulkString(f[0])
+			w.AppendBulkString(f[1])
+		}
+	}
+
+	if len(d.SubCommands) != 0 {
+		name := subCommandName(parent, d.Name)
+
+		w.AppendBulkString("subcommands")
+		w.AppendArrayLen(len(d.SubCommands) * 2)
+		for i := range d.SubCommands {
+			sd := &d.SubCommands[i]
+			w.AppendBulkString(subCommandName(name, sd.Name))
+			appendCommandDocs(w, sd, name)
+		}
+	}
+}
+
+func appendStrings(w resp.ResponseWriter, ss []string) {
+	w.AppendArrayLen(len(ss))
+	for _, s := range ss {
+		w.AppendBulkString(s)
+	}
+}
+
+func aclCategory(s string) string {
+	return "@" + strings.TrimPrefix(strings.ToLower(s), "@")
+}
+
+// subCommandName returns the normalised "parent|name" sub-command name.
+func subCommandName(parent, name string) string {
+	name = strings.ToLower(name)
+	if parent == "" {
+		return name
+	}
+	return parent + "|" + strings.TrimPrefix(name, parent+"|")
+}
+
+// describeSubCommands generates sub-command descriptions for the
+// given handler, unless already described.
+func describeSubCommands(d *CommandDescription, h interface{}) {
+	if len(d.SubCommands) != 0 {
+		return
+	}
+
+	subs, ok := h.(SubCommands)
+	if !ok {
+		return
+	}
+
+	names := make([]string, 0, len(subs))
+	for name := range subs {
+		names = append(names, strings.ToLower(name))
+	}
+	sort.Strings(names)
+
+	d.SubCommands = make([]CommandDescription, 0, len(names))
+	for _, name := range names {
+		d.SubCommands = append(d.SubCommands, CommandDescription{
+			Name:  d.Name + "|" + name,
+			Arity: -2,
+		})
+	}
+}
@@ -1,10 +1,17 @@
 package redeo
 
-import "time"
+import (
+	"os"
+	"runtime"
+	"time"
+
+	"github.com/bsm/redeo/v2/resp"
+)
 
 // Config holds the server configuration
 type Config struct {
 	// Timeout represents the per-request socket read/write timeout.
+	// Connections which remain idle for longer are closed.
 	// Default: 0 (disabled)
 	Timeout time.Duration
 
@@ -22,4 +29,135 @@ type Config struct {
 	// On other kernels the period depends on the kernel configuration.
 	// Default: 0 (disabled)
 	TCPKeepAlive time.Duration
+
+	// UnixSocketPerm sets the file permissions of unix sockets created by
+	// ListenAndServe.
+	// Default: 0 (use umask)
+	UnixSocketPerm os.FileMode
+
+	// ReadBufferSize sets the size of client read buffers. Buffers are
+	// shared between clients and only held while requests are pending.
+	// They grow as needed to accommodate large requests.
+	// Default: 64KB
+	ReadBufferSize int
+
+	// WriteBufferSize sets the size of client write buffers. Buffers are
+	// shared between clients and only held until responses are flushed.
+	// Responses are flushed once half of the buffer is used.
+	// Default: 64KB
+	WriteBufferSize int
+
+	// EventLoop enables event-driven connection handling on Linux. Instead
+	// of blocking a goroutine per connection in a read, pollers watch idle
+	// connections via epoll and dispatch pipelines to a bounded number of
+	// workers, once requests arrive. Handlers blocking for long periods of
+	// time occupy a worker, as do clients which send partial requests,
+	// until the remainder arrives or Timeout expires. Once all workers are
+	// occupied, pollers stop dispatching, so a Timeout should be set when
+	// serving untrusted clients. Serve fails on other platforms.
+	// Default: false
+	EventLoop bool
+
+	// EventLoopPollers sets the number of epoll pollers.
+	// Default: GOMAXPROCS/4 (at least 1)
+	EventLoopPollers int
+
+	// EventLoopWorkers limits the number of pipelines which are
+	// served concurrently in event-loop mode. Slow clients, which send
+	// partial requests, occupy a worker each.
+	// Default: 128 * GOMAXPROCS
+	EventLoopWorkers int
+
+	// MaxBulkLen limits the length of bulk arguments, like proto-max-bulk-len
+	// in redis. Clients exceeding the limit receive a protocol error and are
+	// disconnected.
+	// Default: 512MB
+	MaxBulkLen int64
+
+	// MaxMultiBulkLen limits the number of arguments per request,
+	// including the command name.
+	// Default: 1048576
+	MaxMultiBulkLen int
+
+	// MaxInlineLen limits the length of inline requests.
+	// Default: 64KB
+	MaxInlineLen int
+
+	// ReplBacklogSize sets the size of the replication backlog, which retains
+	// recent writes for partial resynchronisations of followers. The backlog
+	// is allocated once the first follower connects.
+	// Default: 1MB
+	ReplBacklogSize int
+
+	// ReplPingInterval sets the interval in which masters send PINGs to
+	// followers while no writes are replicated, like repl-ping-replica-period
+	// in redis.
+	// Default: 10s
+	ReplPingInterval time.Duration
+
+	// ReplTimeout closes the connection of a follower to its master, once
+	// nothing has been received for longer, like repl-timeout in redis. It
+	// must be larger than the ReplPingInterval of the master.
+	// Default: 60s
+	ReplTimeout time.Duration
+}
+
+func (c *Config) readBufferSize() int {
+	if c.ReadBufferSize > 0 {
+		return c.ReadBufferSize
+	}
+	return resp.MaxBufferSize
+}
+
+func (c *Config) writeBufferSize() int {
+	if c.WriteBufferSize > 0 {
+		return c.WriteBufferSize
+	}
+	return resp.MaxBufferSize
+}
+
+func (c *Config) eventLoopPollers() int {
+	if c.EventLoopPollers > 0 {
+		return c.EventLoopPollers
+	}
+	if n := runtime.GOMAXPROCS(0) / 4; n > 1 {
+		return n
+	}
+	return 1
+}
+
+func (c *Config) eventLoopWorkers() int {
+	if c.EventLoopWorkers > 0 {
+		return c.EventLoopWorkers
+	}
+	return 128 * runtime.GOMAXPROCS(0)
+}
+
+func (c *Config) replBacklogSize() int {
+	if c.ReplBacklogSize > 0 {
+		return c.ReplBacklogSize
+	}
+	return 1024 * 1024
+}
+
+func (c *Config) replPingInterval() time.Duration {
+	if c.ReplPingInterval > 0 {
+		return c.ReplPingInterval
+	}
+	return 10 * time.Second
+}
+
+func (c *Config) replTimeout() time.Duration {
+	if c.ReplTimeout > 0 {
+		return c.ReplTimeout
+	}
+	return time.Minute
+}
+
+func (c *Config) requestLimits() *resp.RequestLimits {
+	return &resp.RequestLimits{
+		MaxBulkLen:      c.MaxBulkLen,
+		MaxMultiBulkLen: c.MaxMultiBulkLen,
+		MaxInlineLen:    c.MaxInlineLen,
+	}
 }
@@ -0,0 +1,263 @@
+//go:build linux
+
+package redeo
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+const (
+	// epoll events of interest, connections are re-armed after each pipeline
+	pollEvents = syscall.EPOLLIN | syscall.EPOLLRDHUP | syscall.EPOLLONESHOT
+
+	// pollTimeout is the interval (in ms) in which pollers check
+	// whether the server has been shut down and close expired
+	// idle connections.
+	pollTimeout = 250
+)
+
+// eventLoop watches idle connections via epoll and dispatches
+// pipelines to workers once requests arrive.
+type eventLoop struct {
+	srv     *Server
+	pollers []*poller
+	next    uint32
+	workers chan struct{} // limits concurrent pipelines
+	conns   int64         // number of registered connections
+}
+
+func newEventLoop(srv *Server) (*eventLoop, error) {
+	l := &eventLoop{
+		srv:     srv,
+		pollers: make([]*poller, srv.config.eventLoopPollers()),
+		workers: make(chan struct{}, srv.config.eventLoopWorkers()),
+	}
+
+	for i := range l.pollers {
+		fd, err := syscall.EpollCreate1(syscall.EPOLL_CLOEXEC)
+		if err != nil {
+			for _, p := range l.pollers[:i] {
+				_ = syscall.Close(p.fd)
+			}
+			return nil, err
+		}
+		l.pollers[i] = &poller{loop: l, fd: fd, conns: make(map[int32]*loopConn)}
+	}
+	for _, p := range l.pollers {
+		go p.run()
+	}
+	return l, nil
+}
+
+// add registers a client with the loop. Clients which cannot be
+// polled are served by a dedicated goroutine.
+func (l *eventLoop) add(c *Client) {
+	fd, ok := connFD(c.cn)
+	if !ok {
+		go l.srv.serveClient(c)
+		return
+	}
+
+	l.srv.initClient(c)
+
+	p := l.pollers[int(atomic.AddUint32(&l.next, 1))%len(l.pollers)]
+	if lc := (&loopConn{Client: c, fd: fd, p: p}); !p.add(lc) {
+		go l.fallback(lc)
+	}
+}
+
+// dispatch serves a pipeline once a worker is available. Workers block in
+// reads until requests are complete, so slow clients may occupy all
+// workers and stall the poller until Config.Timeout expires.
+func (l *eventLoop) dispatch(lc *loopConn) {
+	l.workers <- struct{}{}
+	go func() {
+		defer func() { <-l.workers }()
+
+		if !l.srv.serveOnce(lc.Client) {
+			lc.p.remove(lc)
+		} else if err := lc.p.arm(lc); err != nil {
+			go l.fallback(lc)
+		}
+	}()
+}
+
+// fallback serves the connection in a dedicated goroutine,
+// once it can no longer be polled.
+func (l *eventLoop) fallback(lc *loopConn) {
+	for l.srv.serveOnce(lc.Client) {
+	}
+	lc.p.remove(lc)
+}
+
+// done returns true once the server is shut down and
+// all connections have been closed.
+func (l *eventLoop) done() bool {
+	return atomic.LoadInt64(&l.conns) == 0 && l.srv.isClosed()
+}
+
+// --------------------------------------------------------------------
+
+type loopConn struct {
+	*Client
+	fd     int
+	p      *poller
+	busy   bool      // pipeline is being served
+	active time.Time // end of the last pipeline
+}
+
+type poller struct {
+	loop   *eventLoop
+	fd     int
+	conns  map[int32]*loopConn
+	closed bool
+	mu     sync.Mutex
+}
+
+func (p *poller) run() {
+	defer p.close()
+
+	events := make([]syscall.EpollEvent, 128)
+	swept := time.Now()
+	for {
+		n, err := syscall.EpollWait(p.fd, events, pollTimeout)
+		if err == syscall.EINTR {
+			continue
+		} else if err != nil {
+			return
+		} else if n == 0 && p.loop.done() {
+			return
+		}
+
+		if now := time.Now(); n == 0 || now.Sub(swept) >= pollTimeout*time.Millisecond {
+			p.sweep(now)
+			swept = now
+		}
+
+		for _, ev := range events[:n] {
+			p.mu.Lock()
+			lc := p.conns[ev.Fd]
+			if lc != nil {
+				lc.busy = true
+			}
+			p.mu.Unlock()
+
+			if lc != nil {
+				p.loop.dispatch(lc)
+			}
+		}
+	}
+}
+
+func (p *poller) add(lc *loopConn) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return false
+	}
+
+	ev := syscall.EpollEvent{Events: pollEvents, Fd: int32(lc.fd)}
+	if err := syscall.EpollCtl(p.fd, syscall.EPOLL_CTL_ADD, lc.fd, &ev); err != nil {
+		return false
+	}
+
+	lc.active = time.Now()
+	p.conns[int32(lc.fd)] = lc
+	atomic.AddInt64(&p.loop.conns, 1)
+	return true
+}
+
+// arm re-arms the connection after a pipeline has been served.
+func (p *poller) arm(lc *loopConn) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return syscall.EBADF
+	}
+
+	lc.busy = false
+	lc.active = time.Now()
+	ev := syscall.EpollEvent{Events: pollEvents, Fd: int32(lc.fd)}
+	return syscall.EpollCtl(p.fd, syscall.EPOLL_CTL_MOD, lc.fd, &ev)
+}
+
+// sweep closes connections which have been idle for longer than the
+// configured Timeout, like blocking reads do in goroutine-per-connection
+// mode.
+func (p *poller) sweep(now time.Time) {
+	timeout := p.loop.srv.config.Timeout
+	if timeout <= 0 {
+		return
+	}
+
+	var expired []*loopConn
+	p.mu.Lock()
+	for _, lc := range p.conns {
+		if !lc.busy && now.Sub(lc.active) >= timeout {
+			lc.busy = true
+			expired = append(expired, lc)
+		}
+	}
+	p.mu.Unlock()
+
+	for _, lc := range expired {
+		p.remove(lc)
+	}
+}
+
+// remove deregisters the connection before it is released, as file
+// descriptors may be reused once closed.
+func (p *poller) remove(lc *loopConn) {
+	p.mu.Lock()
+	if !p.closed {
+		_ = syscall.EpollCtl(p.fd, syscall.EPOLL_CTL_DEL, lc.fd, nil)
+	}
+	if _, ok := p.conns[int32(lc.fd)]; ok {
+		delete(p.conns, int32(lc.fd))
+		atomic.AddInt64(&p.loop.conns, -1)
+	}
+	p.mu.Unlock()
+
+	p.loop.srv.releaseClient(lc.Client)
+}
+
+// close closes the poller. Remaining idle connections are served in
+// dedicated goroutines, busy connections fall back once served.
+func (p *poller) close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.closed = true
+	_ = syscall.Close(p.fd)
+
+	for _, lc := range p.conns {
+		if !lc.busy {
+			go p.loop.fallback(lc)
+		}
+	}
+}
+
+// connFD extracts the file descriptor of a connection.
+func connFD(cn net.Conn) (int, bool) {
+	sc, ok := cn.(syscall.Conn)
+	if !ok {
+		return 0, false
+	}
+
+	raw, err := sc.SyscallConn()
+	if err != nil {
+		return 0, false
+	}
+
+	fd := -1
+	if err := raw.Control(func(s uintptr) { fd = int(s) }); err != nil || fd < 0 {
+		return 0, false
+	}
+	return fd, true
+}
@@ -0,0 +1,211 @@
+//go:build linux
+
+package redeo
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/bsm/ginkgo/v2"
+	. "github.com/bsm/gomega"
+	"github.com/bsm/redeo/v2/resp"
+)
+
+var _ = Describe("EventLoop", func() {
+	var subject *Server
+	var lis net.Listener
+
+	dial := func() (net.Conn, *resp.RequestWriter, resp.ResponseReader) {
+		cn, err := net.Dial("tcp", lis.Addr().String())
+		Expect(err).NotTo(HaveOccurred())
+		return cn, resp.NewRequestWriter(cn), resp.NewResponseReader(cn)
+	}
+
+	BeforeEach(func() {
+		subject = NewServer(&Config{EventLoop: true, EventLoopPollers: 2, EventLoopWorkers: 4})
+		subject.HandleFunc("echo", func(w resp.ResponseWriter, cmd *resp.Command) {
+			w.AppendBulk(cmd.Arg(0))
+		})
+		subject.HandleFunc("quit", func(w resp.ResponseWriter, cmd *resp.Command) {
+			GetClient(cmd.Context()).Close()
+			w.AppendOK()
+		})
+
+		var err error
+		lis, err = net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+		go func() { _ = subject.Serve(lis) }()
+	})
+
+	AfterEach(func() {
+		Expect(subject.Shutdown()).To(Succeed())
+	})
+
+	It("should serve many clients", func() {
+		var wg sync.WaitGroup
+		for i := 0; i < 50; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer GinkgoRecover()
+				defer wg.Done()
+
+				cn, cw, cr := dial()
+				defer cn.Close()
+
+				for j := 0; j < 20; j++ {
+					val := fmt.Sprintf("%d.%d", i, j)
+					cw.WriteCmdString("ECHO", val)
+					cw.WriteCmdString("ECHO", strings.Repeat(val, 1000))
+					Expect(cw.Flush()).To(Succeed())
+					Expect(cr.ReadBulkString()).To(Equal(val))
+					Expect(cr.ReadBulkString()).To(Equal(strings.Repeat(val, 1000)))
+				}
+			}(i)
+		}
+		wg.Wait()
+
+		Eventually(subject.Info().NumClients).Should(BeZero())
+		Expect(subject.Info().TotalConnections()).To(Equal(int64(50)))
+		Expect(subject.Info().TotalCommands()).To(Equal(int64(2000)))
+	})
+
+	It("should close idle connections after timeout", func() {
+		srv := NewServer(&Config{EventLoop: true, Timeout: 100 * time.Millisecond})
+		srv.HandleFunc("echo", func(w resp.ResponseWriter, cmd *resp.Command) {
+			w.AppendBulk(cmd.Arg(0))
+		})
+
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+		go func(srv *Server, lis net.Listener) { _ = srv.Serve(lis) }(srv, lis)
+		DeferCleanup(srv.Shutdown)
+
+		cn, err := net.Dial("tcp", lis.Addr().String())
+		Expect(err).NotTo(HaveOccurred())
+		defer cn.Close()
+
+		cw, cr := resp.NewRequestWriter(cn), resp.NewResponseReader(cn)
+		for i := 0; i < 3; i++ {
+			cw.WriteCmdString("ECHO", "x")
+			Expect(cw.Flush()).To(Succeed())
+			Expect(cr.ReadBulkString()).To(Equal("x"))
+			time.Sleep(50 * time.Millisecond)
+		}
+		Expect(srv.Info().NumClients()).To(Equal(1))
+
+		Expect(cn.SetReadDeadline(time.Now().Add(2 * time.Second))).To(Succeed())
+		_, err = cr.PeekType()
+		Expect(err).To(MatchError(io.EOF))
+		Eventually(srv.Info().NumClients).Should(BeZero())
+	})
+
+	It("should serve partial requests", func() {
+		cn, _, cr := dial()
+		defer cn.Close()
+
+		_, err := cn.Write([]byte("*2\r\n$4\r\nECHO\r\n$5\r\nHE"))
+		Expect(err).NotTo(HaveOccurred())
+		time.Sleep(10 * time.Millisecond)
+		_, err = cn.Write([]byte("LLO\r\nECHO WORLD\r\n"))
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(cr.ReadBulkString()).To(Equal("HELLO"))
+		Expect(cr.ReadBulkString()).To(Equal("WORLD"))
+	})
+
+	It("should close connections", func() {
+		cn, cw, cr := dial()
+		defer cn.Close()
+
+		cw.WriteCmdString("ECHO", "x")
+		Expect(cw.Flush()).To(Succeed())
+		Expect(cr.ReadBulkString()).To(Equal("x"))
+		Expect(subject.Info().NumClients()).To(Equal(1))
+
+		cw.WriteCmd("QUIT")
+		Expect(cw.Flush()).To(Succeed())
+		Expect(cr.ReadInlineString()).To(Equal("OK"))
+		_, err := cr.PeekType()
+		Expect(err).To(MatchError("EOF"))
+		Eventually(subject.Info().NumClients).Should(BeZero())
+
+		cn2, _, _ := dial()
+		Eventually(subject.Info().NumClients).Should(Equal(1))
+		Expect(cn2.Close()).To(Succeed())
+		Eventually(subject.Info().NumClients).Should(BeZero())
+	})
+
+	It("should continue serving clients after shutdown", func() {
+		cn, cw, cr := dial()
+		defer cn.Close()
+
+		cw.WriteCmdString("ECHO", "x")
+		Expect(cw.Flush()).To(Succeed())
+		Expect(cr.ReadBulkString()).To(Equal("x"))
+
+		Expect(subject.Shutdown()).To(Succeed())
+		time.Sleep(2 * pollTimeout * time.Millisecond)
+
+		cw.WriteCmdString("ECHO", "y")
+		Expect(cw.Flush()).To(Succeed())
+		Expect(cr.ReadBulkString()).To(Equal("y"))
+	})
+
+	It("should fall back on connections which cannot be polled", func() {
+		lis2, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+		go func() { _ = subject.Serve(&plainListener{Listener: lis2}) }()
+
+		cn, err := net.Dial("tcp", lis2.Addr().String())
+		Expect(err).NotTo(HaveOccurred())
+		defer cn.Close()
+
+		cw, cr := resp.NewRequestWriter(cn), resp.NewResponseReader(cn)
+		cw.WriteCmdString("ECHO", "x")
+		Expect(cw.Flush()).To(Succeed())
+		Expect(cr.ReadBulkString()).To(Equal("x"))
+		Expect(subject.Info().NumClients()).To(Equal(1))
+	})
+})
+
+// plainListener hides the underlying file descriptors of accepted connections.
+type plainListener struct{ net.Listener }
+
+func (l *plainListener) Accept() (net.Conn, error) {
+	cn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return struct{ net.Conn }{Conn: cn}, nil
+}
+
+// --------------------------------------------------------------------
+
+func BenchmarkServer_eventLoop(b *testing.B) {
+	config := &Config{EventLoop: true}
+
+	b.Run("inline", func(b *testing.B) {
+		benchmarkServer(b, config, []byte(
+			"ECHO HELLO\r\n"+
+				"ECHO CRUEL\r\n"+
+				"ECHO WORLD\r\n",
+		), 24)
+	})
+	b.Run("bulk", func(b *testing.B) {
+		benchmarkServer(b, config, []byte(
+			"*2\r\n$4\r\nECHO\r\n$5\r\nHELLO\r\n"+
+				"*2\r\n$4\r\nECHO\r\n$5\r\nCRUEL\r\n"+
+				"*2\r\n$4\r\nECHO\r\n$5\r\nWORLD\r\n",
+		), 24)
+	})
+	for _, n := range []int{10, 1000} {
+		b.Run(fmt.Sprintf("conns/%d", n), func(b *testing.B) {
+			benchmarkServerConns(b, &Config{EventLoop: true}, n)
+		})
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package redeo
+
+import "errors"
+
+var errEventLoopUnsupported = errors.New("redeo: event loop is not supported on this platform")
+
+type eventLoop struct{}
+
+func newEventLoop(_ *Server) (*eventLoop, error) { return nil, errEventLoopUnsupported }
+
+func (*eventLoop) add(_ *Client) {}
@@ -40,6 +40,18 @@ func ExampleServer() {
 	}
 }
 
+func ExampleServer_ListenAndServe() {
+	srv := redeo.NewServer(&redeo.Config{
+		UnixSocketPerm: 0o770,
+	})
+	srv.Handle("ping", redeo.Ping())
+
+	// Listen on TCP and a unix socket (blocking)
+	if err := srv.ListenAndServe(":9736", "unix:///tmp/redeo.sock"); err != nil && err != redeo.ErrServerClosed {
+		panic(err)
+	}
+}
+
 func ExampleClient() {
 	srv := redeo.NewServer(nil)
 	srv.HandleFunc("myip", func(w resp.ResponseWriter, cmd *resp.Command) {
@@ -72,6 +84,36 @@ func ExampleCommandDescriptions() {
 	})
 }
 
+func ExampleCommand() {
+	srv := redeo.NewServer(nil)
+	srv.Handle("ping", redeo.Ping(), redeo.CommandDescription{Arity: -1, Flags: []string{"fast"}})
+	srv.Handle("echo", redeo.Echo(), redeo.CommandDescription{Arity: 2, Flags: []string{"fast"}})
+	srv.Handle("command", redeo.Command(srv))
+}
+
+func ExampleBind() {
+	type setArgs struct {
+		Key   string
+		Value []byte
+		NX    bool   `arg:"NX,flag,group=cond"`
+		XX    bool   `arg:"XX,flag,group=cond"`
+		EX    *int64 `arg:"EX,option,group=expire"`
+		PX    *int64 `arg:"PX,option,group=expire"`
+	}
+
+	srv := redeo.NewServer(nil)
+	srv.HandleFunc("set", func(w resp.ResponseWriter, c *resp.Command) {
+		var args setArgs
+		if err := redeo.Bind(c, &args); err != nil {
+			w.AppendError(err.Error())
+			return
+		}
+
+		// ... store args.Value under args.Key
+		w.AppendOK()
+	})
+}
+
 func ExampleSubCommands() {
 	srv := redeo.NewServer(nil)
 	srv.Handle("custom", redeo.SubCommands{
@@ -86,6 +128,9 @@ func ExamplePubSubBroker() {
 	srv := redeo.NewServer(nil)
 	srv.Handle("publish", broker.Publish())
 	srv.Handle("subscribe", broker.Subscribe())
+	srv.Handle("psubscribe", broker.PSubscribe())
+	srv.Handle("unsubscribe", broker.Unsubscribe())
+	srv.Handle("punsubscribe", broker.PUnsubscribe())
 }
 
 func ExampleHandlerFunc() {
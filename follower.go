@@ -0,0 +1,325 @@
+package redeo
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bsm/redeo/v2/resp"
+)
+
+// ErrReadOnlyReplica is returned to clients attempting to write to a follower.
+var ErrReadOnlyReplica = errors.New("READONLY You can't write against a read only replica.")
+
+const (
+	// followRetryInterval is the delay between reconnection attempts.
+	followRetryInterval = time.Second
+
+	// followAckInterval is the interval in which acknowledgements are sent.
+	followAckInterval = time.Second
+)
+
+// Follow turns the server into a follower of the master at addr. It connects
+// to the master, requests a resynchronisation via PSYNC and applies the
+// replication stream through the registered handlers, until the context is
+// cancelled. Broken connections are re-established, attempting partial
+// resynchronisations. Connections are also re-established once the master
+// remains silent for longer than the ReplTimeout. While following, write
+// commands from clients are rejected with a READONLY error.
+//
+// Snapshots received on full resynchronisations are passed to the
+// Snapshotter, if set. Follow always returns a non-nil error.
+func (srv *Server) Follow(ctx context.Context, addr string) error {
+	f := &follower{srv: srv, addr: addr}
+
+	srv.repl.mu.Lock()
+	if srv.repl.follower != nil {
+		srv.repl.mu.Unlock()
+		return errors.New("redeo: already following a master")
+	}
+	srv.repl.follower = f
+	srv.repl.mu.Unlock()
+
+	defer func() {
+		srv.repl.mu.Lock()
+		srv.repl.follower = nil
+		srv.repl.mu.Unlock()
+	}()
+
+	for {
+		_ = f.run(ctx)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(followRetryInterval):
+		}
+	}
+}
+
+// --------------------------------------------------------------------
+
+type follower struct {
+	srv  *Server
+	addr string
+
+	linkUp bool
+	mu     sync.Mutex
+}
+
+// LinkUp returns true if the follower is connected to the master.
+func (f *follower) LinkUp() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.linkUp
+}
+
+func (f *follower) setLinkUp(v bool) {
+	f.mu.Lock()
+	f.linkUp = v
+	f.mu.Unlock()
+}
+
+// run performs a single synchronisation and applies the stream
+// until the connection fails or the context is cancelled.
+func (f *follower) run(ctx context.Context) error {
+	var d net.Dialer
+	cn, err := d.DialContext(ctx, "tcp", f.addr)
+	if err != nil {
+		return err
+	}
+	defer cn.Close()
+
+	done := make(chan struct{})
+	defer close(done)
+
+	// close the connection on cancellation
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = cn.Close()
+		case <-done:
+		}
+	}()
+
+	rd := &deadlineReader{cn: cn, timeout: f.srv.config.replTimeout()}
+	fc := &followConn{cn: cn, rd: bufio.NewReader(rd), wr: resp.NewRequestWriter(cn)}
+	if err := f.handshake(fc); err != nil {
+		return err
+	}
+
+	f.setLinkUp(true)
+	defer f.setLinkUp(false)
+
+	go f.acknowledge(fc, done)
+
+	return f.apply(fc)
+}
+
+func (f *follower) handshake(fc *followConn) error {
+	r := f.srv.repl
+
+	// like redis, tolerate error replies to PING and REPLCONF
+	if err := fc.call("PING"); err != nil {
+		return err
+	}
+	if err := fc.call("REPLCONF", "capa", "psync2"); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	id, offset := r.id, r.offset
+	r.mu.Unlock()
+
+	if err := fc.send("PSYNC", id, strconv.FormatInt(offset+1, 10)); err != nil {
+		return err
+	}
+	line, err := fc.readLine()
+	if err != nil {
+		return err
+	}
+
+	switch fields := strings.Fields(line); {
+	case len(fields) == 3 && fields[0] == "+FULLRESYNC":
+		if offset, err = strconv.ParseInt(fields[2], 10, 64); err != nil {
+			return err
+		}
+		if err := f.loadSnapshot(fc); err != nil {
+			return err
+		}
+
+		r.mu.Lock()
+		r.id, r.offset = fields[1], offset
+		r.fullSyncs++
+		r.mu.Unlock()
+	case len(fields) >= 1 && fields[0] == "+CONTINUE":
+		r.mu.Lock()
+		if len(fields) > 1 {
+			r.id = fields[1]
+		}
+		r.partialSyncs++
+		r.mu.Unlock()
+	default:
+		return fmt.Errorf("redeo: unexpected PSYNC reply %q", line)
+	}
+	return nil
+}
+
+func (f *follower) loadSnapshot(fc *followConn) error {
+	// masters may send newlines to keep the connection alive
+	var line string
+	for line == "" {
+		var err error
+		if line, err = fc.readLine(); err != nil {
+			return err
+		}
+	}
+	if !strings.HasPrefix(line, "$") {
+		return fmt.Errorf("redeo: unexpected snapshot header %q", line)
+	}
+	n, err := strconv.ParseInt(line[1:], 10, 64)
+	if err != nil {
+		return err
+	}
+
+	f.srv.repl.mu.Lock()
+	snapshotter := f.srv.repl.snapshotter
+	f.srv.repl.mu.Unlock()
+
+	src := io.LimitReader(fc.rd, n)
+	if snapshotter != nil {
+		if err := snapshotter.LoadSnapshot(src); err != nil {
+			return err
+		}
+	}
+	_, err = io.Copy(io.Discard, src)
+	return err
+}
+
+// apply applies the replication stream through the registered handlers.
+func (f *follower) apply(fc *followConn) error {
+	srv, r := f.srv, f.srv.repl
+	rd := resp.NewRequestReader(fc.rd)
+	w := resp.NewResponseWriterSize(io.Discard, 4096)
+
+	var cmd *resp.Command
+	for {
+		var err error
+		if cmd, err = rd.ReadCmd(cmd); err != nil {
+			return err
+		}
+		size := replCmdLen(cmd.Name, cmd.Args)
+
+		switch norm := strings.ToLower(cmd.Name); norm {
+		case "ping", "select":
+		case "replconf":
+			r.mu.Lock()
+			r.offset += size
+			offset := r.offset
+			r.mu.Unlock()
+
+			if cmd.ArgN() != 0 && strings.EqualFold(cmd.Arg(0).String(), "getack") {
+				if err := fc.ack(offset); err != nil {
+					return err
+				}
+			}
+			continue
+		default:
+			srv.applyCmd(w, cmd)
+		}
+
+		r.mu.Lock()
+		r.offset += size
+		r.mu.Unlock()
+	}
+}
+
+// acknowledge periodically reports the processed offset to the master. The
+// connection is closed if acknowledgements fail.
+func (f *follower) acknowledge(fc *followConn, done <-chan struct{}) {
+	ticker := time.NewTicker(followAckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-done:
+			return
+		}
+
+		f.srv.repl.mu.Lock()
+		offset := f.srv.repl.offset
+		f.srv.repl.mu.Unlock()
+
+		if err := fc.ack(offset); err != nil {
+			_ = fc.cn.Close()
+			return
+		}
+	}
+}
+
+// --------------------------------------------------------------------
+
+type followConn struct {
+	cn net.Conn
+	rd *bufio.Reader
+	wr *resp.RequestWriter
+	mu sync.Mutex
+}
+
+// call sends a command and expects a status or an error reply.
+func (fc *followConn) call(cmd string, args ...string) error {
+	if err := fc.send(cmd, args...); err != nil {
+		return err
+	}
+
+	line, err := fc.readLine()
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(line, "+") && !strings.HasPrefix(line, "-") {
+		return fmt.Errorf("redeo: unexpected %s reply %q", cmd, line)
+	}
+	return nil
+}
+
+func (fc *followConn) send(cmd string, args ...string) error {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+
+	fc.wr.WriteCmdString(cmd, args...)
+	return fc.wr.Flush()
+}
+
+func (fc *followConn) ack(offset int64) error {
+	return fc.send("REPLCONF", "ACK", strconv.FormatInt(offset, 10))
+}
+
+func (fc *followConn) readLine() (string, error) {
+	line, err := fc.rd.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// deadlineReader extends the read deadline before each read, so reads fail
+// once the master remains silent for longer than the timeout.
+type deadlineReader struct {
+	cn      net.Conn
+	timeout time.Duration
+}
+
+func (r *deadlineReader) Read(p []byte) (int, error) {
+	if err := r.cn.SetReadDeadline(time.Now().Add(r.timeout)); err != nil {
+		return 0, err
+	}
+	return r.cn.Read(p)
+}
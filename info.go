@@ -5,13 +5,16 @@ import (
 	"encoding/hex"
 	"fmt"
 	mathrand "math/rand"
+	"net"
 	"os"
 	"sort"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/bsm/redeo/v2/info"
+	"github.com/bsm/redeo/v2/resp"
 )
 
 // CommandDescription describes supported commands
@@ -41,6 +44,61 @@ type CommandDescription struct {
 	// KeyStepCount is the step count for locating repeating keys.
 	// https://redis.io/commands/command#step-count
 	KeyStepCount int64
+
+	// ACLCategories is an enumeration of ACL categories, i.e. "@read" or "@fast".
+	// https://redis.io/commands/command#acl-categories
+	ACLCategories []string
+
+	// Tips is an enumeration of command tips for clients,
+	// i.e. "nondeterministic_output" or "request_policy:all_shards".
+	// https://redis.io/docs/reference/command-tips/
+	Tips []string
+
+	// SubCommands describes the sub-commands of a container command.
+	// Sub-command names are returned as "command|subcommand".
+	// https://redis.io/commands/command#subcommands
+	SubCommands []CommandDescription
+
+	// Summary is a short command description, returned by COMMAND DOCS.
+	Summary string
+
+	// Since is the version in which the command was introduced,
+	// returned by COMMAND DOCS.
+	Since string
+
+	// Group is the functional group of the command, returned by COMMAND DOCS.
+	Group string
+
+	// Complexity is a short explanation of the command's time complexity,
+	// returned by COMMAND DOCS.
+	Complexity string
+
+	// Limiter optionally limits the number of concurrent invocations
+	// of the command.
+	Limiter *Limiter
+}
+
+// acceptsArgs returns true if argc arguments (excluding the command name)
+// satisfy the arity. Commands with zero arity are not validated.
+func (d *CommandDescription) acceptsArgs(argc int) bool {
+	n := int64(argc) + 1
+	switch {
+	case d.Arity > 0:
+		return n == d.Arity
+	case d.Arity < 0:
+		return n >= -d.Arity
+	}
+	return true
+}
+
+// hasFlag returns true if the command has the given flag.
+func (d *CommandDescription) hasFlag(flag string) bool {
+	for _, f := range d.Flags {
+		if strings.EqualFold(f, flag) {
+			return true
+		}
+	}
+	return false
 }
 
 // --------------------------------------------------------------------
@@ -53,6 +111,10 @@ type ClientInfo struct {
 	// RemoteAddr is the remote address string
 	RemoteAddr string
 
+	// LocalAddr is the address of the listener which
+	// accepted the client connection
+	LocalAddr string
+
 	// LastCmd is the last command called by this client
 	LastCmd string
 
@@ -67,7 +129,8 @@ type ClientInfo struct {
 func newClientInfo(c *Client, now time.Time) *ClientInfo {
 	return &ClientInfo{
 		ID:         c.id,
-		RemoteAddr: c.RemoteAddr().String(),
+		RemoteAddr: addrString(c.RemoteAddr(), c.LocalAddr()),
+		LocalAddr:  addrString(c.LocalAddr(), nil),
 		CreateTime: now,
 		AccessTime: now,
 	}
@@ -76,15 +139,35 @@ func newClientInfo(c *Client, now time.Time) *ClientInfo {
 // String generates an info string
 func (i *ClientInfo) String() string {
 	now := time.Now()
-	return fmt.Sprintf("id=%d addr=%s age=%d idle=%d cmd=%s",
+	return fmt.Sprintf("id=%d addr=%s laddr=%s age=%d idle=%d cmd=%s",
 		i.ID,
 		i.RemoteAddr,
+		i.LocalAddr,
 		now.Sub(i.CreateTime)/time.Second,
 		now.Sub(i.AccessTime)/time.Second,
 		i.LastCmd,
 	)
 }
 
+// addrString formats addresses for display. Unix sockets are shown as
+// "path:0", like redis does. Unnamed remote unix socket addresses fall back to
+// the local socket path.
+func addrString(addr, fallback net.Addr) string {
+	if addr == nil {
+		return ""
+	}
+	if ua, ok := addr.(*net.UnixAddr); ok {
+		name := ua.Name
+		if (name == "" || name == "@") && fallback != nil {
+			if fa, ok := fallback.(*net.UnixAddr); ok {
+				name = fa.Name
+			}
+		}
+		return name + ":0"
+	}
+	return addr.String()
+}
+
 // --------------------------------------------------------------------
 
 // ServerInfo contains server stats
@@ -95,6 +178,12 @@ type ServerInfo struct {
 	clients     clientStats
 	connections *info.IntValue
 	commands    *info.IntValue
+	rejected    *info.IntValue
+
+	rbufs, wbufs *resp.BufferPool
+
+	limiters   []*Limiter
+	limitersMu sync.Mutex
 }
 
 // newServerInfo creates a new server info container
@@ -104,7 +193,8 @@ func newServerInfo() *ServerInfo {
 		startTime:   time.Now(),
 		connections: info.NewIntValue(0),
 		commands:    info.NewIntValue(0),
-		clients:     clientStats{stats: make(map[uint64]*ClientInfo)},
+		rejected:    info.NewIntValue(0),
+		clients:     clientStats{stats: make(map[uint64]*ClientInfo), clients: make(map[uint64]*Client)},
 	}
 	info.initDefaults()
 	return info
@@ -135,6 +225,19 @@ func (i *ServerInfo) TotalConnections() int64 { return i.connections.Value() }
 // of the server.
 func (i *ServerInfo) TotalCommands() int64 { return i.commands.Value() }
 
+// BufferBytes returns the number of bytes held by client read and write
+// buffers. Idle clients hand their buffers back to a shared pool.
+func (i *ServerInfo) BufferBytes() int64 {
+	if i.rbufs == nil || i.wbufs == nil {
+		return 0
+	}
+	return i.rbufs.InUse() + i.wbufs.InUse()
+}
+
+// TotalRejectedRequests returns the total number of requests rejected for
+// exceeding the configured limits since the start of the server.
+func (i *ServerInfo) TotalRejectedRequests() int64 { return i.rejected.Value() }
+
 // Apply default info
 func (i *ServerInfo) initDefaults() {
 	runID := make([]byte, 20)
@@ -162,6 +265,89 @@ func (i *ServerInfo) initDefaults() {
 	stats := i.Fetch("Stats")
 	stats.Register("total_connections_received", i.connections)
 	stats.Register("total_commands_processed", i.commands)
+	stats.Register("total_rejected_requests", i.rejected)
+}
+
+func (i *ServerInfo) initMemory(rbufs, wbufs *resp.BufferPool) {
+	i.rbufs, i.wbufs = rbufs, wbufs
+
+	memory := i.Fetch("Memory")
+	memory.Register("client_read_buffers_bytes", info.Callback(func() string {
+		return strconv.FormatInt(rbufs.InUse(), 10)
+	}))
+	memory.Register("client_write_buffers_bytes", info.Callback(func() string {
+		return strconv.FormatInt(wbufs.InUse(), 10)
+	}))
+	memory.Register("client_buffers_bytes", info.Callback(func() string {
+		return strconv.FormatInt(i.BufferBytes(), 10)
+	}))
+}
+
+func (i *ServerInfo) initTracking(t *tracker) {
+	i.Fetch("Clients").Register("tracking_clients", info.Callback(func() string {
+		return strconv.FormatInt(t.NumClients(), 10)
+	}))
+	i.Fetch("Stats").Register("tracking_total_keys", info.Callback(func() string {
+		return strconv.Itoa(t.NumKeys())
+	}))
+}
+
+func (i *ServerInfo) initReplication(r *replication) {
+	repl := i.Fetch("Replication")
+	repl.Register("role", info.Callback(r.Role))
+	repl.Register("connected_slaves", info.Callback(func() string {
+		return strconv.Itoa(r.NumReplicas())
+	}))
+	repl.Register("master_link_status", info.Callback(func() string {
+		r.mu.Lock()
+		f := r.follower
+		r.mu.Unlock()
+
+		if f != nil && f.LinkUp() {
+			return "up"
+		}
+		return "down"
+	}))
+	repl.Register("master_replid", info.Callback(func() string {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		return r.id
+	}))
+	repl.Register("master_repl_offset", info.Callback(func() string {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		return strconv.FormatInt(r.offset, 10)
+	}))
+	repl.Register("sync_full", info.Callback(func() string {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		return strconv.FormatInt(r.fullSyncs, 10)
+	}))
+	repl.Register("sync_partial_ok", info.Callback(func() string {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		return strconv.FormatInt(r.partialSyncs, 10)
+	}))
+}
+
+// trackLimiter adds a limiter to the Concurrency section.
+func (i *ServerInfo) trackLimiter(l *Limiter) {
+	i.limitersMu.Lock()
+	defer i.limitersMu.Unlock()
+
+	for _, x := range i.limiters {
+		if x == l {
+			return
+		}
+	}
+	i.limiters = append(i.limiters, l)
+	sort.SliceStable(i.limiters, func(a, b int) bool { return i.limiters[a].name < i.limiters[b].name })
+
+	i.Fetch("Concurrency").Replace(func(s *info.Section) {
+		for _, l := range i.limiters {
+			s.Register("limiter_"+l.name, l)
+		}
+	})
 }
 
 func (i *ServerInfo) register(c *Client) {
@@ -173,6 +359,10 @@ func (i *ServerInfo) deregister(clientID uint64) {
 	i.clients.Del(clientID)
 }
 
+func (i *ServerInfo) reject() {
+	i.rejected.Inc(1)
+}
+
 func (i *ServerInfo) command(clientID uint64, cmd string) {
 	i.clients.Cmd(clientID, cmd)
 	i.commands.Inc(1)
@@ -181,17 +371,26 @@ func (i *ServerInfo) command(clientID uint64, cmd string) {
 // --------------------------------------------------------------------
 
 type clientStats struct {
-	stats map[uint64]*ClientInfo
-	mu    sync.RWMutex
+	stats   map[uint64]*ClientInfo
+	clients map[uint64]*Client
+	mu      sync.RWMutex
 }
 
 func (s *clientStats) Add(c *Client) {
 	info := newClientInfo(c, time.Now())
 	s.mu.Lock()
 	s.stats[c.id] = info
+	s.clients[c.id] = c
 	s.mu.Unlock()
 }
 
+func (s *clientStats) Get(clientID uint64) *Client {
+	s.mu.RLock()
+	c := s.clients[clientID]
+	s.mu.RUnlock()
+	return c
+}
+
 func (s *clientStats) Cmd(clientID uint64, cmd string) {
 	s.mu.Lock()
 	if info, ok := s.stats[clientID]; ok {
@@ -204,6 +403,7 @@ func (s *clientStats) Cmd(clientID uint64, cmd string) {
 func (s *clientStats) Del(clientID uint64) {
 	s.mu.Lock()
 	delete(s.stats, clientID)
+	delete(s.clients, clientID)
 	s.mu.Unlock()
 }
 
@@ -1,6 +1,7 @@
 package redeo
 
 import (
+	"net"
 	"time"
 
 	. "github.com/bsm/ginkgo/v2"
@@ -11,14 +12,14 @@ var _ = Describe("ServerInfo", func() {
 	var subject *ServerInfo
 
 	BeforeEach(func() {
-		c1 := newClient(&mockConn{Port: 10001})
+		c1 := newClient(&mockConn{Port: 10001}, testBuffers, testBuffers)
 
 		subject = newServerInfo()
 		subject.connections.Inc(5)
 		subject.commands.Inc(12)
 		subject.clients.Add(c1)
-		subject.clients.Add(newClient(&mockConn{Port: 10002}))
-		subject.clients.Add(newClient(&mockConn{Port: 10004}))
+		subject.clients.Add(newClient(&mockConn{Port: 10002}, testBuffers, testBuffers))
+		subject.clients.Add(newClient(&mockConn{Port: 10004}, testBuffers, testBuffers))
 		subject.clients.Cmd(c1.ID(), "get")
 	})
 
@@ -36,7 +37,7 @@ var _ = Describe("ServerInfo", func() {
 	It("should retrieve a list of clients", func() {
 		stats := subject.ClientInfo()
 		Expect(stats).To(HaveLen(3))
-		Expect(stats[0].String()).To(MatchRegexp(`id=\d+ addr=1\.2\.3\.4\:10001 age=\d+ idle=\d+ cmd=get`))
+		Expect(stats[0].String()).To(MatchRegexp(`id=\d+ addr=1\.2\.3\.4\:10001 laddr=127\.0\.0\.1:9736 age=\d+ idle=\d+ cmd=get`))
 	})
 
 })
@@ -44,11 +45,18 @@ var _ = Describe("ServerInfo", func() {
 var _ = Describe("ClientInfo", func() {
 
 	It("should init", func() {
-		c := newClient(&mockConn{Port: 10001})
+		c := newClient(&mockConn{Port: 10001}, testBuffers, testBuffers)
 		c.id = 12
 
 		info := newClientInfo(c, time.Now().Add(-3*time.Second))
-		Expect(info.String()).To(Equal(`id=12 addr=1.2.3.4:10001 age=3 idle=3 cmd=`))
+		Expect(info.String()).To(Equal(`id=12 addr=1.2.3.4:10001 laddr=127.0.0.1:9736 age=3 idle=3 cmd=`))
+	})
+
+	It("should format unix socket addresses", func() {
+		laddr := &net.UnixAddr{Name: "/tmp/redeo.sock", Net: "unix"}
+		Expect(addrString(laddr, nil)).To(Equal("/tmp/redeo.sock:0"))
+		Expect(addrString(&net.UnixAddr{Net: "unix"}, laddr)).To(Equal("/tmp/redeo.sock:0"))
+		Expect(addrString(&net.TCPAddr{IP: net.IP{1, 2, 3, 4}, Port: 6379}, laddr)).To(Equal("1.2.3.4:6379"))
 	})
 
 })
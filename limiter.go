@@ -0,0 +1,152 @@
+package redeo
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// Limiter limits the number of concurrently executing commands. Commands
+// exceeding the limit are queued for up to the configured timeout, before
+// they are rejected with a BUSY error.
+//
+// Limiters can be assigned to commands via CommandDescription.Limiter or to
+// entire categories of commands via Server.LimitCategory. A single limiter
+// may be shared by multiple commands. Limiters are reported in the
+// "Concurrency" section of the server info.
+type Limiter struct {
+	name    string
+	timeout time.Duration
+	slots   chan struct{}
+
+	queued   int64 // currently waiting
+	waits    int64 // total number of waits
+	waitTime int64 // total wait time in ns
+	rejected int64 // total number of rejections
+}
+
+// NewLimiter creates a new limiter, permitting up to limit concurrent
+// commands. Excess commands wait for up to timeout for a slot to become
+// available. A zero timeout rejects excess commands immediately.
+func NewLimiter(name string, limit int, timeout time.Duration) *Limiter {
+	if limit < 1 {
+		limit = 1
+	}
+	return &Limiter{
+		name:    name,
+		timeout: timeout,
+		slots:   make(chan struct{}, limit),
+	}
+}
+
+// Name returns the limiter name.
+func (l *Limiter) Name() string { return l.name }
+
+// Limit returns the maximum number of concurrent commands.
+func (l *Limiter) Limit() int { return cap(l.slots) }
+
+// Active returns the number of currently executing commands.
+func (l *Limiter) Active() int { return len(l.slots) }
+
+// Queued returns the number of commands currently waiting for a slot.
+func (l *Limiter) Queued() int64 { return atomic.LoadInt64(&l.queued) }
+
+// Rejected returns the total number of rejected commands.
+func (l *Limiter) Rejected() int64 { return atomic.LoadInt64(&l.rejected) }
+
+// AvgWait returns the average time commands have spent waiting in the queue.
+func (l *Limiter) AvgWait() time.Duration {
+	if n := atomic.LoadInt64(&l.waits); n != 0 {
+		return time.Duration(atomic.LoadInt64(&l.waitTime) / n)
+	}
+	return 0
+}
+
+// String returns the info string.
+func (l *Limiter) String() string {
+	return fmt.Sprintf("limit=%d,active=%d,queued=%d,waits=%d,avg_wait_usec=%d,rejected=%d",
+		l.Limit(),
+		l.Active(),
+		l.Queued(),
+		atomic.LoadInt64(&l.waits),
+		l.AvgWait()/time.Microsecond,
+		l.Rejected(),
+	)
+}
+
+// acquire acquires a slot, waiting up to the configured timeout.
+func (l *Limiter) acquire(ctx context.Context) bool {
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	default:
+	}
+
+	if l.timeout <= 0 {
+		atomic.AddInt64(&l.rejected, 1)
+		return false
+	}
+
+	atomic.AddInt64(&l.queued, 1)
+	start := time.Now()
+	timer := time.NewTimer(l.timeout)
+	defer timer.Stop()
+
+	ok := false
+	select {
+	case l.slots <- struct{}{}:
+		ok = true
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+
+	atomic.AddInt64(&l.queued, -1)
+	atomic.AddInt64(&l.waits, 1)
+	atomic.AddInt64(&l.waitTime, int64(time.Since(start)))
+	if !ok {
+		atomic.AddInt64(&l.rejected, 1)
+	}
+	return ok
+}
+
+func (l *Limiter) release() { <-l.slots }
+
+// --------------------------------------------------------------------
+
+type limiters []*Limiter
+
+// acquire acquires slots from all limiters or none.
+func (ll limiters) acquire(ctx context.Context) bool {
+	for i, l := range ll {
+		if !l.acquire(ctx) {
+			ll[:i].release()
+			return false
+		}
+	}
+	return true
+}
+
+func (ll limiters) release() {
+	for _, l := range ll {
+		l.release()
+	}
+}
+
+// add adds a limiter, retaining a stable order to prevent
+// lock-order inversions between commands.
+func (ll limiters) add(l *Limiter) limiters {
+	if l == nil {
+		return ll
+	}
+	for _, x := range ll {
+		if x == l {
+			return ll
+		}
+	}
+
+	ll = append(ll, l)
+	sort.SliceStable(ll, func(i, j int) bool { return ll[i].name < ll[j].name })
+	return ll
+}
@@ -0,0 +1,152 @@
+package redeo
+
+import (
+	"context"
+	"net"
+	"time"
+
+	. "github.com/bsm/ginkgo/v2"
+	. "github.com/bsm/gomega"
+	"github.com/bsm/redeo/v2/resp"
+)
+
+var _ = Describe("Limiter", func() {
+	ctx := context.Background()
+
+	It("should reject when exhausted", func() {
+		subject := NewLimiter("test", 2, 0)
+		Expect(subject.acquire(ctx)).To(BeTrue())
+		Expect(subject.acquire(ctx)).To(BeTrue())
+		Expect(subject.acquire(ctx)).To(BeFalse())
+		Expect(subject.Active()).To(Equal(2))
+		Expect(subject.Rejected()).To(Equal(int64(1)))
+
+		subject.release()
+		Expect(subject.acquire(ctx)).To(BeTrue())
+		Expect(subject.String()).To(Equal("limit=2,active=2,queued=0,waits=0,avg_wait_usec=0,rejected=1"))
+	})
+
+	It("should queue with timeout", func() {
+		subject := NewLimiter("test", 1, time.Second)
+		Expect(subject.acquire(ctx)).To(BeTrue())
+
+		done := make(chan bool, 1)
+		go func() { done <- subject.acquire(ctx) }()
+		Eventually(subject.Queued).Should(Equal(int64(1)))
+
+		time.Sleep(5 * time.Millisecond)
+		subject.release()
+		Expect(<-done).To(BeTrue())
+		Expect(subject.Queued()).To(BeZero())
+		Expect(subject.AvgWait()).To(BeNumerically(">=", 5*time.Millisecond))
+		Expect(subject.Rejected()).To(BeZero())
+	})
+
+	It("should time out", func() {
+		subject := NewLimiter("test", 1, 5*time.Millisecond)
+		Expect(subject.acquire(ctx)).To(BeTrue())
+		Expect(subject.acquire(ctx)).To(BeFalse())
+		Expect(subject.Rejected()).To(Equal(int64(1)))
+
+		cctx, cancel := context.WithCancel(ctx)
+		cancel()
+		Expect(NewLimiter("test", 1, time.Hour).acquire(cctx)).To(BeTrue())
+		Expect(subject.acquire(cctx)).To(BeFalse())
+	})
+
+	It("should acquire multiple limiters", func() {
+		a, b := NewLimiter("a", 1, 0), NewLimiter("b", 1, 0)
+		ll := limiters(nil).add(b).add(a).add(b).add(nil)
+		Expect(ll).To(Equal(limiters{a, b}))
+
+		Expect(b.acquire(ctx)).To(BeTrue())
+		Expect(ll.acquire(ctx)).To(BeFalse())
+		Expect(a.Active()).To(BeZero())
+
+		b.release()
+		Expect(ll.acquire(ctx)).To(BeTrue())
+		Expect(a.Active()).To(Equal(1))
+		Expect(b.Active()).To(Equal(1))
+	})
+
+	Describe("Server", func() {
+		var subject *Server
+		var block chan struct{}
+
+		dial := func(lis net.Listener) (*resp.RequestWriter, resp.ResponseReader) {
+			cn, err := net.Dial("tcp", lis.Addr().String())
+			Expect(err).NotTo(HaveOccurred())
+			DeferCleanup(cn.Close)
+			return resp.NewRequestWriter(cn), resp.NewResponseReader(cn)
+		}
+
+		BeforeEach(func() {
+			block = make(chan struct{})
+			wait := func(w resp.ResponseWriter, _ *resp.Command) {
+				<-block
+				w.AppendOK()
+			}
+
+			subject = NewServer(nil)
+			subject.HandleFunc("wait", wait, CommandDescription{Limiter: NewLimiter("wait", 1, 0)})
+			subject.HandleFunc("slow", wait, CommandDescription{ACLCategories: []string{"@slow"}})
+			subject.HandleFunc("ping", func(w resp.ResponseWriter, _ *resp.Command) {
+				w.AppendInlineString("PONG")
+			}, CommandDescription{Flags: []string{"fast"}})
+		})
+
+		It("should reply BUSY", func() {
+			lis, err := net.Listen("tcp", "127.0.0.1:0")
+			Expect(err).NotTo(HaveOccurred())
+			go func() { _ = subject.Serve(lis) }()
+			DeferCleanup(subject.Shutdown)
+
+			w1, r1 := dial(lis)
+			w1.WriteCmdString("WAIT")
+			Expect(w1.Flush()).To(Succeed())
+			Eventually(subject.Info().String).Should(ContainSubstring("limiter_wait:limit=1,active=1,"))
+
+			w2, r2 := dial(lis)
+			w2.WriteCmdString("WAIT", "x")
+			w2.WriteCmdString("PING")
+			Expect(w2.Flush()).To(Succeed())
+			Expect(r2.ReadError()).To(Equal("BUSY too many concurrent 'WAIT' commands, try again later"))
+			Expect(r2.ReadInlineString()).To(Equal("PONG"))
+
+			close(block)
+			Expect(r1.ReadInlineString()).To(Equal("OK"))
+			Expect(subject.Info().Find("Concurrency").String()).To(Equal("# Concurrency\n" +
+				"limiter_wait:limit=1,active=0,queued=0,waits=0,avg_wait_usec=0,rejected=1\n"))
+		})
+
+		It("should limit categories", func() {
+			subject.LimitCategory("@slow", NewLimiter("slow", 1, time.Second))
+			subject.LimitCategory("fast", NewLimiter("fast", 1, 0))
+			subject.LimitCategory("fast", nil)
+
+			lis, err := net.Listen("tcp", "127.0.0.1:0")
+			Expect(err).NotTo(HaveOccurred())
+			go func() { _ = subject.Serve(lis) }()
+			DeferCleanup(subject.Shutdown)
+
+			w1, r1 := dial(lis)
+			w1.WriteCmdString("SLOW")
+			Expect(w1.Flush()).To(Succeed())
+
+			w2, r2 := dial(lis)
+			w2.WriteCmdString("SLOW")
+			Expect(w2.Flush()).To(Succeed())
+			Eventually(subject.Info().String).Should(ContainSubstring("limiter_slow:limit=1,active=1,queued=1,"))
+
+			w3, r3 := dial(lis)
+			w3.WriteCmdString("PING")
+			Expect(w3.Flush()).To(Succeed())
+			Expect(r3.ReadInlineString()).To(Equal("PONG"))
+
+			close(block)
+			Expect(r1.ReadInlineString()).To(Equal("OK"))
+			Expect(r2.ReadInlineString()).To(Equal("OK"))
+			Expect(subject.Info().String()).To(ContainSubstring("limiter_slow:limit=1,active=0,queued=0,waits=1,"))
+		})
+	})
+})
@@ -0,0 +1,174 @@
+package redeo
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/bsm/redeo/v2/resp"
+)
+
+// Observer instances can be registered with a server to observe the processing
+// of pipelines and commands, i.e. for tracing or metrics collection.
+type Observer interface {
+	// ObservePipeline is called before a client pipeline is processed. It may
+	// return a derived context, which becomes the parent of all commands within
+	// the pipeline. The returned func is called once the pipeline has been
+	// processed, with the protocol or I/O error that terminated it, if any.
+	ObservePipeline(ctx context.Context, c *Client) (context.Context, func(err error))
+
+	// ObserveCommand is called before a command is dispatched to its handler.
+	// It may return a derived context, which is passed to the handler via
+	// Command.Context(). The returned func is called after the handler has
+	// completed, with the message of the error reply, if any. Errors nested
+	// within array or map replies are not reported.
+	ObserveCommand(ctx context.Context, c *Client, name string, argc int) (context.Context, func(errMsg string))
+}
+
+// --------------------------------------------------------------------
+
+// errorRecorder wraps a resp.ResponseWriter and records top-level error
+// replies. Errors nested within arrays or maps are not recorded.
+type errorRecorder struct {
+	resp.ResponseWriter
+	msg    string
+	nested []int // pending elements of nested aggregates, -1 if streamed
+}
+
+func (w *errorRecorder) reset(rw resp.ResponseWriter) {
+	*w = errorRecorder{ResponseWriter: rw, nested: w.nested[:0]}
+}
+
+// element counts an appended element, which may start a nested
+// aggregate of n elements.
+func (w *errorRecorder) element(n int) {
+	if i := len(w.nested) - 1; i >= 0 && w.nested[i] > 0 {
+		if w.nested[i]--; w.nested[i] == 0 {
+			w.nested = w.nested[:i]
+		}
+	}
+	if n > 0 {
+		w.nested = append(w.nested, n)
+	}
+}
+
+// Write implements io.Writer. Raw writes, including arrays collected by
+// resp.NewArrayWriter, are not counted as elements. Streamed arrays, as
+// written by resp.NewStreamedArrayWriter, are tracked as nested.
+func (w *errorRecorder) Write(p []byte) (int, error) {
+	switch string(p) {
+	case "*?\r\n":
+		w.element(0)
+		w.nested = append(w.nested, -1)
+	case ".\r\n":
+		if i := len(w.nested) - 1; i >= 0 && w.nested[i] < 0 {
+			w.nested = w.nested[:i]
+		}
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// AppendArrayLen implements resp.ResponseWriter.
+func (w *errorRecorder) AppendArrayLen(n int) {
+	w.ResponseWriter.AppendArrayLen(n)
+	w.element(n)
+}
+
+// AppendMapLen implements resp.MapWriter.
+func (w *errorRecorder) AppendMapLen(n int) {
+	resp.AppendMapLen(w.ResponseWriter, n)
+	w.element(n * 2)
+}
+
+// Protocol implements resp.ProtocolWriter.
+func (w *errorRecorder) Protocol() int { return resp.Protocol(w.ResponseWriter) }
+
+// SetProtocol implements resp.ProtocolWriter.
+func (w *errorRecorder) SetProtocol(v int) {
+	if pw, ok := w.ResponseWriter.(resp.ProtocolWriter); ok {
+		pw.SetProtocol(v)
+	}
+}
+
+// AppendBulk implements resp.ResponseWriter.
+func (w *errorRecorder) AppendBulk(p []byte) {
+	w.ResponseWriter.AppendBulk(p)
+	w.element(0)
+}
+
+// AppendBulkString implements resp.ResponseWriter.
+func (w *errorRecorder) AppendBulkString(s string) {
+	w.ResponseWriter.AppendBulkString(s)
+	w.element(0)
+}
+
+// AppendInline implements resp.ResponseWriter.
+func (w *errorRecorder) AppendInline(p []byte) {
+	w.ResponseWriter.AppendInline(p)
+	w.element(0)
+}
+
+// AppendInlineString implements resp.ResponseWriter.
+func (w *errorRecorder) AppendInlineString(s string) {
+	w.ResponseWriter.AppendInlineString(s)
+	w.element(0)
+}
+
+// AppendError implements resp.ResponseWriter.
+func (w *errorRecorder) AppendError(msg string) {
+	if len(w.nested) == 0 {
+		w.msg = msg
+	}
+	w.ResponseWriter.AppendError(msg)
+	w.element(0)
+}
+
+// AppendErrorf implements resp.ResponseWriter.
+func (w *errorRecorder) AppendErrorf(pattern string, args ...interface{}) {
+	w.AppendError(fmt.Sprintf(pattern, args...))
+}
+
+// AppendInt implements resp.ResponseWriter.
+func (w *errorRecorder) AppendInt(n int64) {
+	w.ResponseWriter.AppendInt(n)
+	w.element(0)
+}
+
+// AppendNil implements resp.ResponseWriter.
+func (w *errorRecorder) AppendNil() {
+	w.ResponseWriter.AppendNil()
+	w.element(0)
+}
+
+// AppendOK implements resp.ResponseWriter.
+func (w *errorRecorder) AppendOK() {
+	w.ResponseWriter.AppendOK()
+	w.element(0)
+}
+
+// Append implements resp.ResponseWriter.
+func (w *errorRecorder) Append(v interface{}) error {
+	if err, ok := v.(error); ok {
+		msg := err.Error()
+		if !strings.HasPrefix(msg, "ERR ") {
+			msg = "ERR " + msg
+		}
+		w.AppendError(msg)
+		return nil
+	}
+	if err := w.ResponseWriter.Append(v); err != nil {
+		return err
+	}
+	w.element(0)
+	return nil
+}
+
+// CopyBulk implements resp.ResponseWriter.
+func (w *errorRecorder) CopyBulk(src io.Reader, n int64) error {
+	if err := w.ResponseWriter.CopyBulk(src, n); err != nil {
+		return err
+	}
+	w.element(0)
+	return nil
+}
@@ -0,0 +1,22 @@
+module github.com/bsm/redeo/v2/otelredeo
+
+go 1.22
+
+require (
+	github.com/bsm/ginkgo/v2 v2.5.0
+	github.com/bsm/gomega v1.20.0
+	github.com/bsm/redeo/v2 v2.0.0
+	go.opentelemetry.io/otel v1.28.0
+	go.opentelemetry.io/otel/sdk v1.28.0
+	go.opentelemetry.io/otel/trace v1.28.0
+)
+
+require (
+	github.com/go-logr/logr v1.4.2 // indirect
+	github.com/go-logr/stdr v1.2.2 // indirect
+	github.com/google/uuid v1.6.0 // indirect
+	go.opentelemetry.io/otel/metric v1.28.0 // indirect
+	golang.org/x/sys v0.21.0 // indirect
+)
+
+replace github.com/bsm/redeo/v2 => ../
@@ -0,0 +1,124 @@
+// Package otelredeo implements OpenTelemetry tracing for redeo servers.
+//
+// Each pipeline read from a client is traced as a server span, every dispatched
+// command is traced as a child span. Command spans are injected into
+// resp.Command.Context(), so handlers can create child spans of their own.
+package otelredeo
+
+import (
+	"context"
+
+	"github.com/bsm/redeo/v2"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/bsm/redeo/v2/otelredeo"
+
+// Attribute keys
+const (
+	DBSystemKey      = attribute.Key("db.system")
+	DBOperationKey   = attribute.Key("db.operation")
+	ClientIDKey      = attribute.Key("redeo.client.id")
+	ClientAddressKey = attribute.Key("client.address")
+	ArgCountKey      = attribute.Key("redeo.command.args")
+)
+
+// Options contain tracing options.
+type Options struct {
+	// TracerProvider is used to create the tracer.
+	// Default: otel.GetTracerProvider()
+	TracerProvider trace.TracerProvider
+
+	// PipelineSpanName is the name of pipeline spans.
+	// Default: "redis.pipeline"
+	PipelineSpanName string
+
+	// Attributes are added to all spans.
+	Attributes []attribute.KeyValue
+}
+
+func (o *Options) norm() *Options {
+	var oo Options
+	if o != nil {
+		oo = *o
+	}
+	if oo.TracerProvider == nil {
+		oo.TracerProvider = otel.GetTracerProvider()
+	}
+	if oo.PipelineSpanName == "" {
+		oo.PipelineSpanName = "redis.pipeline"
+	}
+	return &oo
+}
+
+// Instrument registers a tracing observer with the server.
+func Instrument(srv *redeo.Server, opt *Options) {
+	srv.Observe(NewObserver(opt))
+}
+
+// Observer implements redeo.Observer.
+type Observer struct {
+	tracer trace.Tracer
+	opt    *Options
+}
+
+// NewObserver inits a new tracing observer.
+func NewObserver(opt *Options) *Observer {
+	opt = opt.norm()
+	return &Observer{
+		tracer: opt.TracerProvider.Tracer(instrumentationName),
+		opt:    opt,
+	}
+}
+
+// ObservePipeline implements redeo.Observer.
+func (o *Observer) ObservePipeline(ctx context.Context, c *redeo.Client) (context.Context, func(error)) {
+	ctx, span := o.tracer.Start(ctx, o.opt.PipelineSpanName,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(o.clientAttrs(c)...),
+	)
+
+	return ctx, func(err error) {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}
+}
+
+// ObserveCommand implements redeo.Observer.
+func (o *Observer) ObserveCommand(ctx context.Context, c *redeo.Client, name string, argc int) (context.Context, func(string)) {
+	attrs := append(o.clientAttrs(c),
+		DBOperationKey.String(name),
+		ArgCountKey.Int(argc),
+	)
+
+	ctx, span := o.tracer.Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindInternal),
+		trace.WithAttributes(attrs...),
+	)
+
+	return ctx, func(errMsg string) {
+		if errMsg != "" {
+			span.SetStatus(codes.Error, errMsg)
+		}
+		span.End()
+	}
+}
+
+func (o *Observer) clientAttrs(c *redeo.Client) []attribute.KeyValue {
+	attrs := make([]attribute.KeyValue, 0, len(o.opt.Attributes)+5)
+	attrs = append(attrs, o.opt.Attributes...)
+	attrs = append(attrs,
+		DBSystemKey.String("redis"),
+		ClientIDKey.Int64(int64(c.ID())),
+	)
+	if addr := c.RemoteAddr(); addr != nil {
+		attrs = append(attrs, ClientAddressKey.String(addr.String()))
+	}
+	return attrs
+}
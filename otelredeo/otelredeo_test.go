@@ -0,0 +1,108 @@
+package otelredeo_test
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	. "github.com/bsm/ginkgo/v2"
+	. "github.com/bsm/gomega"
+	"github.com/bsm/redeo/v2"
+	"github.com/bsm/redeo/v2/otelredeo"
+	"github.com/bsm/redeo/v2/resp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var _ = Describe("Observer", func() {
+	var exporter *tracetest.InMemoryExporter
+	var provider *sdktrace.TracerProvider
+	var srv *redeo.Server
+
+	BeforeEach(func() {
+		exporter = tracetest.NewInMemoryExporter()
+		provider = sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
+		srv = redeo.NewServer(nil)
+		srv.Handle("ping", redeo.Ping())
+		srv.Handle("echo", redeo.Echo())
+		srv.HandleFunc("get", func(w resp.ResponseWriter, c *resp.Command) {
+			_, span := provider.Tracer("test").Start(c.Context(), "backend.lookup")
+			defer span.End()
+
+			w.AppendNil()
+		})
+		otelredeo.Instrument(srv, &otelredeo.Options{TracerProvider: provider})
+	})
+
+	AfterEach(func() {
+		Expect(provider.Shutdown(ctx)).To(Succeed())
+	})
+
+	It("should trace pipelines", func() {
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+		defer lis.Close()
+
+		go func() { _ = srv.Serve(lis) }()
+
+		cn, err := net.Dial("tcp", lis.Addr().String())
+		Expect(err).NotTo(HaveOccurred())
+		defer cn.Close()
+
+		w, r := resp.NewRequestWriter(cn), resp.NewResponseReader(cn)
+		w.WriteCmdString("PING")
+		w.WriteCmdString("ECHO")
+		w.WriteCmdString("GET", "key")
+		Expect(w.Flush()).To(Succeed())
+
+		Expect(r.ReadInlineString()).To(Equal("PONG"))
+		Expect(r.ReadError()).To(Equal("ERR wrong number of arguments for 'ECHO' command"))
+		Expect(r.ReadNil()).To(Succeed())
+
+		spans := exporter.GetSpans()
+		Expect(spans).To(HaveLen(5))
+
+		byName := make(map[string]tracetest.SpanStub, len(spans))
+		for _, s := range spans {
+			byName[s.Name] = s
+		}
+		Expect(byName).To(HaveLen(5))
+
+		pipe := byName["redis.pipeline"]
+		Expect(pipe.SpanKind).To(Equal(trace.SpanKindServer))
+		Expect(pipe.Parent.IsValid()).To(BeFalse())
+		Expect(pipe.Attributes).To(ContainElements(
+			attribute.String("db.system", "redis"),
+			attribute.Int64("redeo.client.id", int64(srv.Info().ClientInfo()[0].ID)),
+			attribute.String("client.address", cn.LocalAddr().String()),
+		))
+
+		for _, name := range []string{"PING", "ECHO", "GET"} {
+			Expect(byName[name].Parent.SpanID()).To(Equal(pipe.SpanContext.SpanID()), name)
+			Expect(byName[name].Parent.TraceID()).To(Equal(pipe.SpanContext.TraceID()), name)
+			Expect(byName[name].Attributes).To(ContainElement(attribute.String("db.operation", name)), name)
+		}
+		Expect(byName["backend.lookup"].Parent.SpanID()).To(Equal(byName["GET"].SpanContext.SpanID()))
+
+		Expect(byName["PING"].Status.Code).To(Equal(codes.Unset))
+		Expect(byName["PING"].Attributes).To(ContainElement(attribute.Int("redeo.command.args", 0)))
+		Expect(byName["GET"].Attributes).To(ContainElement(attribute.Int("redeo.command.args", 1)))
+		Expect(byName["ECHO"].Status).To(Equal(sdktrace.Status{
+			Code:        codes.Error,
+			Description: "ERR wrong number of arguments for 'ECHO' command",
+		}))
+	})
+})
+
+// --------------------------------------------------------------------
+
+var ctx = context.Background()
+
+func TestSuite(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "redeo/otelredeo")
+}
@@ -1,6 +1,7 @@
 package redeo
 
 import (
+	"sort"
 	"sync"
 	"sync/atomic"
 
@@ -11,6 +12,8 @@ import (
 // native pub/sub functionality
 type PubSubBroker struct {
 	channels map[string]*pubSubChannel
+	patterns map[string]*pubSubChannel
+	subs     map[interface{}]*pubSubState // keyed by client or writer
 	mu       sync.RWMutex
 }
 
@@ -18,17 +21,53 @@ type PubSubBroker struct {
 func NewPubSubBroker() *PubSubBroker {
 	return &PubSubBroker{
 		channels: make(map[string]*pubSubChannel),
+		patterns: make(map[string]*pubSubChannel),
+		subs:     make(map[interface{}]*pubSubState),
 	}
 }
 
 // Subscribe returns a subscribe handler
 func (b *PubSubBroker) Subscribe() Handler {
 	return HandlerFunc(func(w resp.ResponseWriter, c *resp.Command) {
-		if c.ArgN() != 1 {
+		if c.ArgN() == 0 {
 			w.AppendError(WrongNumberOfArgs(c.Name))
 			return
 		}
-		b.subscribe(c.Arg(0).String(), w)
+		client := GetClient(c.Context())
+		for _, arg := range c.Args {
+			n := b.subscribe(false, arg.String(), w, client)
+			appendSubscription(w, "subscribe", arg.String(), n)
+		}
+	})
+}
+
+// PSubscribe returns a psubscribe handler. Patterns are matched like in
+// redis, supporting '*', '?', '[...]' character classes and '\' escapes.
+func (b *PubSubBroker) PSubscribe() Handler {
+	return HandlerFunc(func(w resp.ResponseWriter, c *resp.Command) {
+		if c.ArgN() == 0 {
+			w.AppendError(WrongNumberOfArgs(c.Name))
+			return
+		}
+		client := GetClient(c.Context())
+		for _, arg := range c.Args {
+			n := b.subscribe(true, arg.String(), w, client)
+			appendSubscription(w, "psubscribe", arg.String(), n)
+		}
+	})
+}
+
+// Unsubscribe returns an unsubscribe handler
+func (b *PubSubBroker) Unsubscribe() Handler {
+	return HandlerFunc(func(w resp.ResponseWriter, c *resp.Command) {
+		b.unsubscribe(false, "unsubscribe", c.Args, w, GetClient(c.Context()))
+	})
+}
+
+// PUnsubscribe returns a punsubscribe handler
+func (b *PubSubBroker) PUnsubscribe() Handler {
+	return HandlerFunc(func(w resp.ResponseWriter, c *resp.Command) {
+		b.unsubscribe(true, "punsubscribe", c.Args, w, GetClient(c.Context()))
 	})
 }
 
@@ -50,50 +89,304 @@ func (b *PubSubBroker) Publish() Handler {
 func (b *PubSubBroker) PublishMessage(name, msg string) int64 {
 	b.mu.RLock()
 	ch, ok := b.channels[name]
+	var matches []*pubSubChannel
+	for pattern, pc := range b.patterns {
+		if matchPattern(pattern, name) {
+			matches = append(matches, pc)
+		}
+	}
 	b.mu.RUnlock()
 
+	var n int64
 	if ok {
-		return ch.Publish(name, msg)
+		n += ch.Publish(name, msg)
+	}
+	for _, pc := range matches {
+		n += pc.Publish(name, msg)
+	}
+	return n
+}
+
+// subscribe adds a subscription and returns the subscriber's total number of
+// channel and pattern subscriptions.
+func (b *PubSubBroker) subscribe(pattern bool, name string, w resp.ResponseWriter, c *Client) int {
+	channels, prefix := b.channels, ""
+	if pattern {
+		channels, prefix = b.patterns, name
+	}
+
+	b.mu.Lock()
+	ch, ok := channels[name]
+	if !ok {
+		ch = &pubSubChannel{
+			pattern:     prefix,
+			subscribers: make(map[int64]pubSubSubscriber),
+		}
+		channels[name] = ch
+	}
+
+	key := subscriberKey(w, c)
+	st, ok := b.subs[key]
+	if !ok {
+		st = newPubSubState()
+		b.subs[key] = st
+	}
+	if st.add(pattern, name) && !pattern && name == invalidateChannel && c != nil {
+		atomic.AddInt32(&c.invalidations, 1)
+	}
+	n := st.Len()
+	b.mu.Unlock()
+
+	// forget all subscriptions once the client disconnects
+	if !ok && c != nil && !c.onRelease(func() { b.forget(c) }) {
+		b.forget(c)
 	}
-	return 0
+
+	ch.Subscribe(w, c)
+	return n
 }
 
-func (b *PubSubBroker) subscribe(name string, w resp.ResponseWriter) {
+func (b *PubSubBroker) unsubscribe(pattern bool, kind string, args []resp.CommandArgument, w resp.ResponseWriter, c *Client) {
+	channels := b.channels
+	if pattern {
+		channels = b.patterns
+	}
+	key := subscriberKey(w, c)
+
+	var names []string
 	b.mu.RLock()
-	ch, ok := b.channels[name]
+	st := b.subs[key]
+	if len(args) == 0 {
+		if st != nil {
+			names = st.names(pattern)
+		}
+	} else {
+		for _, arg := range args {
+			names = append(names, arg.String())
+		}
+	}
+	n := st.Len()
 	b.mu.RUnlock()
 
-	if !ok {
+	if len(names) == 0 {
+		w.AppendArrayLen(3)
+		w.AppendBulkString(kind)
+		w.AppendNil()
+		w.AppendInt(int64(n))
+		return
+	}
+
+	for _, name := range names {
 		b.mu.Lock()
-		if ch, ok = b.channels[name]; !ok {
-			ch = &pubSubChannel{
-				subscribers: make(map[int64]resp.ResponseWriter),
+		ch, ok := channels[name]
+		if st := b.subs[key]; st != nil {
+			if st.remove(pattern, name) && !pattern && name == invalidateChannel && c != nil {
+				atomic.AddInt32(&c.invalidations, -1)
+			}
+			if n = st.Len(); n == 0 {
+				delete(b.subs, key)
 			}
-			b.channels[name] = ch
 		}
 		b.mu.Unlock()
+
+		if ok {
+			ch.Unsubscribe(w)
+		}
+		appendSubscription(w, kind, name, n)
+	}
+}
+
+// forget removes all subscriptions of a released client.
+func (b *PubSubBroker) forget(c *Client) {
+	b.mu.Lock()
+	st := b.subs[c]
+	delete(b.subs, c)
+
+	var chs []*pubSubChannel
+	if st != nil {
+		for name := range st.channels {
+			if ch, ok := b.channels[name]; ok {
+				chs = append(chs, ch)
+			}
+		}
+		for name := range st.patterns {
+			if ch, ok := b.patterns[name]; ok {
+				chs = append(chs, ch)
+			}
+		}
+	}
+	b.mu.Unlock()
+
+	for _, ch := range chs {
+		ch.unsubscribeClient(c)
 	}
+}
 
-	ch.Subscribe(w)
+func appendSubscription(w resp.ResponseWriter, kind, name string, n int) {
 	w.AppendArrayLen(3)
-	w.AppendBulkString("subscribe")
+	w.AppendBulkString(kind)
 	w.AppendBulkString(name)
-	w.AppendInt(1)
+	w.AppendInt(int64(n))
+}
+
+// subscriberKey identifies subscribers by their client or, if unknown, by
+// their writer.
+func subscriberKey(w resp.ResponseWriter, c *Client) interface{} {
+	if c != nil {
+		return c
+	}
+	return w
+}
+
+// matchPattern reports whether name matches a glob-style pattern, following
+// the semantics of redis' stringmatchlen. Unlike path.Match, '*' and '?'
+// match any character, including '/'.
+func matchPattern(pattern, name string) bool {
+	p, s := pattern, name
+	for len(p) != 0 && len(s) != 0 {
+		switch p[0] {
+		case '*':
+			for len(p) > 1 && p[1] == '*' {
+				p = p[1:]
+			}
+			if len(p) == 1 {
+				return true
+			}
+			for ; len(s) != 0; s = s[1:] {
+				if matchPattern(p[1:], s) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			p, s = p[1:], s[1:]
+		case '[':
+			p = p[1:]
+			not := len(p) != 0 && p[0] == '^'
+			if not {
+				p = p[1:]
+			}
+
+			match := false
+			for len(p) != 0 && p[0] != ']' {
+				if p[0] == '\\' && len(p) >= 2 {
+					p = p[1:]
+					match = match || p[0] == s[0]
+				} else if len(p) >= 3 && p[1] == '-' {
+					lo, hi := p[0], p[2]
+					if lo > hi {
+						lo, hi = hi, lo
+					}
+					match = match || s[0] >= lo && s[0] <= hi
+					p = p[2:]
+				} else {
+					match = match || p[0] == s[0]
+				}
+				p = p[1:]
+			}
+			if len(p) != 0 {
+				p = p[1:] // skip ']'
+			}
+			if not {
+				match = !match
+			}
+			if !match {
+				return false
+			}
+			s = s[1:]
+		case '\\':
+			if len(p) >= 2 {
+				p = p[1:]
+			}
+			fallthrough
+		default:
+			if p[0] != s[0] {
+				return false
+			}
+			p, s = p[1:], s[1:]
+		}
+
+		if len(s) == 0 {
+			for len(p) != 0 && p[0] == '*' {
+				p = p[1:]
+			}
+		}
+	}
+	return len(p) == 0 && len(s) == 0
 }
 
 // --------------------------------------------------------------------
 
+type pubSubSubscriber struct {
+	resp.ResponseWriter
+	client *Client
+}
+
+// push sends a message to the subscriber. Messages are pushed via the client,
+// if known, to prevent them from interleaving with other replies.
+func (s pubSubSubscriber) push(pattern, name, msg string) error {
+	if s.client != nil {
+		if pattern != "" {
+			return s.client.Push("pmessage", pattern, name, msg)
+		}
+		return s.client.Push("message", name, msg)
+	}
+
+	if pattern != "" {
+		s.AppendArrayLen(4)
+		s.AppendBulkString("pmessage")
+		s.AppendBulkString(pattern)
+	} else {
+		s.AppendArrayLen(3)
+		s.AppendBulkString("message")
+	}
+	s.AppendBulkString(name)
+	s.AppendBulkString(msg)
+	return s.Flush()
+}
+
 type pubSubChannel struct {
-	subscribers map[int64]resp.ResponseWriter
+	pattern     string
+	subscribers map[int64]pubSubSubscriber
 	mu          sync.RWMutex
 	nextID      int64
 }
 
-func (c *pubSubChannel) Subscribe(w resp.ResponseWriter) {
+func (c *pubSubChannel) Subscribe(w resp.ResponseWriter, client *Client) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for sid, sub := range c.subscribers {
+		if sub.ResponseWriter == w {
+			if sub.client == client {
+				return
+			}
+			// writers are reused once clients disconnect
+			delete(c.subscribers, sid)
+		}
+	}
+
 	sid := atomic.AddInt64(&c.nextID, 1)
+	c.subscribers[sid] = pubSubSubscriber{ResponseWriter: w, client: client}
+}
 
+func (c *pubSubChannel) Unsubscribe(w resp.ResponseWriter) {
 	c.mu.Lock()
-	c.subscribers[sid] = w
+	for sid, sub := range c.subscribers {
+		if sub.ResponseWriter == w {
+			delete(c.subscribers, sid)
+		}
+	}
+	c.mu.Unlock()
+}
+
+func (c *pubSubChannel) unsubscribeClient(client *Client) {
+	c.mu.Lock()
+	for sid, sub := range c.subscribers {
+		if sub.client == client {
+			delete(c.subscribers, sid)
+		}
+	}
 	c.mu.Unlock()
 }
 
@@ -102,12 +395,13 @@ func (c *pubSubChannel) Publish(name, msg string) (n int64) {
 
 	c.mu.RLock()
 	for sid, w := range c.subscribers {
-		w.AppendArrayLen(3)
-		w.AppendBulkString("message")
-		w.AppendBulkString(name)
-		w.AppendBulkString(msg)
+		// skip disconnected clients, their writers may have been reused
+		if w.client.isReleased() {
+			failed = append(failed, sid)
+			continue
+		}
 
-		if err := w.Flush(); err != nil {
+		if err := w.push(c.pattern, name, msg); err != nil {
 			failed = append(failed, sid)
 		} else {
 			n++
@@ -128,3 +422,63 @@ func (c *pubSubChannel) evict(failed []int64) {
 	}
 	c.mu.Unlock()
 }
+
+// --------------------------------------------------------------------
+
+// pubSubState contains the channels and patterns of a subscriber.
+type pubSubState struct {
+	channels map[string]struct{}
+	patterns map[string]struct{}
+}
+
+func newPubSubState() *pubSubState {
+	return &pubSubState{
+		channels: make(map[string]struct{}),
+		patterns: make(map[string]struct{}),
+	}
+}
+
+// Len returns the total number of subscriptions.
+func (s *pubSubState) Len() int {
+	if s == nil {
+		return 0
+	}
+	return len(s.channels) + len(s.patterns)
+}
+
+func (s *pubSubState) set(pattern bool) map[string]struct{} {
+	if pattern {
+		return s.patterns
+	}
+	return s.channels
+}
+
+// add adds a subscription and returns true if it is new.
+func (s *pubSubState) add(pattern bool, name string) bool {
+	set := s.set(pattern)
+	if _, ok := set[name]; ok {
+		return false
+	}
+	set[name] = struct{}{}
+	return true
+}
+
+// remove removes a subscription and returns true if it existed.
+func (s *pubSubState) remove(pattern bool, name string) bool {
+	set := s.set(pattern)
+	if _, ok := set[name]; !ok {
+		return false
+	}
+	delete(set, name)
+	return true
+}
+
+func (s *pubSubState) names(pattern bool) []string {
+	set := s.set(pattern)
+	names := make([]string, 0, len(set))
+	for name := range set {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -1,6 +1,9 @@
 package redeo
 
 import (
+	"bufio"
+	"net"
+
 	. "github.com/bsm/ginkgo/v2"
 	. "github.com/bsm/gomega"
 	"github.com/bsm/redeo/v2/redeotest"
@@ -63,4 +66,135 @@ var _ = Describe("PubSubBroker", func() {
 		}))
 	})
 
+	var responses = func(w *redeotest.ResponseRecorder) []interface{} {
+		vv, err := w.Responses()
+		Expect(err).NotTo(HaveOccurred())
+		return vv
+	}
+
+	It("should subscribe to multiple channels and patterns", func() {
+		sub := redeotest.NewRecorder()
+		subject.Subscribe().ServeRedeo(sub, resp.NewCommand("subscribe", resp.CommandArgument("a"), resp.CommandArgument("b")))
+		subject.PSubscribe().ServeRedeo(sub, resp.NewCommand("psubscribe", resp.CommandArgument("a*")))
+		Expect(sub.Responses()).To(Equal([]interface{}{
+			[]interface{}{"subscribe", "a", int64(1)},
+			[]interface{}{"subscribe", "b", int64(2)},
+			[]interface{}{"psubscribe", "a*", int64(3)},
+		}))
+
+		Expect(publish("a", "msg1")).To(Equal(int64(2)))
+		Expect(publish("ab", "msg2")).To(Equal(int64(1)))
+		Expect(responses(sub)[3:]).To(Equal([]interface{}{
+			[]interface{}{"message", "a", "msg1"},
+			[]interface{}{"pmessage", "a*", "a", "msg1"},
+			[]interface{}{"pmessage", "a*", "ab", "msg2"},
+		}))
+	})
+
+	It("should count subscriptions per subscriber", func() {
+		sub := redeotest.NewRecorder()
+		subject.Subscribe().ServeRedeo(sub, resp.NewCommand("subscribe", resp.CommandArgument("a"), resp.CommandArgument("a")))
+		subject.PSubscribe().ServeRedeo(sub, resp.NewCommand("psubscribe", resp.CommandArgument("a")))
+		subject.Unsubscribe().ServeRedeo(sub, resp.NewCommand("unsubscribe", resp.CommandArgument("x")))
+		subject.Unsubscribe().ServeRedeo(redeotest.NewRecorder(), resp.NewCommand("unsubscribe", resp.CommandArgument("a")))
+		subject.PUnsubscribe().ServeRedeo(sub, resp.NewCommand("punsubscribe"))
+		Expect(responses(sub)).To(Equal([]interface{}{
+			[]interface{}{"subscribe", "a", int64(1)},
+			[]interface{}{"subscribe", "a", int64(1)},
+			[]interface{}{"psubscribe", "a", int64(2)},
+			[]interface{}{"unsubscribe", "x", int64(2)},
+			[]interface{}{"punsubscribe", "a", int64(1)},
+		}))
+	})
+
+	It("should match patterns like redis", func() {
+		for _, tc := range []struct {
+			pattern, name string
+			match         bool
+		}{
+			{"*", "a/b", true},
+			{"a*", "a/b/c", true},
+			{"a?c", "a/c", true},
+			{"a*c", "abbbc", true},
+			{"a*c", "abbbd", false},
+			{"a**", "a", true},
+			{"h[ae]llo", "hello", true},
+			{"h[ae]llo", "hillo", false},
+			{"h[^e]llo", "hallo", true},
+			{"h[^e]llo", "hello", false},
+			{"h[a-b]llo", "hbllo", true},
+			{"h[b-a]llo", "hallo", true},
+			{"h[a-b]llo", "hcllo", false},
+			{"h\\*llo", "h*llo", true},
+			{"h\\*llo", "hello", false},
+			{"h[\\]]llo", "h]llo", true},
+			{"news.*", "news.art.figurative", true},
+			{"*", "", false},
+			{"", "", true},
+		} {
+			Expect(matchPattern(tc.pattern, tc.name)).To(Equal(tc.match), "%q ~ %q", tc.pattern, tc.name)
+		}
+	})
+
+	It("should unsubscribe", func() {
+		sub := redeotest.NewRecorder()
+		subject.Subscribe().ServeRedeo(sub, resp.NewCommand("subscribe", resp.CommandArgument("a"), resp.CommandArgument("b")))
+		subject.PSubscribe().ServeRedeo(sub, resp.NewCommand("psubscribe", resp.CommandArgument("a*")))
+
+		subject.Unsubscribe().ServeRedeo(sub, resp.NewCommand("unsubscribe", resp.CommandArgument("a")))
+		Expect(publish("a", "msg")).To(Equal(int64(1)))
+		Expect(publish("b", "msg")).To(Equal(int64(1)))
+
+		subject.PUnsubscribe().ServeRedeo(sub, resp.NewCommand("punsubscribe"))
+		Expect(publish("a", "msg")).To(Equal(int64(0)))
+
+		subject.Unsubscribe().ServeRedeo(sub, resp.NewCommand("unsubscribe"))
+		subject.Unsubscribe().ServeRedeo(sub, resp.NewCommand("unsubscribe"))
+		Expect(publish("b", "msg")).To(Equal(int64(0)))
+		Expect(responses(sub)[3:]).To(Equal([]interface{}{
+			[]interface{}{"unsubscribe", "a", int64(2)},
+			[]interface{}{"pmessage", "a*", "a", "msg"},
+			[]interface{}{"message", "b", "msg"},
+			[]interface{}{"punsubscribe", "a*", int64(1)},
+			[]interface{}{"unsubscribe", "b", int64(0)},
+			[]interface{}{"unsubscribe", nil, int64(0)},
+		}))
+	})
+
+	It("should forget subscriptions of disconnected clients", func() {
+		srv := NewServer(nil)
+		srv.Handle("subscribe", subject.Subscribe())
+		srv.Handle("psubscribe", subject.PSubscribe())
+
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+		go func(srv *Server, lis net.Listener) { _ = srv.Serve(lis) }(srv, lis)
+		DeferCleanup(srv.Shutdown)
+
+		cn, err := net.Dial("tcp", lis.Addr().String())
+		Expect(err).NotTo(HaveOccurred())
+
+		w := resp.NewRequestWriter(cn)
+		w.WriteCmdString("SUBSCRIBE", "a")
+		w.WriteCmdString("PSUBSCRIBE", "b*")
+		Expect(w.Flush()).To(Succeed())
+
+		r := resp.NewResponseReader(bufio.NewReader(cn))
+		for i := 1; i <= 2; i++ {
+			var kind, name string
+			var n int64
+			Expect(r.ReadArrayLen()).To(Equal(3))
+			Expect(r.Scan(&kind, &name, &n)).To(Succeed())
+			Expect(n).To(Equal(int64(i)))
+		}
+		Expect(publish("a", "msg")).To(Equal(int64(1)))
+
+		Expect(cn.Close()).To(Succeed())
+		Eventually(func() int {
+			subject.mu.RLock()
+			defer subject.mu.RUnlock()
+			return len(subject.subs)
+		}).Should(Equal(0))
+		Eventually(func() int64 { return publish("a", "msg") + publish("bc", "msg") }).Should(Equal(int64(0)))
+	})
 })
@@ -0,0 +1,121 @@
+package redeo
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/bsm/redeo/v2/resp"
+)
+
+// ErrClientClosed is returned when pushing to disconnected clients.
+var ErrClientClosed = errors.New("redeo: client closed")
+
+// pushBufferSize is the initial buffer size used to encode push messages.
+const pushBufferSize = 256
+
+// Protocol returns the protocol version negotiated by the client, either 2
+// or 3. Clients use RESP2 unless a different version is set via SetProtocol.
+func (c *Client) Protocol() int {
+	if v := atomic.LoadInt32(&c.proto); v != 0 {
+		return int(v)
+	}
+	return 2
+}
+
+// SetProtocol sets the protocol version, typically from within a HELLO
+// handler. Clients speaking RESP3 receive out-of-band messages as push types
+// and replies encoded via resp.AppendMapLen as maps.
+func (c *Client) SetProtocol(v int) {
+	atomic.StoreInt32(&c.proto, int32(v))
+	if pw, ok := c.wr.(resp.ProtocolWriter); ok {
+		pw.SetProtocol(v)
+	}
+}
+
+// Push sends an out-of-band message, consisting of the given elements, to the
+// client. Messages are sent as RESP3 push types or as plain arrays to RESP2
+// clients. It is safe to call Push from any goroutine, messages are only ever
+// interleaved between complete replies.
+//
+// Messages are written immediately when the client is idle, or queued until the
+// reply to the command currently being served is complete.
+func (c *Client) Push(v ...interface{}) error {
+	msg, err := encodePush(c.Protocol(), v)
+	if err != nil {
+		return err
+	}
+	return c.pushRaw(msg)
+}
+
+// pushRaw sends pre-encoded data, following the same rules as Push.
+func (c *Client) pushRaw(msg []byte) error {
+	c.pmu.Lock()
+	defer c.pmu.Unlock()
+
+	if c.isReleased() {
+		return ErrClientClosed
+	}
+	if c.serving {
+		c.pushes = append(c.pushes, msg...)
+		return nil
+	}
+	return c.writePushes(msg)
+}
+
+// beginReply marks the start of a reply, deferring all pushes.
+func (c *Client) beginReply() {
+	c.pmu.Lock()
+	c.serving = true
+	c.pmu.Unlock()
+}
+
+// endReply marks the end of a reply and writes queued pushes.
+func (c *Client) endReply() error {
+	c.pmu.Lock()
+	defer c.pmu.Unlock()
+
+	c.serving = false
+	if len(c.pushes) == 0 {
+		return nil
+	}
+
+	err := c.writePushes(c.pushes)
+	c.pushes = c.pushes[:0]
+	return err
+}
+
+// writePushes writes pending replies, followed by push messages.
+func (c *Client) writePushes(msg []byte) error {
+	if err := c.wr.Flush(); err != nil {
+		return err
+	}
+	_, err := c.cn.Write(msg)
+	return err
+}
+
+func encodePush(proto int, elems []interface{}) ([]byte, error) {
+	buf := bytes.NewBuffer(make([]byte, 0, pushBufferSize))
+	if proto >= 3 {
+		buf.WriteByte('>')
+	} else {
+		buf.WriteByte('*')
+	}
+	buf.WriteString(strconv.Itoa(len(elems)))
+	buf.WriteString("\r\n")
+
+	w := resp.NewResponseWriterSize(buf, pushBufferSize)
+	if pw, ok := w.(resp.ProtocolWriter); ok {
+		pw.SetProtocol(proto)
+	}
+	for _, v := range elems {
+		if err := w.Append(v); err != nil {
+			return nil, err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
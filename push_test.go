@@ -0,0 +1,197 @@
+package redeo
+
+import (
+	"bufio"
+	"net"
+	"sync"
+
+	. "github.com/bsm/ginkgo/v2"
+	. "github.com/bsm/gomega"
+	"github.com/bsm/redeo/v2/resp"
+)
+
+var _ = Describe("Push", func() {
+	var subject *Server
+	var clients chan *Client
+
+	dial := func() (net.Conn, *resp.RequestWriter) {
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+		go func() { _ = subject.Serve(lis) }()
+		DeferCleanup(subject.Shutdown)
+
+		cn, err := net.Dial("tcp", lis.Addr().String())
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(cn.Close)
+		return cn, resp.NewRequestWriter(cn)
+	}
+
+	BeforeEach(func() {
+		clients = make(chan *Client, 1)
+
+		subject = NewServer(nil)
+		subject.HandleFunc("hello", func(w resp.ResponseWriter, c *resp.Command) {
+			client := GetClient(c.Context())
+			if c.ArgN() != 0 {
+				client.SetProtocol(3)
+			}
+			clients <- client
+			w.AppendOK()
+		})
+		subject.HandleFunc("list", func(w resp.ResponseWriter, c *resp.Command) {
+			client := GetClient(c.Context())
+			w.AppendArrayLen(2)
+			w.AppendBulkString("a")
+			Expect(client.Push("inner")).To(Succeed())
+			w.AppendBulkString("b")
+		})
+	})
+
+	It("should encode messages", func() {
+		msg, err := encodePush(2, []interface{}{"message", "chan", int64(1)})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(msg)).To(Equal("*3\r\n$7\r\nmessage\r\n$4\r\nchan\r\n:1\r\n"))
+
+		msg, err = encodePush(3, []interface{}{"invalidate", []string{"key"}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(msg)).To(Equal(">2\r\n$10\r\ninvalidate\r\n*1\r\n$3\r\nkey\r\n"))
+
+		msg, err = encodePush(3, []interface{}{"message", map[string]int{"a": 1}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(msg)).To(Equal(">2\r\n$7\r\nmessage\r\n%1\r\n$1\r\na\r\n:1\r\n"))
+
+		_, err = encodePush(2, []interface{}{make(chan int)})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should push to idle clients", func() {
+		cn, w := dial()
+		rd := bufio.NewReader(cn)
+		readMessage := func() (s string) {
+			for i := 0; i < 7; i++ {
+				line, err := rd.ReadString('\n')
+				Expect(err).NotTo(HaveOccurred())
+				s += line
+			}
+			return
+		}
+
+		w.WriteCmdString("HELLO")
+		Expect(w.Flush()).To(Succeed())
+		client := <-clients
+		Expect(client.Protocol()).To(Equal(2))
+		Expect(rd.ReadString('\n')).To(Equal("+OK\r\n"))
+
+		Expect(client.Push("message", "chan", "x")).To(Succeed())
+		Expect(readMessage()).To(Equal("*3\r\n$7\r\nmessage\r\n$4\r\nchan\r\n$1\r\nx\r\n"))
+
+		w.WriteCmdString("HELLO", "3")
+		Expect(w.Flush()).To(Succeed())
+		Expect(<-clients).To(Equal(client))
+		Expect(client.Protocol()).To(Equal(3))
+		Expect(rd.ReadString('\n')).To(Equal("+OK\r\n"))
+
+		Expect(client.Push("message", "chan", "y")).To(Succeed())
+		Expect(readMessage()).To(Equal(">3\r\n$7\r\nmessage\r\n$4\r\nchan\r\n$1\r\ny\r\n"))
+	})
+
+	It("should reply with maps to RESP3 clients", func() {
+		subject.HandleFunc("map", func(w resp.ResponseWriter, c *resp.Command) {
+			_ = w.Append(map[string]int{"a": 1})
+		})
+
+		cn, w := dial()
+		rd := bufio.NewReader(cn)
+		w.WriteCmdString("MAP")
+		w.WriteCmdString("HELLO", "3")
+		w.WriteCmdString("MAP")
+		Expect(w.Flush()).To(Succeed())
+		<-clients
+
+		var lines []string
+		for i := 0; i < 9; i++ {
+			line, err := rd.ReadString('\n')
+			Expect(err).NotTo(HaveOccurred())
+			lines = append(lines, line)
+		}
+		Expect(lines).To(Equal([]string{
+			"*2\r\n", "$1\r\n", "a\r\n", ":1\r\n",
+			"+OK\r\n",
+			"%1\r\n", "$1\r\n", "a\r\n", ":1\r\n",
+		}))
+	})
+
+	It("should defer pushes until replies are complete", func() {
+		cn, w := dial()
+		rd := resp.NewResponseReader(cn)
+
+		w.WriteCmdString("LIST")
+		w.WriteCmdString("LIST")
+		Expect(w.Flush()).To(Succeed())
+
+		for i := 0; i < 2; i++ {
+			Expect(rd.ReadArrayLen()).To(Equal(2))
+			Expect(rd.ReadBulkString()).To(Equal("a"))
+			Expect(rd.ReadBulkString()).To(Equal("b"))
+			Expect(rd.ReadArrayLen()).To(Equal(1))
+			Expect(rd.ReadBulkString()).To(Equal("inner"))
+		}
+	})
+
+	It("should interleave concurrent pushes", func() {
+		cn, w := dial()
+		rd := resp.NewResponseReader(cn)
+
+		w.WriteCmdString("HELLO")
+		Expect(w.Flush()).To(Succeed())
+		client := <-clients
+		Expect(rd.ReadInlineString()).To(Equal("OK"))
+
+		var wg sync.WaitGroup
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func() {
+				defer GinkgoRecover()
+				defer wg.Done()
+
+				for j := 0; j < 50; j++ {
+					Expect(client.Push("message", "chan", "x")).To(Succeed())
+				}
+			}()
+		}
+		for i := 0; i < 50; i++ {
+			w.WriteCmdString("LIST")
+		}
+		Expect(w.Flush()).To(Succeed())
+
+		replies, pushes := 0, 0
+		for replies < 50 || pushes < 250 {
+			n, err := rd.ReadArrayLen()
+			Expect(err).NotTo(HaveOccurred())
+
+			switch n {
+			case 1:
+				Expect(rd.ReadBulkString()).To(Equal("inner"))
+				pushes++
+			case 2:
+				Expect(rd.ReadBulkString()).To(Equal("a"))
+				Expect(rd.ReadBulkString()).To(Equal("b"))
+				replies++
+			case 3:
+				Expect(rd.ReadBulkString()).To(Equal("message"))
+				Expect(rd.ReadBulkString()).To(Equal("chan"))
+				Expect(rd.ReadBulkString()).To(Equal("x"))
+				pushes++
+			default:
+				Fail("unexpected array length")
+			}
+		}
+		wg.Wait()
+	})
+
+	It("should fail on closed clients", func() {
+		client := newClient(&mockConn{}, testBuffers, testBuffers)
+		client.release()
+		Expect(client.Push("message")).To(MatchError(ErrClientClosed))
+	})
+})
@@ -0,0 +1,277 @@
+package redeo
+
+import (
+	"context"
+	"math"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// RateLimitScope determines how rate limits are applied.
+type RateLimitScope int
+
+// Supported rate limit scopes.
+const (
+	// RateLimitPerClient limits each client connection, keyed by client ID.
+	RateLimitPerClient RateLimitScope = iota
+	// RateLimitPerIP limits all connections from a remote IP.
+	RateLimitPerIP
+	// RateLimitPerUser limits all connections of a user, see Client.SetUser.
+	// Clients without a user are limited as user "default".
+	RateLimitPerUser
+	// RateLimitPerCommand limits all calls of a command, keyed by
+	// the lowercase command name.
+	RateLimitPerCommand
+
+	numRateLimitScopes
+)
+
+// defaultRateLimitError is the default reply for rejected calls.
+const defaultRateLimitError = "ERR rate limit exceeded"
+
+// rateLimitPruneSize is the number of buckets per scope, above which
+// full buckets are pruned.
+const rateLimitPruneSize = 4096
+
+// RateLimit is a token-bucket rate limit.
+type RateLimit struct {
+	// Rate is the number of permitted calls per second.
+	Rate float64
+
+	// Burst is the maximum number of calls permitted at once.
+	// Default: Rate (at least 1)
+	Burst int
+
+	// MaxDelay permits calls exceeding the limit to be delayed, instead
+	// of being rejected, as long as the delay is within MaxDelay.
+	// Default: 0 (reject immediately)
+	MaxDelay time.Duration
+
+	// Error is the error reply sent for rejected calls.
+	// Default: "ERR rate limit exceeded"
+	Error string
+}
+
+func (l *RateLimit) burst() float64 {
+	if l.Burst > 0 {
+		return float64(l.Burst)
+	}
+	return math.Max(1, l.Rate)
+}
+
+func (l *RateLimit) errorString() string {
+	if l.Error != "" {
+		return l.Error
+	}
+	return defaultRateLimitError
+}
+
+// SetRateLimit sets a rate limit for the given scope. The key identifies the
+// client ID, IP, user or command name the limit applies to, an empty key sets
+// the default for the scope. Limits are checked before handlers are invoked
+// and may be changed at any time, pass a nil limit to remove it.
+func (srv *Server) SetRateLimit(scope RateLimitScope, key string, limit *RateLimit) {
+	srv.rates.Set(scope, key, limit)
+}
+
+// --------------------------------------------------------------------
+
+type rateLimits struct {
+	limits  [numRateLimitScopes]map[string]*RateLimit
+	buckets [numRateLimitScopes]map[string]*rateBucket
+	mu      sync.Mutex
+
+	// configured is the number of limits, calls are not checked
+	// unless limits are configured
+	configured int32
+}
+
+func (r *rateLimits) Set(scope RateLimitScope, key string, limit *RateLimit) {
+	if scope < 0 || scope >= numRateLimitScopes {
+		return
+	}
+
+	var copied *RateLimit
+	if limit != nil {
+		x := *limit
+		copied = &x
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if copied != nil {
+		if r.limits[scope] == nil {
+			r.limits[scope] = make(map[string]*RateLimit)
+		}
+		r.limits[scope][key] = copied
+	} else {
+		delete(r.limits[scope], key)
+	}
+
+	// reset buckets of the scope
+	r.buckets[scope] = nil
+
+	n := 0
+	for _, limits := range r.limits {
+		n += len(limits)
+	}
+	atomic.StoreInt32(&r.configured, int32(n))
+}
+
+// Take takes a token from all applicable buckets. It returns the delay
+// the call must wait for or, if the call is rejected, the violated limit.
+func (r *rateLimits) Take(c *Client, cmd string, now time.Time) (time.Duration, *RateLimit) {
+	if atomic.LoadInt32(&r.configured) == 0 {
+		return 0, nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var delay time.Duration
+	var taken [numRateLimitScopes]*rateBucket
+	for scope := RateLimitScope(0); scope < numRateLimitScopes; scope++ {
+		if len(r.limits[scope]) == 0 {
+			continue
+		}
+
+		key := rateLimitKey(scope, c, cmd)
+		limit, ok := r.limits[scope][key]
+		if !ok {
+			if limit, ok = r.limits[scope][""]; !ok {
+				continue
+			}
+		}
+
+		b := r.bucket(scope, key, limit, now)
+		d, ok := b.Take(limit, now)
+		if !ok {
+			for _, t := range taken {
+				if t != nil {
+					t.tokens++
+				}
+			}
+			return 0, limit
+		}
+		if d > delay {
+			delay = d
+		}
+		taken[scope] = b
+	}
+	return delay, nil
+}
+
+// Forget removes the buckets of a disconnected client.
+func (r *rateLimits) Forget(c *Client) {
+	if atomic.LoadInt32(&r.configured) == 0 {
+		return
+	}
+
+	r.mu.Lock()
+	delete(r.buckets[RateLimitPerClient], strconv.FormatUint(c.id, 10))
+	r.mu.Unlock()
+}
+
+func (r *rateLimits) bucket(scope RateLimitScope, key string, limit *RateLimit, now time.Time) *rateBucket {
+	buckets := r.buckets[scope]
+	if b, ok := buckets[key]; ok {
+		return b
+	}
+
+	if buckets == nil {
+		buckets = make(map[string]*rateBucket)
+		r.buckets[scope] = buckets
+	} else if len(buckets) >= rateLimitPruneSize {
+		for k, b := range buckets {
+			if b.Full(now) {
+				delete(buckets, k)
+			}
+		}
+	}
+
+	b := &rateBucket{limit: limit, tokens: limit.burst(), last: now}
+	buckets[key] = b
+	return b
+}
+
+func rateLimitKey(scope RateLimitScope, c *Client, cmd string) string {
+	switch scope {
+	case RateLimitPerClient:
+		return strconv.FormatUint(c.id, 10)
+	case RateLimitPerIP:
+		if addr := c.RemoteAddr(); addr != nil {
+			if host, _, err := net.SplitHostPort(addr.String()); err == nil {
+				return host
+			}
+			return addr.String()
+		}
+	case RateLimitPerUser:
+		if user := c.User(); user != "" {
+			return user
+		}
+		return "default"
+	case RateLimitPerCommand:
+		return cmd
+	}
+	return ""
+}
+
+// waitRateLimit waits for the delay or until the context is cancelled.
+func waitRateLimit(ctx context.Context, delay time.Duration) {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+}
+
+// --------------------------------------------------------------------
+
+type rateBucket struct {
+	limit  *RateLimit
+	tokens float64
+	last   time.Time
+}
+
+// Take reserves a token, returning the delay until it becomes available.
+// It returns false if the delay exceeds the permitted maximum.
+func (b *rateBucket) Take(limit *RateLimit, now time.Time) (time.Duration, bool) {
+	if b.limit != limit {
+		*b = rateBucket{limit: limit, tokens: limit.burst(), last: now}
+	}
+	b.refill(now)
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0, true
+	}
+	if limit.Rate <= 0 {
+		return 0, false
+	}
+
+	delay := time.Duration((1 - b.tokens) / limit.Rate * float64(time.Second))
+	if delay > limit.MaxDelay {
+		return 0, false
+	}
+	b.tokens--
+	return delay, true
+}
+
+// Full returns true if the bucket has been fully refilled.
+func (b *rateBucket) Full(now time.Time) bool {
+	b.refill(now)
+	return b.tokens >= b.limit.burst()
+}
+
+func (b *rateBucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = math.Min(b.limit.burst(), b.tokens+elapsed.Seconds()*b.limit.Rate)
+		b.last = now
+	}
+}
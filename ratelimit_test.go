@@ -0,0 +1,144 @@
+package redeo
+
+import (
+	"net"
+	"time"
+
+	. "github.com/bsm/ginkgo/v2"
+	. "github.com/bsm/gomega"
+	"github.com/bsm/redeo/v2/resp"
+)
+
+var _ = Describe("RateLimit", func() {
+	var subject *rateLimits
+	var c1, c2 *Client
+	now := time.Unix(1700000000, 0)
+
+	BeforeEach(func() {
+		subject = new(rateLimits)
+		c1 = newClient(&mockConn{}, testBuffers, testBuffers)
+		c2 = newClient(&mockConn{}, testBuffers, testBuffers)
+	})
+
+	It("should skip the lock unless limits are configured", func() {
+		subject.mu.Lock()
+		Expect(subject.Take(c1, "ping", now)).To(BeZero())
+		subject.Forget(c1)
+		subject.mu.Unlock()
+
+		subject.Set(RateLimitPerCommand, "get", &RateLimit{Rate: 1})
+		subject.Set(RateLimitPerCommand, "get", nil)
+		Expect(subject.configured).To(BeZero())
+	})
+
+	It("should permit bursts and refill", func() {
+		subject.Set(RateLimitPerClient, "", &RateLimit{Rate: 10, Burst: 2})
+
+		Expect(subject.Take(c1, "ping", now)).To(BeZero())
+		Expect(subject.Take(c1, "ping", now)).To(BeZero())
+		_, limit := subject.Take(c1, "ping", now)
+		Expect(limit).NotTo(BeNil())
+		Expect(limit.errorString()).To(Equal("ERR rate limit exceeded"))
+
+		_, limit = subject.Take(c2, "ping", now)
+		Expect(limit).To(BeNil())
+
+		_, limit = subject.Take(c1, "ping", now.Add(100*time.Millisecond))
+		Expect(limit).To(BeNil())
+		_, limit = subject.Take(c1, "ping", now.Add(100*time.Millisecond))
+		Expect(limit).NotTo(BeNil())
+	})
+
+	It("should delay", func() {
+		subject.Set(RateLimitPerCommand, "get", &RateLimit{Rate: 10, Burst: 1, MaxDelay: 150 * time.Millisecond})
+
+		Expect(subject.Take(c1, "get", now)).To(BeZero())
+		delay, limit := subject.Take(c2, "get", now)
+		Expect(limit).To(BeNil())
+		Expect(delay).To(Equal(100 * time.Millisecond))
+
+		_, limit = subject.Take(c1, "get", now)
+		Expect(limit).NotTo(BeNil())
+		Expect(subject.Take(c1, "set", now)).To(BeZero())
+	})
+
+	It("should apply specific limits", func() {
+		subject.Set(RateLimitPerUser, "", &RateLimit{Rate: 1})
+		subject.Set(RateLimitPerUser, "admin", &RateLimit{Rate: 100})
+		c2.SetUser("admin")
+
+		Expect(subject.Take(c1, "ping", now)).To(BeZero())
+		_, limit := subject.Take(c1, "ping", now)
+		Expect(limit).NotTo(BeNil())
+
+		for i := 0; i < 100; i++ {
+			_, limit = subject.Take(c2, "ping", now)
+			Expect(limit).To(BeNil())
+		}
+	})
+
+	It("should not consume tokens of rejected calls", func() {
+		subject.Set(RateLimitPerIP, "", &RateLimit{Rate: 1, Burst: 2})
+		subject.Set(RateLimitPerClient, "", &RateLimit{Rate: 1})
+
+		Expect(subject.Take(c1, "ping", now)).To(BeZero())
+		_, limit := subject.Take(c1, "ping", now)
+		Expect(limit).NotTo(BeNil())
+		Expect(subject.Take(c2, "ping", now)).To(BeZero())
+	})
+
+	It("should change limits at runtime", func() {
+		subject.Set(RateLimitPerClient, "", &RateLimit{Rate: 1})
+		Expect(subject.Take(c1, "ping", now)).To(BeZero())
+		_, limit := subject.Take(c1, "ping", now)
+		Expect(limit).NotTo(BeNil())
+
+		subject.Set(RateLimitPerClient, "", &RateLimit{Rate: 1, Burst: 3})
+		Expect(subject.Take(c1, "ping", now)).To(BeZero())
+
+		subject.Set(RateLimitPerClient, "", nil)
+		for i := 0; i < 10; i++ {
+			Expect(subject.Take(c1, "ping", now)).To(BeZero())
+		}
+	})
+
+	It("should forget clients", func() {
+		subject.Set(RateLimitPerClient, "", &RateLimit{Rate: 1})
+		Expect(subject.Take(c1, "ping", now)).To(BeZero())
+		Expect(subject.buckets[RateLimitPerClient]).To(HaveLen(1))
+
+		subject.Forget(c1)
+		Expect(subject.buckets[RateLimitPerClient]).To(BeEmpty())
+	})
+
+	It("should limit servers", func() {
+		srv := NewServer(nil)
+		srv.HandleFunc("ping", func(w resp.ResponseWriter, _ *resp.Command) {
+			w.AppendInlineString("PONG")
+		})
+		srv.SetRateLimit(RateLimitPerIP, "127.0.0.1", &RateLimit{Rate: 0.001, Error: "ERR slow down"})
+
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+		go func() { _ = srv.Serve(lis) }()
+		DeferCleanup(srv.Shutdown)
+
+		cn, err := net.Dial("tcp", lis.Addr().String())
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(cn.Close)
+
+		w, r := resp.NewRequestWriter(cn), resp.NewResponseReader(cn)
+		w.WriteCmdString("PING")
+		w.WriteCmdString("PING", "x")
+		w.WriteCmdString("PING")
+		Expect(w.Flush()).To(Succeed())
+		Expect(r.ReadInlineString()).To(Equal("PONG"))
+		Expect(r.ReadError()).To(Equal("ERR slow down"))
+		Expect(r.ReadError()).To(Equal("ERR slow down"))
+
+		srv.SetRateLimit(RateLimitPerIP, "127.0.0.1", nil)
+		w.WriteCmdString("PING")
+		Expect(w.Flush()).To(Succeed())
+		Expect(r.ReadInlineString()).To(Equal("PONG"))
+	})
+})
@@ -27,6 +27,16 @@ func ErrWrongNumberOfArgs(cmd string) error {
 	return errors.New(WrongNumberOfArgs(cmd))
 }
 
+// Busy returns a busy error string, for commands rejected by a Limiter
+func Busy(cmd string) string {
+	return "BUSY too many concurrent '" + cmd + "' commands, try again later"
+}
+
+// ErrBusy returns a busy error
+func ErrBusy(cmd string) error {
+	return errors.New(Busy(cmd))
+}
+
 // Ping returns a ping handler.
 // https://redis.io/commands/ping
 func Ping() Handler {
@@ -70,25 +80,13 @@ func Info(s *Server) Handler {
 	})
 }
 
-// CommandDescriptions returns a command handler.
+// Command returns a command handler, which describes all commands
+// registered with the server.
 // https://redis.io/commands/command
-type CommandDescriptions []CommandDescription
-
-func (s CommandDescriptions) ServeRedeo(w resp.ResponseWriter, c *resp.Command) {
-	w.AppendArrayLen(len(s))
-
-	for _, cmd := range s {
-		w.AppendArrayLen(6)
-		w.AppendBulkString(strings.ToLower(cmd.Name))
-		w.AppendInt(cmd.Arity)
-		w.AppendArrayLen(len(cmd.Flags))
-		for _, flag := range cmd.Flags {
-			w.AppendBulkString(flag)
-		}
-		w.AppendInt(cmd.FirstKey)
-		w.AppendInt(cmd.LastKey)
-		w.AppendInt(cmd.KeyStepCount)
-	}
+func Command(s *Server) Handler {
+	return HandlerFunc(func(w resp.ResponseWriter, c *resp.Command) {
+		s.CommandDescriptions().ServeRedeo(w, c)
+	})
 }
 
 // SubCommands returns a handler that is parsing sub-commands
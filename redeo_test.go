@@ -2,7 +2,10 @@ package redeo
 
 import (
 	"bytes"
+	"context"
+	"fmt"
 	"net"
+	"sync"
 	"testing"
 	"time"
 
@@ -33,20 +36,140 @@ var _ = Describe("Ping", func() {
 
 var _ = Describe("CommandDescriptions", func() {
 	subject := CommandDescriptions{
-		{Name: "GeT", Arity: 2, Flags: []string{"readonly", "fast"}, FirstKey: 1, LastKey: 1, KeyStepCount: 1},
-		{Name: "randomkey", Arity: 1, Flags: []string{"readonly", "random"}},
-		{Name: "mset", Arity: -3, Flags: []string{"write", "denyoom"}, FirstKey: 1, LastKey: -1, KeyStepCount: 2},
+		{Name: "GeT", Arity: 2, Flags: []string{"readonly", "fast"}, FirstKey: 1, LastKey: 1, KeyStepCount: 1, ACLCategories: []string{"@read", "string", "@fast"}, Summary: "Returns the string value of a key.", Since: "1.0.0", Group: "string", Complexity: "O(1)"},
+		{Name: "randomkey", Arity: 1, Flags: []string{"readonly", "random"}, Tips: []string{"nondeterministic_output"}},
+		{Name: "mset", Arity: -3, Flags: []string{"write", "denyoom"}, FirstKey: 1, LastKey: -1, KeyStepCount: 2, ACLCategories: []string{"@write"}},
 		{Name: "quit", Arity: 1},
+		{Name: "object", Arity: -2, SubCommands: []CommandDescription{
+			{Name: "encoding", Arity: 3, Flags: []string{"readonly"}, FirstKey: 2, LastKey: 2, KeyStepCount: 1, Summary: "Returns the internal encoding."},
+			{Name: "object|help", Arity: 2},
+		}},
+	}
+
+	serve := func(args ...string) interface{} {
+		cmd := resp.NewCommand("COMMAND")
+		for _, arg := range args {
+			cmd.Args = append(cmd.Args, resp.CommandArgument(arg))
+		}
+
+		w := redeotest.NewRecorder()
+		subject.ServeRedeo(w, cmd)
+		v, err := w.Response()
+		Expect(err).NotTo(HaveOccurred())
+		return v
+	}
+
+	getInfo := []interface{}{"get", int64(2), []interface{}{"readonly", "fast"}, int64(1), int64(1), int64(1),
+		[]interface{}{"@read", "@string", "@fast"}, []interface{}{},
+		[]interface{}{[]interface{}{
+			"flags", []interface{}{},
+			"begin_search", []interface{}{"type", "index", "spec", []interface{}{"index", int64(1)}},
+			"find_keys", []interface{}{"type", "range", "spec", []interface{}{"lastkey", int64(0), "keystep", int64(1), "limit", int64(0)}},
+		}},
+		[]interface{}{},
+	}
+	encodingInfo := []interface{}{"object|encoding", int64(3), []interface{}{"readonly"}, int64(2), int64(2), int64(1),
+		[]interface{}{}, []interface{}{},
+		[]interface{}{[]interface{}{
+			"flags", []interface{}{},
+			"begin_search", []interface{}{"type", "index", "spec", []interface{}{"index", int64(2)}},
+			"find_keys", []interface{}{"type", "range", "spec", []interface{}{"lastkey", int64(0), "keystep", int64(1), "limit", int64(0)}},
+		}},
+		[]interface{}{},
+	}
+	helpInfo := []interface{}{"object|help", int64(2), []interface{}{}, int64(0), int64(0), int64(0),
+		[]interface{}{}, []interface{}{}, []interface{}{}, []interface{}{},
 	}
 
 	It("should enumerate", func() {
+		res := serve()
+		Expect(res).To(HaveLen(5))
+		Expect(res).To(HaveEach(HaveLen(10)))
+		Expect(res.([]interface{})[0]).To(Equal(getInfo))
+		Expect(res.([]interface{})[1]).To(Equal([]interface{}{"randomkey", int64(1), []interface{}{"readonly", "random"}, int64(0), int64(0), int64(0),
+			[]interface{}{}, []interface{}{"nondeterministic_output"}, []interface{}{}, []interface{}{},
+		}))
+		Expect(res.([]interface{})[2]).To(ContainElement([]interface{}{[]interface{}{
+			"flags", []interface{}{},
+			"begin_search", []interface{}{"type", "index", "spec", []interface{}{"index", int64(1)}},
+			"find_keys", []interface{}{"type", "range", "spec", []interface{}{"lastkey", int64(-1), "keystep", int64(2), "limit", int64(0)}},
+		}}))
+		Expect(res.([]interface{})[4]).To(Equal([]interface{}{"object", int64(-2), []interface{}{}, int64(0), int64(0), int64(0),
+			[]interface{}{}, []interface{}{}, []interface{}{},
+			[]interface{}{encodingInfo, helpInfo},
+		}))
+	})
+
+	It("should count", func() {
+		Expect(serve("count")).To(Equal(int64(5)))
+		Expect(serve("COUNT", "x")).To(MatchError("ERR wrong number of arguments for 'COMMAND|count' command"))
+	})
+
+	It("should info", func() {
+		Expect(serve("info", "GET", "missing", "object|encoding")).To(Equal([]interface{}{getInfo, nil, encodingInfo}))
+		Expect(serve("info")).To(HaveLen(5))
+	})
+
+	It("should getkeys", func() {
+		Expect(serve("getkeys", "get", "k1")).To(Equal([]interface{}{"k1"}))
+		Expect(serve("getkeys", "mset", "k1", "v1", "k2", "v2")).To(Equal([]interface{}{"k1", "k2"}))
+		Expect(serve("getkeys", "object", "encoding", "k1")).To(Equal([]interface{}{"k1"}))
+		Expect(serve("getkeys")).To(MatchError("ERR wrong number of arguments for 'COMMAND|getkeys' command"))
+		Expect(serve("getkeys", "missing")).To(MatchError("ERR Invalid command specified"))
+		Expect(serve("getkeys", "get")).To(MatchError("ERR Invalid number of arguments specified for command"))
+		Expect(serve("getkeys", "quit")).To(MatchError("ERR The command has no key arguments"))
+	})
+
+	It("should docs", func() {
+		Expect(serve("docs", "get", "missing", "object|encoding")).To(Equal([]interface{}{
+			"get", []interface{}{"summary", "Returns the string value of a key.", "since", "1.0.0", "group", "string", "complexity", "O(1)"},
+			"object|encoding", []interface{}{"summary", "Returns the internal encoding."},
+		}))
+		Expect(serve("docs", "object")).To(Equal([]interface{}{
+			"object", []interface{}{"subcommands", []interface{}{
+				"object|encoding", []interface{}{"summary", "Returns the internal encoding."},
+				"object|help", []interface{}{},
+			}},
+		}))
+		Expect(serve("docs")).To(HaveLen(10))
+	})
+
+	It("should list", func() {
+		Expect(serve("list")).To(Equal([]interface{}{"get", "randomkey", "mset", "quit", "object"}))
+		Expect(serve("list", "filterby", "aclcat", "string")).To(Equal([]interface{}{"get"}))
+		Expect(serve("list", "FILTERBY", "PATTERN", "*o*")).To(Equal([]interface{}{"randomkey", "object"}))
+		Expect(serve("list", "filterby", "pattern", "[MR]*T")).To(Equal([]interface{}{"mset"}))
+		Expect(serve("list", "filterby", "pattern", "g[^a-d]?")).To(Equal([]interface{}{"get"}))
+		Expect(serve("list", "filterby", "pattern", "[")).To(Equal([]interface{}{}))
+		Expect(serve("list", "filterby", "module", "x")).To(Equal([]interface{}{}))
+		Expect(serve("list", "filterby")).To(MatchError("ERR syntax error"))
+	})
+
+	It("should reject unknown sub-commands", func() {
+		Expect(serve("bad")).To(MatchError("ERR Unknown command subcommand 'bad'"))
+	})
+
+})
+
+var _ = Describe("Command", func() {
+	srv := NewServer(nil)
+	srv.Handle("get", Echo(), CommandDescription{Arity: 2, Flags: []string{"readonly", "fast"}, FirstKey: 1, LastKey: 1, KeyStepCount: 1})
+	srv.Handle("ping", Ping())
+	srv.Handle("custom", SubCommands{"ping": Ping(), "ECHO": Echo()}, CommandDescription{Arity: -2})
+	subject := Command(srv)
+
+	It("should describe registered commands", func() {
 		w := redeotest.NewRecorder()
-		subject.ServeRedeo(w, resp.NewCommand("COMMAND"))
+		subject.ServeRedeo(w, resp.NewCommand("COMMAND", resp.CommandArgument("LIST")))
+		Expect(w.Response()).To(Equal([]interface{}{"custom", "get", "ping"}))
+
+		w = redeotest.NewRecorder()
+		subject.ServeRedeo(w, resp.NewCommand("COMMAND", resp.CommandArgument("INFO"), resp.CommandArgument("custom")))
 		Expect(w.Response()).To(Equal([]interface{}{
-			[]interface{}{"get", int64(2), []interface{}{"readonly", "fast"}, int64(1), int64(1), int64(1)},
-			[]interface{}{"randomkey", int64(1), []interface{}{"readonly", "random"}, int64(0), int64(0), int64(0)},
-			[]interface{}{"mset", int64(-3), []interface{}{"write", "denyoom"}, int64(1), int64(-1), int64(2)},
-			[]interface{}{"quit", int64(1), []interface{}{}, int64(0), int64(0), int64(0)},
+			[]interface{}{"custom", int64(-2), []interface{}{}, int64(0), int64(0), int64(0), []interface{}{}, []interface{}{}, []interface{}{}, []interface{}{
+				[]interface{}{"custom|echo", int64(-2), []interface{}{}, int64(0), int64(0), int64(0), []interface{}{}, []interface{}{}, []interface{}{}, []interface{}{}},
+				[]interface{}{"custom|ping", int64(-2), []interface{}{}, int64(0), int64(0), int64(0), []interface{}{}, []interface{}{}, []interface{}{}, []interface{}{}},
+			}},
 		}))
 	})
 
@@ -97,6 +220,8 @@ func TestSuite(t *testing.T) {
 
 // --------------------------------------------------------------------
 
+var testBuffers = resp.NewBufferPool(0)
+
 type mockConn struct {
 	bytes.Buffer
 	Port   int
@@ -113,3 +238,43 @@ func (m *mockConn) RemoteAddr() net.Addr {
 func (m *mockConn) SetDeadline(_ time.Time) error      { return nil }
 func (m *mockConn) SetReadDeadline(_ time.Time) error  { return nil }
 func (m *mockConn) SetWriteDeadline(_ time.Time) error { return nil }
+
+type mockObserver struct {
+	events []string
+	mu     sync.Mutex
+}
+
+func (m *mockObserver) Events() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]string(nil), m.events...)
+}
+
+func (m *mockObserver) ObservePipeline(ctx context.Context, _ *Client) (context.Context, func(error)) {
+	m.record("pipeline:start")
+	return ctx, func(err error) {
+		if err != nil {
+			m.record("pipeline:done:" + err.Error())
+		} else {
+			m.record("pipeline:done")
+		}
+	}
+}
+
+func (m *mockObserver) ObserveCommand(ctx context.Context, _ *Client, name string, argc int) (context.Context, func(string)) {
+	event := fmt.Sprintf("%s(%d)", name, argc)
+	m.record(event + ":start")
+	return ctx, func(msg string) {
+		if msg != "" {
+			m.record(event + ":done:" + msg)
+		} else {
+			m.record(event + ":done")
+		}
+	}
+}
+
+func (m *mockObserver) record(event string) {
+	m.mu.Lock()
+	m.events = append(m.events, event)
+	m.mu.Unlock()
+}
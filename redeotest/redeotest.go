@@ -31,6 +31,19 @@ func NewRecorder() *ResponseRecorder {
 	}
 }
 
+// AppendMapLen implements resp.MapWriter.
+func (r *ResponseRecorder) AppendMapLen(n int) { resp.AppendMapLen(r.ResponseWriter, n) }
+
+// Protocol implements resp.ProtocolWriter.
+func (r *ResponseRecorder) Protocol() int { return resp.Protocol(r.ResponseWriter) }
+
+// SetProtocol implements resp.ProtocolWriter.
+func (r *ResponseRecorder) SetProtocol(v int) {
+	if pw, ok := r.ResponseWriter.(resp.ProtocolWriter); ok {
+		pw.SetProtocol(v)
+	}
+}
+
 // Len returns the raw byte length
 func (r *ResponseRecorder) Len() int {
 	_ = r.ResponseWriter.Flush()
@@ -108,6 +121,23 @@ func parseResult(rr resp.ResponseReader) (interface{}, error) {
 			}
 		}
 		return vv, nil
+	case resp.TypeMap:
+		mr, ok := rr.(resp.MapReader)
+		if !ok {
+			return nil, fmt.Errorf("unexpected response %v", typ)
+		}
+		sz, err := mr.ReadMapLen()
+		if err != nil {
+			return nil, err
+		}
+
+		vv := make([]interface{}, 2*sz)
+		for i := range vv {
+			if vv[i], err = parseResult(rr); err != nil {
+				return nil, err
+			}
+		}
+		return vv, nil
 	default:
 		return nil, fmt.Errorf("unexpected response %v", typ)
 	}
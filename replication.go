@@ -0,0 +1,444 @@
+package redeo
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bsm/redeo/v2/resp"
+)
+
+// emptyRDB is a minimal RDB payload without any keys and with checksums
+// disabled. It is sent on full resyncs, unless a Snapshotter is set.
+var emptyRDB = []byte("REDIS0006\xff\x00\x00\x00\x00\x00\x00\x00\x00")
+
+// Snapshotter creates and loads snapshots of the dataset, which are
+// transferred to followers on full resynchronisations.
+type Snapshotter interface {
+	// WriteSnapshot writes a snapshot of the current dataset. Write
+	// commands are blocked while the snapshot is taken.
+	WriteSnapshot(w io.Writer) error
+	// LoadSnapshot replaces the current dataset with a snapshot.
+	LoadSnapshot(r io.Reader) error
+}
+
+// SetSnapshotter sets the snapshotter used for full resynchronisations.
+// Without a snapshotter, masters send empty datasets and followers discard
+// received snapshots.
+func (srv *Server) SetSnapshotter(s Snapshotter) {
+	srv.repl.mu.Lock()
+	srv.repl.snapshotter = s
+	srv.repl.mu.Unlock()
+}
+
+// PSync returns a PSYNC handler, which turns the calling connection into a
+// replication stream. Commands flagged as "write" in their descriptions are
+// recorded into an append-only command log and streamed to all followers.
+// Writes which reply with an error are not recorded. Write commands are
+// performed one at a time, so followers apply them in the same order as the
+// master. Followers reconnecting with a known replication ID and an offset
+// which is still retained by the backlog continue with a partial resync, all
+// others receive a snapshot.
+//
+// Only commands served via Handler are recorded, streamed commands are not
+// replicated. Please see Server.Follow for the follower side.
+// https://redis.io/commands/psync
+func (srv *Server) PSync() Handler {
+	return HandlerFunc(func(w resp.ResponseWriter, c *resp.Command) {
+		if c.ArgN() != 2 {
+			w.AppendError(WrongNumberOfArgs(c.Name))
+			return
+		}
+
+		client := GetClient(c.Context())
+		if client == nil {
+			w.AppendError("ERR replication requires a client connection")
+			return
+		}
+
+		offset, err := strconv.ParseInt(c.Arg(1).String(), 10, 64)
+		if err != nil {
+			w.AppendError("ERR value is not an integer or out of range")
+			return
+		}
+
+		if err := srv.repl.sync(w, client, c.Arg(0).String(), offset); err != nil {
+			w.AppendError("ERR " + err.Error())
+		}
+	})
+}
+
+// ReplConf returns a REPLCONF handler, which accepts the configuration and
+// acknowledgements sent by followers.
+// https://redis.io/commands/replconf
+func (srv *Server) ReplConf() Handler {
+	return HandlerFunc(func(w resp.ResponseWriter, c *resp.Command) {
+		if c.ArgN() == 0 || c.ArgN()%2 != 0 {
+			w.AppendError("ERR syntax error")
+			return
+		}
+
+		for i := 0; i < c.ArgN(); i += 2 {
+			switch strings.ToLower(c.Arg(i).String()) {
+			case "ack":
+				// acknowledgements are not replied to
+				if offset, err := strconv.ParseInt(c.Arg(i+1).String(), 10, 64); err == nil {
+					srv.repl.ack(GetClient(c.Context()), offset)
+				}
+				return
+			case "listening-port", "ip-address", "capa", "getack":
+			default:
+				w.AppendErrorf("ERR Unrecognized REPLCONF option: %s", c.Arg(i).String())
+				return
+			}
+		}
+		w.AppendOK()
+	})
+}
+
+// --------------------------------------------------------------------
+
+type replication struct {
+	backlogSize  int
+	pingInterval time.Duration
+	snapshotter  Snapshotter
+
+	id       string
+	offset   int64     // total number of bytes recorded
+	recorded time.Time // time of the last record
+	backlog  *replBacklog
+	replicas map[*Client]*replica
+
+	fullSyncs    int64
+	partialSyncs int64
+
+	follower *follower
+	mu       sync.Mutex
+
+	// writes is the server's write gate, held while snapshots are taken
+	writes *sync.Mutex
+}
+
+func newReplication(backlogSize int, pingInterval time.Duration, writes *sync.Mutex) *replication {
+	return &replication{
+		backlogSize:  backlogSize,
+		pingInterval: pingInterval,
+		writes:       writes,
+		id:           newReplID(),
+		replicas:     make(map[*Client]*replica),
+	}
+}
+
+// Role returns the current replication role.
+func (r *replication) Role() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.follower != nil {
+		return "slave"
+	}
+	return "master"
+}
+
+// record appends a write command to the log and notifies replicas.
+func (r *replication) record(cmd *resp.Command) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.recordLocked(cmd.Name, cmd.Args, time.Now())
+}
+
+// ping appends a PING to the log, unless anything has been recorded within
+// the ping interval. PINGs keep idle replicas from timing out.
+func (r *replication) ping(now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if now.Sub(r.recorded) >= r.pingInterval {
+		r.recordLocked("PING", nil, now)
+	}
+}
+
+func (r *replication) recordLocked(name string, args []resp.CommandArgument, now time.Time) {
+	if r.backlog == nil {
+		return
+	}
+
+	var buf bytes.Buffer
+	writeReplCmd(&buf, name, args)
+	r.backlog.Write(buf.Bytes())
+	r.offset += int64(buf.Len())
+	r.recorded = now
+
+	for _, rp := range r.replicas {
+		rp.notify()
+	}
+}
+
+// sync starts a full or partial resynchronisation.
+func (r *replication) sync(w resp.ResponseWriter, c *Client, id string, offset int64) error {
+	if r.continueSync(w, c, id, offset) {
+		return nil
+	}
+
+	// block writes, while the snapshot is taken
+	r.writes.Lock()
+
+	r.mu.Lock()
+	if r.backlog == nil {
+		r.backlog = newReplBacklog(r.backlogSize, r.offset)
+	}
+	snapshotter, id, offset := r.snapshotter, r.id, r.offset
+	r.mu.Unlock()
+
+	payload := emptyRDB
+	if snapshotter != nil {
+		var buf bytes.Buffer
+		if err := snapshotter.WriteSnapshot(&buf); err != nil {
+			r.writes.Unlock()
+			return err
+		}
+		payload = buf.Bytes()
+	}
+
+	r.attach(c, offset)
+	r.writes.Unlock()
+
+	r.mu.Lock()
+	r.fullSyncs++
+	r.mu.Unlock()
+
+	// snapshots are sent as bulks without a trailing CRLF
+	w.AppendInlineString("FULLRESYNC " + id + " " + strconv.FormatInt(offset, 10))
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if _, err := w.Write([]byte("$" + strconv.Itoa(len(payload)) + "\r\n")); err != nil {
+		return err
+	}
+	_, err := w.Write(payload)
+	return err
+}
+
+// continueSync attempts a partial resynchronisation. Followers send the offset
+// of the next byte they expect, starting at 1.
+func (r *replication) continueSync(w resp.ResponseWriter, c *Client, id string, offset int64) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if id != r.id || r.backlog == nil || !r.backlog.Contains(offset-1) {
+		return false
+	}
+
+	r.partialSyncs++
+	w.AppendInlineString("CONTINUE " + r.id)
+	r.attachLocked(c, offset-1)
+	return true
+}
+
+func (r *replication) attach(c *Client, offset int64) {
+	r.mu.Lock()
+	r.attachLocked(c, offset)
+	r.mu.Unlock()
+}
+
+func (r *replication) attachLocked(c *Client, offset int64) {
+	if rp, ok := r.replicas[c]; ok {
+		rp.stop()
+	}
+
+	rp := &replica{
+		client:  c,
+		offset:  offset,
+		pending: make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+	r.replicas[c] = rp
+	go rp.feed(r)
+
+	if r.offset > offset {
+		rp.notify()
+	}
+}
+
+// detach removes a disconnected client from the list of replicas.
+func (r *replication) detach(c *Client) {
+	r.mu.Lock()
+	if rp, ok := r.replicas[c]; ok {
+		delete(r.replicas, c)
+		rp.stop()
+	}
+	r.mu.Unlock()
+}
+
+func (r *replication) ack(c *Client, offset int64) {
+	r.mu.Lock()
+	if rp, ok := r.replicas[c]; ok {
+		rp.ack = offset
+	}
+	r.mu.Unlock()
+}
+
+// NumReplicas returns the number of connected replicas.
+func (r *replication) NumReplicas() int {
+	r.mu.Lock()
+	n := len(r.replicas)
+	r.mu.Unlock()
+	return n
+}
+
+// --------------------------------------------------------------------
+
+type replica struct {
+	client  *Client
+	offset  int64 // offset sent up to
+	ack     int64 // offset acknowledged by the replica
+	pending chan struct{}
+	done    chan struct{}
+}
+
+func (rp *replica) notify() {
+	select {
+	case rp.pending <- struct{}{}:
+	default:
+	}
+}
+
+func (rp *replica) stop() { close(rp.done) }
+
+// feed streams the backlog to the replica and pings it periodically.
+// Replicas which fall behind by more than the backlog size are disconnected.
+func (rp *replica) feed(r *replication) {
+	ticker := time.NewTicker(r.pingInterval)
+	defer ticker.Stop()
+
+	var buf []byte
+	for {
+		select {
+		case <-rp.pending:
+		case now := <-ticker.C:
+			r.ping(now)
+			continue
+		case <-rp.done:
+			return
+		}
+
+		r.mu.Lock()
+		var ok bool
+		buf, ok = r.backlog.ReadFrom(rp.offset, buf[:0])
+		rp.offset = r.offset
+		r.mu.Unlock()
+
+		if !ok {
+			_ = rp.client.cn.Close()
+			return
+		}
+		if err := rp.client.pushRaw(buf); err != nil {
+			_ = rp.client.cn.Close()
+			return
+		}
+	}
+}
+
+// --------------------------------------------------------------------
+
+// replBacklog is a ring buffer, retaining the most recent part of the log.
+type replBacklog struct {
+	buf   []byte
+	start int64 // offset of the first retained byte
+	end   int64 // offset after the last byte
+}
+
+func newReplBacklog(size int, offset int64) *replBacklog {
+	return &replBacklog{buf: make([]byte, size), start: offset, end: offset}
+}
+
+// Contains returns true if the backlog can serve data from offset.
+func (b *replBacklog) Contains(offset int64) bool {
+	return offset >= b.start && offset <= b.end
+}
+
+// Write appends data to the log, discarding the oldest data once full.
+func (b *replBacklog) Write(p []byte) {
+	size := int64(len(b.buf))
+	if n := int64(len(p)); n > size {
+		b.end += n - size
+		p = p[n-size:]
+	}
+
+	for len(p) != 0 {
+		pos := b.end % size
+		n := copy(b.buf[pos:], p)
+		p = p[n:]
+		b.end += int64(n)
+	}
+
+	if b.end-b.start > size {
+		b.start = b.end - size
+	}
+}
+
+// ReadFrom appends data from offset to dst. It returns false if the data
+// is no longer retained.
+func (b *replBacklog) ReadFrom(offset int64, dst []byte) ([]byte, bool) {
+	if !b.Contains(offset) {
+		return dst, false
+	}
+
+	size := int64(len(b.buf))
+	for offset < b.end {
+		pos := offset % size
+		n := b.end - offset
+		if n > size-pos {
+			n = size - pos
+		}
+		dst = append(dst, b.buf[pos:pos+n]...)
+		offset += n
+	}
+	return dst, true
+}
+
+// --------------------------------------------------------------------
+
+// writeReplCmd writes a command in its canonical multi-bulk encoding.
+func writeReplCmd(buf *bytes.Buffer, name string, args []resp.CommandArgument) {
+	buf.WriteByte('*')
+	buf.WriteString(strconv.Itoa(len(args) + 1))
+	buf.WriteString("\r\n")
+	writeReplBulk(buf, []byte(name))
+	for _, arg := range args {
+		writeReplBulk(buf, arg)
+	}
+}
+
+func writeReplBulk(buf *bytes.Buffer, p []byte) {
+	buf.WriteByte('$')
+	buf.WriteString(strconv.Itoa(len(p)))
+	buf.WriteString("\r\n")
+	buf.Write(p)
+	buf.WriteString("\r\n")
+}
+
+// replCmdLen returns the length of the canonical encoding of a command.
+func replCmdLen(name string, args []resp.CommandArgument) int64 {
+	n := bulkLen(len(name)) + int64(len(strconv.Itoa(len(args)+1))) + 3
+	for _, arg := range args {
+		n += bulkLen(len(arg))
+	}
+	return n
+}
+
+func bulkLen(n int) int64 {
+	return int64(len(strconv.Itoa(n))+n) + 5
+}
+
+func newReplID() string {
+	p := make([]byte, 20)
+	_, _ = rand.Read(p)
+	return hex.EncodeToString(p)
+}
@@ -0,0 +1,397 @@
+package redeo
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	. "github.com/bsm/ginkgo/v2"
+	. "github.com/bsm/gomega"
+	"github.com/bsm/redeo/v2/resp"
+)
+
+var _ = Describe("Replication", func() {
+	Describe("backlog", func() {
+		It("should retain recent data", func() {
+			b := newReplBacklog(8, 10)
+			read := func(offset int64, dst []byte) string {
+				p, ok := b.ReadFrom(offset, dst)
+				Expect(ok).To(BeTrue())
+				return string(p)
+			}
+
+			Expect(b.Contains(10)).To(BeTrue())
+			Expect(b.Contains(11)).To(BeFalse())
+
+			b.Write([]byte("abcde"))
+			Expect(read(10, nil)).To(Equal("abcde"))
+			Expect(read(13, nil)).To(Equal("de"))
+
+			b.Write([]byte("fghij"))
+			Expect(b.start).To(Equal(int64(12)))
+			Expect(b.end).To(Equal(int64(20)))
+			_, ok := b.ReadFrom(11, nil)
+			Expect(ok).To(BeFalse())
+			Expect(read(12, nil)).To(Equal("cdefghij"))
+
+			b.Write([]byte("0123456789"))
+			Expect(read(22, nil)).To(Equal("23456789"))
+			Expect(read(30, []byte("x"))).To(Equal("x"))
+		})
+
+		It("should encode commands", func() {
+			var buf bytes.Buffer
+			args := []resp.CommandArgument{resp.CommandArgument("key"), resp.CommandArgument(strings.Repeat("x", 100))}
+			writeReplCmd(&buf, "SET", args)
+			Expect(buf.String()).To(HavePrefix("*3\r\n$3\r\nSET\r\n$3\r\nkey\r\n$100\r\nxxx"))
+			Expect(replCmdLen("SET", args)).To(Equal(int64(buf.Len())))
+		})
+	})
+
+	Describe("follower", func() {
+		It("should close the connection when acknowledgements fail", func() {
+			cn := new(brokenConn)
+			fc := &followConn{cn: cn, wr: resp.NewRequestWriter(cn)}
+			f := &follower{srv: NewServer(nil)}
+
+			done := make(chan struct{})
+			defer close(done)
+			go f.acknowledge(fc, done)
+			Eventually(cn.Closed, "3s").Should(BeTrue())
+		})
+	})
+
+	Describe("servers", func() {
+		var master, follower *Server
+		var mstore, fstore *testStore
+		var maddr, faddr string
+		var cancel context.CancelFunc
+		var followed chan error
+
+		call := func(addr string, cmd string, args ...string) string {
+			cn, err := net.Dial("tcp", addr)
+			Expect(err).NotTo(HaveOccurred())
+			defer cn.Close()
+
+			w := resp.NewRequestWriter(cn)
+			w.WriteCmdString(cmd, args...)
+			Expect(w.Flush()).To(Succeed())
+
+			line, err := bufio.NewReader(cn).ReadString('\n')
+			Expect(err).NotTo(HaveOccurred())
+			return strings.TrimSpace(line)
+		}
+
+		serve := func(srv *Server) string {
+			lis, err := net.Listen("tcp", "127.0.0.1:0")
+			Expect(err).NotTo(HaveOccurred())
+			go func(srv *Server, lis net.Listener) { _ = srv.Serve(lis) }(srv, lis)
+			DeferCleanup(srv.Shutdown)
+			return lis.Addr().String()
+		}
+
+		infoOf := func(srv *Server, field string) func() string {
+			return func() string {
+				for _, line := range strings.Split(srv.Info().Find("Replication").String(), "\n") {
+					if strings.HasPrefix(line, field+":") {
+						return strings.TrimPrefix(line, field+":")
+					}
+				}
+				return ""
+			}
+		}
+
+		BeforeEach(func() {
+			mstore, fstore = newTestStore(), newTestStore()
+
+			master = NewServer(&Config{ReplBacklogSize: 1024, ReplPingInterval: 50 * time.Millisecond})
+			mstore.register(master)
+			master.SetSnapshotter(mstore)
+			master.Handle("psync", master.PSync())
+			master.Handle("replconf", master.ReplConf())
+			maddr = serve(master)
+
+			follower = NewServer(nil)
+			fstore.register(follower)
+			follower.SetSnapshotter(fstore)
+			faddr = serve(follower)
+
+			Expect(call(maddr, "SET", "a", "1")).To(Equal("+OK"))
+			Expect(call(maddr, "INCR", "n")).To(Equal(":1"))
+
+			var ctx context.Context
+			ctx, cancel = context.WithCancel(context.Background())
+			followed = make(chan error, 1)
+			go func() { followed <- follower.Follow(ctx, maddr) }()
+			DeferCleanup(func() {
+				cancel()
+				Eventually(followed).Should(Receive(MatchError(context.Canceled)))
+			})
+
+			Eventually(infoOf(follower, "master_link_status")).Should(Equal("up"))
+		})
+
+		It("should replicate writes", func() {
+			Expect(fstore.Get("a")).To(Equal("1"))
+			Expect(fstore.Get("n")).To(Equal("1"))
+			Expect(infoOf(master, "connected_slaves")()).To(Equal("1"))
+			Expect(infoOf(master, "sync_full")()).To(Equal("1"))
+			Expect(infoOf(follower, "role")()).To(Equal("slave"))
+			Expect(infoOf(follower, "master_replid")()).To(Equal(infoOf(master, "master_replid")()))
+
+			Expect(call(maddr, "SET", "b", "2")).To(Equal("+OK"))
+			Expect(call(maddr, "INCR", "n")).To(Equal(":2"))
+			Expect(call(maddr, "INCR", "n")).To(Equal(":3"))
+			Expect(call(maddr, "INCR", "a", "x")).To(HavePrefix("-ERR wrong number"))
+			Expect(call(maddr, "SET", "b", "")).To(Equal("-ERR empty value"))
+			Expect(call(maddr, "GET", "b")).To(Equal("$1"))
+
+			Eventually(func() string { return fstore.Get("n") }).Should(Equal("3"))
+			Expect(fstore.Get("b")).To(Equal("2"))
+			Expect(fstore.Dump()).To(Equal(mstore.Dump()))
+			Expect(call(faddr, "GET", "n")).To(Equal("$1"))
+			Eventually(infoOf(follower, "master_repl_offset")).Should(Equal(infoOf(master, "master_repl_offset")()))
+		})
+
+		It("should replicate concurrent writes in order", func() {
+			var wg sync.WaitGroup
+			for i := 0; i < 8; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer GinkgoRecover()
+					defer wg.Done()
+
+					cn, err := net.Dial("tcp", maddr)
+					Expect(err).NotTo(HaveOccurred())
+					defer cn.Close()
+
+					w, rd := resp.NewRequestWriter(cn), bufio.NewReader(cn)
+					for j := 0; j < 20; j++ {
+						w.WriteCmdString("SLOWSET", "k", fmt.Sprintf("%d-%d", i, j))
+						Expect(w.Flush()).To(Succeed())
+						Expect(rd.ReadString('\n')).To(Equal("+OK\r\n"))
+					}
+				}(i)
+			}
+			wg.Wait()
+
+			Expect(mstore.Writes("k")).To(HaveLen(160))
+			Eventually(func() []string { return fstore.Writes("k") }).Should(Equal(mstore.Writes("k")))
+			Expect(fstore.Get("k")).To(Equal(mstore.Get("k")))
+		})
+
+		It("should ping followers", func() {
+			offset := infoOf(master, "master_repl_offset")()
+			Eventually(infoOf(master, "master_repl_offset")).ShouldNot(Equal(offset))
+			Eventually(infoOf(follower, "master_repl_offset")).Should(Equal(infoOf(master, "master_repl_offset")()))
+			Expect(fstore.Dump()).To(Equal(mstore.Dump()))
+		})
+
+		It("should reconnect to silent masters", func() {
+			lis, err := net.Listen("tcp", "127.0.0.1:0")
+			Expect(err).NotTo(HaveOccurred())
+			DeferCleanup(lis.Close)
+
+			accepted := make(chan net.Conn, 2)
+			go func() {
+				for {
+					cn, err := lis.Accept()
+					if err != nil {
+						return
+					}
+					accepted <- cn
+				}
+			}()
+
+			srv := NewServer(&Config{ReplTimeout: 100 * time.Millisecond})
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go func() { _ = srv.Follow(ctx, lis.Addr().String()) }()
+
+			// reply to PING, REPLCONF and PSYNC, then remain silent
+			var cn net.Conn
+			Eventually(accepted).Should(Receive(&cn))
+			defer cn.Close()
+			_, err = io.WriteString(cn, "+PONG\r\n+OK\r\n+FULLRESYNC 0123456789 0\r\n$0\r\n")
+			Expect(err).NotTo(HaveOccurred())
+
+			Eventually(infoOf(srv, "master_link_status")).Should(Equal("up"))
+			Eventually(infoOf(srv, "master_link_status")).Should(Equal("down"))
+			Eventually(accepted, "3s").Should(Receive())
+		})
+
+		It("should reject writes on followers", func() {
+			Expect(call(faddr, "SET", "x", "1")).To(Equal("-READONLY You can't write against a read only replica."))
+			Expect(fstore.Get("x")).To(BeEmpty())
+
+			cancel()
+			Eventually(infoOf(follower, "role")).Should(Equal("master"))
+			Expect(call(faddr, "SET", "x", "1")).To(Equal("+OK"))
+		})
+
+		It("should resync partially", func() {
+			master.repl.mu.Lock()
+			for c := range master.repl.replicas {
+				_ = c.cn.Close()
+			}
+			master.repl.mu.Unlock()
+
+			Eventually(infoOf(follower, "master_link_status")).Should(Equal("down"))
+			Expect(call(maddr, "SET", "c", "3")).To(Equal("+OK"))
+
+			Eventually(infoOf(follower, "master_link_status"), "3s").Should(Equal("up"))
+			Eventually(func() string { return fstore.Get("c") }).Should(Equal("3"))
+			Expect(infoOf(master, "sync_full")()).To(Equal("1"))
+			Expect(infoOf(master, "sync_partial_ok")()).To(Equal("1"))
+		})
+
+		It("should resync fully when the backlog is exceeded", func() {
+			master.repl.mu.Lock()
+			for c := range master.repl.replicas {
+				_ = c.cn.Close()
+			}
+			master.repl.mu.Unlock()
+
+			Eventually(infoOf(follower, "master_link_status")).Should(Equal("down"))
+			for i := 0; i < 50; i++ {
+				Expect(call(maddr, "SET", "k"+strconv.Itoa(i), strings.Repeat("x", 50))).To(Equal("+OK"))
+			}
+
+			Eventually(infoOf(follower, "master_link_status"), "3s").Should(Equal("up"))
+			Eventually(fstore.Dump).Should(Equal(mstore.Dump()))
+			Expect(infoOf(master, "sync_full")()).To(Equal("2"))
+			Expect(infoOf(master, "sync_partial_ok")()).To(Equal("0"))
+		})
+	})
+})
+
+// --------------------------------------------------------------------
+
+type testStore struct {
+	data   map[string]string
+	writes []string // applied writes, in order
+	mu     sync.Mutex
+}
+
+func newTestStore() *testStore {
+	return &testStore{data: make(map[string]string)}
+}
+
+func (s *testStore) Get(key string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.data[key]
+}
+
+// Writes returns the writes applied to key, in order.
+func (s *testStore) Writes(key string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var vv []string
+	for _, kv := range s.writes {
+		if strings.HasPrefix(kv, key+"=") {
+			vv = append(vv, strings.TrimPrefix(kv, key+"="))
+		}
+	}
+	return vv
+}
+
+func (s *testStore) Dump() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	lines := make([]string, 0, len(s.data))
+	for k, v := range s.data {
+		lines = append(lines, k+"="+v+"\n")
+	}
+	sort.Strings(lines)
+	return strings.Join(lines, "")
+}
+
+func (s *testStore) WriteSnapshot(w io.Writer) error {
+	_, err := io.WriteString(w, s.Dump())
+	return err
+}
+
+func (s *testStore) LoadSnapshot(r io.Reader) error {
+	data := make(map[string]string)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if kv := strings.SplitN(scanner.Text(), "=", 2); len(kv) == 2 {
+			data[kv[0]] = kv[1]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.data = data
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *testStore) setHandler() HandlerFunc {
+	return func(w resp.ResponseWriter, c *resp.Command) {
+		if c.Arg(1).String() == "" {
+			w.AppendError("ERR empty value")
+			return
+		}
+
+		s.mu.Lock()
+		s.data[c.Arg(0).String()] = c.Arg(1).String()
+		s.writes = append(s.writes, c.Arg(0).String()+"="+c.Arg(1).String())
+		s.mu.Unlock()
+		w.AppendOK()
+	}
+}
+
+func (s *testStore) register(srv *Server) {
+	srv.HandleFunc("get", func(w resp.ResponseWriter, c *resp.Command) {
+		if v := s.Get(c.Arg(0).String()); v != "" {
+			w.AppendBulkString(v)
+		} else {
+			w.AppendNil()
+		}
+	}, CommandDescription{Arity: 2, Flags: []string{"readonly"}, FirstKey: 1, LastKey: 1, KeyStepCount: 1})
+
+	srv.HandleFunc("set", s.setHandler(), CommandDescription{Arity: 3, Flags: []string{"write"}, FirstKey: 1, LastKey: 1, KeyStepCount: 1})
+
+	// slowset takes a while to reply, after the data was changed
+	set := s.setHandler()
+	srv.HandleFunc("slowset", func(w resp.ResponseWriter, c *resp.Command) {
+		set(w, c)
+		time.Sleep(time.Duration(rand.Intn(200)) * time.Microsecond)
+	}, CommandDescription{Arity: 3, Flags: []string{"write"}, FirstKey: 1, LastKey: 1, KeyStepCount: 1})
+
+	srv.HandleFunc("incr", func(w resp.ResponseWriter, c *resp.Command) {
+		s.mu.Lock()
+		n, _ := strconv.ParseInt(s.data[c.Arg(0).String()], 10, 64)
+		n++
+		s.data[c.Arg(0).String()] = fmt.Sprint(n)
+		s.writes = append(s.writes, c.Arg(0).String()+"="+fmt.Sprint(n))
+		s.mu.Unlock()
+		w.AppendInt(n)
+	}, CommandDescription{Arity: 2, Flags: []string{"write"}, FirstKey: 1, LastKey: 1, KeyStepCount: 1})
+}
+
+// brokenConn fails all writes.
+type brokenConn struct {
+	net.Conn
+	closed int32
+}
+
+func (c *brokenConn) Write(_ []byte) (int, error) { return 0, io.ErrClosedPipe }
+func (c *brokenConn) Close() error                { atomic.StoreInt32(&c.closed, 1); return nil }
+func (c *brokenConn) Closed() bool                { return atomic.LoadInt32(&c.closed) != 0 }
@@ -0,0 +1,290 @@
+package resp
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+)
+
+var (
+	binStreamStart = []byte("*?\r\n")
+	binStreamEnd   = []byte(".\r\n")
+)
+
+// ArrayWriter writes arrays of unknown length, e.g. results produced by
+// iterators. Elements are appended via the ResponseWriter methods, where
+// each call appends a single element, while AppendArrayLen(n) starts a
+// nested array, consuming the next n elements. Raw writes are not counted.
+//
+// ArrayWriters are not safe for concurrent use.
+type ArrayWriter interface {
+	ResponseWriter
+
+	// Len returns the number of elements appended.
+	Len() int
+	// Close completes the array. The writer must not be used afterwards.
+	Close() error
+}
+
+// NewArrayWriter starts an array of unknown length on w, choosing the form
+// by the protocol of w. For RESP3 writers (see ProtocolWriter) it behaves like
+// NewStreamedArrayWriter. For RESP2 writers, elements are collected in
+// chunks of up to the buffer size of w and written with a length header on
+// Close.
+func NewArrayWriter(w ResponseWriter) ArrayWriter {
+	if Protocol(w) >= 3 {
+		return NewStreamedArrayWriter(w)
+	}
+
+	a := &arrayWriter{w: w, limit: bufferSize(w)}
+	a.data.reset(make([]byte, 0, 4096), &a.chunks)
+	return a
+}
+
+// NewStreamedArrayWriter starts a RESP3 streamed aggregate (`*?`) on w,
+// regardless of the protocol of w. It must only be used for clients which
+// speak RESP3. Elements are appended to w directly and w is flushed once
+// more than half of its buffer is used. Close writes the `.` terminator.
+func NewStreamedArrayWriter(w ResponseWriter) ArrayWriter {
+	a := &arrayWriter{w: w, streamed: true, limit: bufferSize(w)}
+	a.err = appendRaw(w, binStreamStart)
+	return a
+}
+
+// bufferSize returns the buffer size of w. Writers which are not created
+// by this package are assumed to use MaxBufferSize.
+func bufferSize(w ResponseWriter) int {
+	if b, ok := w.(*bufioW); ok && b.size > 0 {
+		return b.size
+	}
+	return MaxBufferSize
+}
+
+type arrayWriter struct {
+	w        ResponseWriter
+	streamed bool
+
+	data   bufioW // collected elements, unless streamed
+	chunks chunkWriter
+
+	limit     int // buffer size of w
+	n         int // number of elements
+	remaining int // pending elements of nested arrays
+	err       error
+}
+
+func (a *arrayWriter) Len() int { return a.n }
+
+func (a *arrayWriter) Write(p []byte) (int, error) {
+	if a.streamed {
+		return a.w.Write(p)
+	}
+	a.data.buf = append(a.data.buf, p...)
+	a.next()
+	return len(p), nil
+}
+
+func (a *arrayWriter) AppendArrayLen(n int) {
+	a.target().AppendArrayLen(n)
+	a.element(n)
+}
+
+func (a *arrayWriter) AppendMapLen(n int) {
+	AppendMapLen(a.target(), n)
+	a.element(n * 2)
+}
+
+func (a *arrayWriter) Protocol() int { return Protocol(a.w) }
+
+func (a *arrayWriter) SetProtocol(v int) {
+	if pw, ok := a.w.(ProtocolWriter); ok {
+		pw.SetProtocol(v)
+	}
+	a.data.SetProtocol(v)
+}
+
+func (a *arrayWriter) AppendBulk(p []byte) {
+	a.target().AppendBulk(p)
+	a.element(0)
+}
+
+func (a *arrayWriter) AppendBulkString(s string) {
+	a.target().AppendBulkString(s)
+	a.element(0)
+}
+
+func (a *arrayWriter) AppendInline(p []byte) {
+	a.target().AppendInline(p)
+	a.element(0)
+}
+
+func (a *arrayWriter) AppendInlineString(s string) {
+	a.target().AppendInlineString(s)
+	a.element(0)
+}
+
+func (a *arrayWriter) AppendError(msg string) {
+	a.target().AppendError(msg)
+	a.element(0)
+}
+
+func (a *arrayWriter) AppendErrorf(pattern string, args ...interface{}) {
+	a.AppendError(fmt.Sprintf(pattern, args...))
+}
+
+func (a *arrayWriter) AppendInt(n int64) {
+	a.target().AppendInt(n)
+	a.element(0)
+}
+
+func (a *arrayWriter) AppendNil() {
+	a.target().AppendNil()
+	a.element(0)
+}
+
+func (a *arrayWriter) AppendOK() {
+	a.target().AppendOK()
+	a.element(0)
+}
+
+func (a *arrayWriter) Append(v interface{}) error {
+	if err := a.target().Append(v); err != nil {
+		return err
+	}
+	a.element(0)
+	return nil
+}
+
+func (a *arrayWriter) CopyBulk(src io.Reader, n int64) error {
+	if err := a.target().CopyBulk(src, n); err != nil {
+		return err
+	}
+	a.element(0)
+	return nil
+}
+
+// Buffered returns the number of collected bytes or, if streamed, the
+// number of bytes pending in the underlying writer.
+func (a *arrayWriter) Buffered() int {
+	if a.streamed {
+		return a.w.Buffered()
+	}
+	return a.chunks.size + len(a.data.buf)
+}
+
+// Flush flushes the underlying writer, if streamed. It is a no-op otherwise,
+// as collected elements can only be written on Close.
+func (a *arrayWriter) Flush() error {
+	if a.streamed {
+		return a.w.Flush()
+	}
+	return nil
+}
+
+// Reset discards collected elements and resets the underlying writer.
+func (a *arrayWriter) Reset(w io.Writer) {
+	a.w.Reset(w)
+	a.data.buf = a.data.buf[:0]
+	a.chunks = chunkWriter{}
+	a.n, a.remaining, a.err = 0, 0, nil
+}
+
+func (a *arrayWriter) Close() error {
+	if a.err != nil {
+		return a.err
+	}
+	if a.streamed {
+		return appendRaw(a.w, binStreamEnd)
+	}
+
+	// the header is written raw, like the collected elements
+	header := strconv.AppendInt([]byte{'*'}, int64(a.n), 10)
+	if err := appendRaw(a.w, append(header, binCRLF...)); err != nil {
+		return err
+	}
+	for _, chunk := range append(a.chunks.chunks, a.data.buf) {
+		if err := appendRaw(a.w, chunk); err != nil {
+			return err
+		}
+		if a.w.Buffered() > a.limit/2 {
+			if err := a.w.Flush(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (a *arrayWriter) target() ResponseWriter {
+	if a.streamed {
+		return a.w
+	}
+	return &a.data
+}
+
+// element counts an appended element, which may start a nested
+// array of n elements.
+func (a *arrayWriter) element(n int) {
+	if a.remaining != 0 {
+		a.remaining--
+	} else {
+		a.n++
+	}
+	if n > 0 {
+		a.remaining += n
+	}
+	a.next()
+}
+
+// next flushes the underlying writer, if streamed, or moves
+// collected elements into a chunk.
+func (a *arrayWriter) next() {
+	if a.streamed {
+		if a.err == nil && a.w.Buffered() > a.limit/2 {
+			a.err = a.w.Flush()
+		}
+		return
+	}
+
+	if len(a.data.buf) >= a.limit {
+		_ = a.data.flush()
+	}
+}
+
+// appendRaw appends raw bytes to the output buffer of w. If p exceeds the
+// available buffer or if w is not the standard implementation, w is flushed
+// before p is written directly.
+func appendRaw(w ResponseWriter, p []byte) error {
+	if b, ok := w.(*bufioW); ok {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		if len(b.buf)+len(p) <= cap(b.buf) {
+			b.buf = append(b.buf, p...)
+			return nil
+		}
+		if err := b.flush(); err != nil {
+			return err
+		}
+		_, err := b.Write(p)
+		return err
+	}
+
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	_, err := w.Write(p)
+	return err
+}
+
+// chunkWriter collects written data in chunks.
+type chunkWriter struct {
+	chunks [][]byte
+	size   int
+}
+
+func (c *chunkWriter) Write(p []byte) (int, error) {
+	c.chunks = append(c.chunks, append(make([]byte, 0, len(p)), p...))
+	c.size += len(p)
+	return len(p), nil
+}
@@ -0,0 +1,212 @@
+package resp_test
+
+import (
+	"bytes"
+	"strings"
+
+	. "github.com/bsm/ginkgo/v2"
+	. "github.com/bsm/gomega"
+	"github.com/bsm/redeo/v2/resp"
+)
+
+var _ = Describe("ArrayWriter", func() {
+	var w resp.ResponseWriter
+	var buf = new(bytes.Buffer)
+
+	BeforeEach(func() {
+		buf.Reset()
+		w = resp.NewResponseWriter(buf)
+	})
+
+	read := func() []interface{} {
+		r := resp.NewResponseReader(bytes.NewReader(buf.Bytes()))
+		n, err := r.ReadArrayLen()
+		Expect(err).NotTo(HaveOccurred())
+
+		vv := make([]interface{}, 0, n)
+		for i := 0; i < n; i++ {
+			t, err := r.PeekType()
+			Expect(err).NotTo(HaveOccurred())
+
+			switch t {
+			case resp.TypeArray:
+				var ss []string
+				Expect(r.Scan(&ss)).To(Succeed())
+				vv = append(vv, ss)
+			case resp.TypeInt:
+				n, err := r.ReadInt()
+				Expect(err).NotTo(HaveOccurred())
+				vv = append(vv, n)
+			default:
+				var s string
+				Expect(r.Scan(&s)).To(Succeed())
+				vv = append(vv, s)
+			}
+		}
+		Expect(r.Buffered()).To(BeZero())
+		return vv
+	}
+
+	It("should collect elements", func() {
+		w.AppendOK()
+
+		a := resp.NewArrayWriter(w)
+		a.AppendBulkString("foo")
+		a.AppendInt(33)
+		a.AppendArrayLen(2)
+		a.AppendBulkString("a")
+		a.AppendBulkString("b")
+		Expect(a.Append([]string{"c", "d"})).To(Succeed())
+		a.AppendNil()
+		Expect(a.CopyBulk(strings.NewReader("bar"), 3)).To(Succeed())
+		Expect(a.Len()).To(Equal(6))
+		Expect(a.Buffered()).To(Equal(64))
+		Expect(a.Flush()).To(Succeed())
+		Expect(buf.Len()).To(BeZero())
+
+		Expect(a.Close()).To(Succeed())
+		Expect(w.Flush()).To(Succeed())
+		Expect(buf.String()).To(Equal("+OK\r\n" +
+			"*6\r\n$3\r\nfoo\r\n:33\r\n*2\r\n$1\r\na\r\n$1\r\nb\r\n*2\r\n$1\r\nc\r\n$1\r\nd\r\n$-1\r\n$3\r\nbar\r\n"))
+	})
+
+	It("should count maps", func() {
+		w.(resp.ProtocolWriter).SetProtocol(3)
+
+		a := resp.NewStreamedArrayWriter(w)
+		resp.AppendMapLen(a, 1)
+		a.AppendBulkString("a")
+		a.AppendInt(1)
+		Expect(a.Append(map[string]int{"b": 2})).To(Succeed())
+		Expect(a.Len()).To(Equal(2))
+		Expect(a.Close()).To(Succeed())
+		Expect(w.Flush()).To(Succeed())
+		Expect(buf.String()).To(Equal("*?\r\n%1\r\n$1\r\na\r\n:1\r\n%1\r\n$1\r\nb\r\n:2\r\n.\r\n"))
+	})
+
+	It("should write empty arrays", func() {
+		a := resp.NewArrayWriter(w)
+		Expect(a.Close()).To(Succeed())
+		Expect(w.Flush()).To(Succeed())
+		Expect(buf.String()).To(Equal("*0\r\n"))
+	})
+
+	It("should collect large arrays in chunks", func() {
+		a := resp.NewArrayWriter(w)
+		for i := 0; i < 20000; i++ {
+			a.AppendBulkString("value")
+		}
+		Expect(a.Buffered()).To(Equal(20000 * 11))
+		Expect(buf.Len()).To(BeZero())
+
+		Expect(a.Close()).To(Succeed())
+		Expect(buf.Len()).To(BeNumerically(">", resp.MaxBufferSize))
+		Expect(w.Flush()).To(Succeed())
+		Expect(read()).To(HaveLen(20000))
+	})
+
+	It("should collect chunks according to the buffer size", func() {
+		w = resp.NewResponseWriterSize(buf, 1024)
+		a := resp.NewArrayWriter(w)
+		for i := 0; i < 1000; i++ {
+			a.AppendBulkString("value")
+		}
+		Expect(buf.Len()).To(BeZero())
+
+		Expect(a.Close()).To(Succeed())
+		Expect(buf.Len()).To(BeNumerically(">", 5000))
+		Expect(w.Buffered()).To(BeNumerically("<=", 1024))
+		Expect(w.Flush()).To(Succeed())
+		Expect(read()).To(HaveLen(1000))
+	})
+
+	It("should support custom response writers", func() {
+		w.AppendOK()
+		wrapped := &wrappedWriter{ResponseWriter: w}
+
+		a := resp.NewArrayWriter(wrapped)
+		a.AppendBulkString("foo")
+		Expect(a.Close()).To(Succeed())
+		Expect(wrapped.Flush()).To(Succeed())
+		Expect(buf.String()).To(Equal("+OK\r\n*1\r\n$3\r\nfoo\r\n"))
+	})
+
+	It("should fall back to RESP2 for custom response writers", func() {
+		w.(resp.ProtocolWriter).SetProtocol(3)
+		wrapped := &wrappedWriter{ResponseWriter: w}
+		Expect(resp.Protocol(wrapped)).To(Equal(2))
+
+		resp.AppendMapLen(wrapped, 1)
+		wrapped.AppendBulkString("a")
+		wrapped.AppendInt(1)
+
+		a := resp.NewArrayWriter(wrapped)
+		a.AppendBulkString("foo")
+		Expect(a.Close()).To(Succeed())
+		Expect(wrapped.Flush()).To(Succeed())
+		Expect(buf.String()).To(Equal("*2\r\n$1\r\na\r\n:1\r\n*1\r\n$3\r\nfoo\r\n"))
+	})
+
+	It("should reset", func() {
+		a := resp.NewArrayWriter(w)
+		a.AppendBulkString("foo")
+		a.Reset(buf)
+		Expect(a.Len()).To(BeZero())
+		a.AppendInt(1)
+		Expect(a.Close()).To(Succeed())
+		Expect(w.Flush()).To(Succeed())
+		Expect(buf.String()).To(Equal("*1\r\n:1\r\n"))
+	})
+
+	Describe("streamed", func() {
+		It("should stream elements", func() {
+			a := resp.NewStreamedArrayWriter(w)
+			a.AppendBulkString("foo")
+			a.AppendArrayLen(1)
+			a.AppendInt(1)
+			Expect(a.Len()).To(Equal(2))
+			Expect(a.Close()).To(Succeed())
+			Expect(w.Flush()).To(Succeed())
+			Expect(buf.String()).To(Equal("*?\r\n$3\r\nfoo\r\n*1\r\n:1\r\n.\r\n"))
+		})
+
+		It("should flush as it goes", func() {
+			a := resp.NewStreamedArrayWriter(w)
+			for i := 0; i < 5000; i++ {
+				a.AppendBulkString("value")
+			}
+			Expect(buf.Len()).To(BeNumerically(">", resp.MaxBufferSize/2))
+			Expect(a.Buffered()).To(BeNumerically("<=", resp.MaxBufferSize/2))
+
+			Expect(a.Close()).To(Succeed())
+			Expect(w.Flush()).To(Succeed())
+			Expect(buf.String()).To(HavePrefix("*?\r\n$5\r\nvalue\r\n"))
+			Expect(buf.String()).To(HaveSuffix("$5\r\nvalue\r\n.\r\n"))
+			Expect(buf.Len()).To(Equal(4 + 5000*11 + 3))
+		})
+
+		It("should flush according to the buffer size", func() {
+			w = resp.NewResponseWriterSize(buf, 1024)
+			a := resp.NewStreamedArrayWriter(w)
+			for i := 0; i < 100; i++ {
+				a.AppendBulkString("value")
+			}
+			Expect(buf.Len()).To(BeNumerically(">", 512))
+			Expect(a.Buffered()).To(BeNumerically("<=", 512))
+			Expect(a.Close()).To(Succeed())
+		})
+
+		It("should be chosen for RESP3 writers", func() {
+			w.(resp.ProtocolWriter).SetProtocol(3)
+			a := resp.NewArrayWriter(w)
+			a.AppendBulkString("foo")
+			Expect(a.Close()).To(Succeed())
+			Expect(w.Flush()).To(Succeed())
+			Expect(buf.String()).To(Equal("*?\r\n$3\r\nfoo\r\n.\r\n"))
+		})
+	})
+})
+
+type wrappedWriter struct {
+	resp.ResponseWriter
+}
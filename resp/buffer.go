@@ -0,0 +1,90 @@
+package resp
+
+import (
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// idleBufferSize is the size of the inline buffer used by pooled
+// readers while idle.
+const idleBufferSize = 512
+
+// sizedPools holds the buffers of all BufferPools, keyed by size.
+var sizedPools sync.Map
+
+// BufferPool recycles buffers of a fixed size between pooled readers
+// and writers. Pooled readers and writers hold buffers only while they
+// have pending data and hand them back to the pool once drained, which
+// keeps the memory footprint of idle connections small.
+//
+// Buffers are shared between all pools of the same size, while usage is
+// accounted per pool. BufferPools are safe for concurrent use.
+type BufferPool struct {
+	size  int
+	pool  *sync.Pool
+	inUse int64
+}
+
+// NewBufferPool creates a pool of buffers with the given size.
+// Non-positive sizes default to MaxBufferSize.
+func NewBufferPool(size int) *BufferPool {
+	if size <= 0 {
+		size = MaxBufferSize
+	}
+
+	v, ok := sizedPools.Load(size)
+	if !ok {
+		v, _ = sizedPools.LoadOrStore(size, new(sync.Pool))
+	}
+	return &BufferPool{size: size, pool: v.(*sync.Pool)}
+}
+
+// Size returns the buffer size.
+func (p *BufferPool) Size() int { return p.size }
+
+// InUse returns the number of bytes currently held by readers and writers,
+// including buffers which have grown beyond the pool size.
+func (p *BufferPool) InUse() int64 { return atomic.LoadInt64(&p.inUse) }
+
+func (p *BufferPool) get() []byte {
+	atomic.AddInt64(&p.inUse, int64(p.size))
+	if v := p.pool.Get(); v != nil {
+		return *(v.(*[]byte))
+	}
+	return make([]byte, p.size)
+}
+
+// track accounts n additional bytes, held by grown buffers.
+func (p *BufferPool) track(n int) {
+	atomic.AddInt64(&p.inUse, int64(n))
+}
+
+// put returns a buffer acquired via get or accounted via track. Buffers
+// which have grown beyond the pool size are dropped.
+func (p *BufferPool) put(buf []byte) {
+	atomic.AddInt64(&p.inUse, -int64(cap(buf)))
+	if cap(buf) == p.size {
+		buf = buf[:cap(buf)]
+		p.pool.Put(&buf)
+	}
+}
+
+// NewPooledRequestReader wraps any reader interface, using buffers from p.
+// While idle, the reader holds only a small inline buffer.
+func NewPooledRequestReader(rd io.Reader, p *BufferPool) *RequestReader {
+	r := &bufioR{pool: p}
+	r.reset(nil, rd)
+
+	rr := &RequestReader{r: r}
+	rr.SetLimits(nil)
+	return rr
+}
+
+// NewPooledResponseWriter wraps any writer interface, using buffers from p.
+// Buffers are acquired on the first append and released on Flush.
+func NewPooledResponseWriter(wr io.Writer, p *BufferPool) ResponseWriter {
+	w := &bufioW{pool: p}
+	w.reset(nil, wr)
+	return w
+}
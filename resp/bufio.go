@@ -6,6 +6,7 @@ import (
 	"io"
 	"strconv"
 	"sync"
+	"sync/atomic"
 )
 
 type bufioR struct {
@@ -13,6 +14,14 @@ type bufioR struct {
 	buf []byte
 
 	r, w int
+
+	maxBulkLen      int64 // 0 = unlimited
+	maxMultiBulkLen int   // 0 = unlimited
+	maxLineLen      int   // 0 = MaxBufferSize
+
+	pool   *BufferPool
+	pooled bool                  // buf is accounted to pool
+	idle   *[idleBufferSize]byte // inline buffer used while idle
 }
 
 // Buffered returns the number of buffered bytes
@@ -50,6 +59,8 @@ func (b *bufioR) PeekType() (t ResponseType, err error) {
 		t = TypeError
 	case ':':
 		t = TypeInt
+	case '%':
+		t = TypeMap
 	}
 	return
 }
@@ -98,6 +109,24 @@ func (b *bufioR) ReadArrayLen() (int, error) {
 	if err != nil {
 		return 0, err
 	}
+	if err := b.checkMultiBulkLen(sz); err != nil {
+		return 0, err
+	}
+	return int(sz), nil
+}
+
+func (b *bufioR) ReadMapLen() (int, error) {
+	line, err := b.ReadLine()
+	if err != nil {
+		return 0, err
+	}
+	sz, err := line.ParseSize('%', errInvalidMultiBulkLength)
+	if err != nil {
+		return 0, err
+	}
+	if err := b.checkMultiBulkLen(2 * sz); err != nil {
+		return 0, err
+	}
 	return int(sz), nil
 }
 
@@ -106,7 +135,28 @@ func (b *bufioR) ReadBulkLen() (int64, error) {
 	if err != nil {
 		return 0, err
 	}
-	return line.ParseSize('$', errInvalidBulkLength)
+	sz, err := line.ParseSize('$', errInvalidBulkLength)
+	if err != nil {
+		return 0, err
+	}
+	if err := b.checkBulkLen(sz); err != nil {
+		return 0, err
+	}
+	return sz, nil
+}
+
+func (b *bufioR) checkMultiBulkLen(n int64) error {
+	if b.maxMultiBulkLen > 0 && n > int64(b.maxMultiBulkLen) {
+		return ErrMultiBulkTooLarge
+	}
+	return nil
+}
+
+func (b *bufioR) checkBulkLen(n int64) error {
+	if b.maxBulkLen > 0 && n > b.maxBulkLen {
+		return ErrBulkTooLarge
+	}
+	return nil
 }
 
 func (b *bufioR) ReadBulk(p []byte) ([]byte, error) {
@@ -198,27 +248,34 @@ func (b *bufioR) PeekN(offset, n int) ([]byte, error) {
 
 // PeekLine returns the next line until CRLF without reading it
 func (b *bufioR) PeekLine(offset int) (bufioLn, error) {
-	index := -1
+	maxLen := b.maxLineLen
+	if maxLen <= 0 {
+		maxLen = MaxBufferSize
+	}
 
 	// try to find the end of the line
-	start := b.r + offset
-	if start < b.w {
-		index = bytes.IndexByte(b.buf[start:b.w], '\r')
-	}
+	var start, index, scanned int
+	for {
+		start = b.r + offset
+		if pos := start + scanned; pos < b.w {
+			if index = bytes.IndexByte(b.buf[pos:b.w], '\r'); index > -1 {
+				index += scanned
+				break
+			}
+			scanned = b.w - start
+		}
+
+		// fail if the line exceeds the limit
+		if scanned >= maxLen {
+			return nil, errInlineRequestTooLong
+		}
 
-	// try to read more data into the buffer if not in the buffer
-	if index < 0 {
+		// try to read more data into the buffer
 		if err := b.fill(); err != nil {
 			return nil, err
 		}
-		start = b.r + offset
-		if start < b.w {
-			index = bytes.IndexByte(b.buf[start:b.w], '\r')
-		}
 	}
-
-	// fail if still nothing found
-	if index < 0 {
+	if index > maxLen {
 		return nil, errInlineRequestTooLong
 	}
 	// Although rarely, make sure '\n' is buffered.
@@ -250,14 +307,13 @@ func (b *bufioR) require(sz int) error {
 		return nil
 	}
 
-	// compact first
+	// release drained buffers, compact
+	b.release()
 	b.compact()
 
 	// grow the buffer if necessary
 	if n := b.w + extra; n > len(b.buf) {
-		buf := make([]byte, n)
-		copy(buf, b.buf[:b.w])
-		b.buf = buf
+		b.grow(n)
 	}
 
 	// read data into buffer
@@ -266,16 +322,18 @@ func (b *bufioR) require(sz int) error {
 	return err
 }
 
-// fill tries to read more data into the buffer
+// fill tries to read more data into the buffer, growing it if full
 func (b *bufioR) fill() error {
+	b.release()
 	b.compact()
 
-	if b.w < len(b.buf) {
-		n, err := b.rd.Read(b.buf[b.w:])
-		b.w += n
-		return err
+	if b.w == len(b.buf) {
+		b.grow(b.w + 1)
 	}
-	return nil
+
+	n, err := b.rd.Read(b.buf[b.w:])
+	b.w += n
+	return err
 }
 
 // compact moves the unread chunk to the beginning of the buffer
@@ -287,8 +345,62 @@ func (b *bufioR) compact() {
 	}
 }
 
+// grow replaces the buffer with one of at least n bytes, retaining
+// buffered data. Pooled readers grow into pooled buffers where possible,
+// larger buffers are accounted to the pool until released.
+func (b *bufioR) grow(n int) {
+	var buf []byte
+	if b.pool != nil && !b.pooled && n <= b.pool.size {
+		buf = b.pool.get()
+	} else {
+		if m := 2 * len(b.buf); n < m {
+			n = m
+		}
+		buf = make([]byte, n)
+		if b.pool != nil {
+			b.pool.track(cap(buf))
+		}
+	}
+	copy(buf, b.buf[:b.w])
+
+	if b.pooled {
+		b.pool.put(b.buf)
+	}
+	b.buf, b.pooled = buf, b.pool != nil
+}
+
+// release falls back to the idle buffer once drained, handing
+// pooled buffers back to the pool.
+func (b *bufioR) release() {
+	if b.pool == nil || b.r != b.w {
+		return
+	}
+	if b.pooled {
+		b.pool.put(b.buf)
+		b.pooled = false
+	}
+	b.buf = b.idle[:]
+	b.r, b.w = 0, 0
+}
+
 func (b *bufioR) reset(buf []byte, rd io.Reader) {
-	*b = bufioR{buf: buf, rd: rd}
+	*b = bufioR{
+		buf:             buf,
+		rd:              rd,
+		maxBulkLen:      b.maxBulkLen,
+		maxMultiBulkLen: b.maxMultiBulkLen,
+		maxLineLen:      b.maxLineLen,
+		pool:            b.pool,
+		pooled:          b.pooled,
+		idle:            b.idle,
+	}
+
+	if b.pool != nil {
+		if b.idle == nil {
+			b.idle = new([idleBufferSize]byte)
+		}
+		b.release()
+	}
 }
 
 // --------------------------------------------------------------------
@@ -433,8 +545,30 @@ func (ln bufioLn) ParseSize(prefix byte, fallback error) (int64, error) {
 
 type bufioW struct {
 	io.Writer
-	buf []byte
-	mu  sync.Mutex
+	buf   []byte
+	mu    sync.Mutex
+	pool  *BufferPool
+	held  int   // capacity of buf, accounted to pool
+	size  int   // configured buffer size
+	proto int32 // protocol version, accessed atomically
+}
+
+// lock locks the writer and acquires a pooled buffer, if released.
+func (b *bufioW) lock() {
+	b.mu.Lock()
+	if b.buf == nil && b.pool != nil {
+		b.buf = b.pool.get()[:0]
+		b.held = cap(b.buf)
+	}
+}
+
+// unlock accounts grown pooled buffers and unlocks the writer.
+func (b *bufioW) unlock() {
+	if b.pool != nil && cap(b.buf) != b.held {
+		b.pool.track(cap(b.buf) - b.held)
+		b.held = cap(b.buf)
+	}
+	b.mu.Unlock()
 }
 
 // Buffered returns the number of buffered bytes
@@ -447,54 +581,78 @@ func (b *bufioW) Buffered() int {
 
 // AppendArrayLen appends an array header to the output buffer
 func (b *bufioW) AppendArrayLen(n int) {
-	b.mu.Lock()
+	b.lock()
 	b.appendSize('*', int64(n))
-	b.mu.Unlock()
+	b.unlock()
+}
+
+// AppendMapLen appends a map header to the output buffer
+func (b *bufioW) AppendMapLen(n int) {
+	b.lock()
+	if b.Protocol() >= 3 {
+		b.appendSize('%', int64(n))
+	} else {
+		b.appendSize('*', int64(n)*2)
+	}
+	b.unlock()
+}
+
+// Protocol returns the protocol version
+func (b *bufioW) Protocol() int {
+	if v := atomic.LoadInt32(&b.proto); v != 0 {
+		return int(v)
+	}
+	return 2
+}
+
+// SetProtocol sets the protocol version
+func (b *bufioW) SetProtocol(v int) {
+	atomic.StoreInt32(&b.proto, int32(v))
 }
 
 // AppendBulk appends bulk bytes to the output buffer
 func (b *bufioW) AppendBulk(p []byte) {
-	b.mu.Lock()
+	b.lock()
 	b.appendSize('$', int64(len(p)))
 	b.buf = append(b.buf, p...)
 	b.buf = append(b.buf, binCRLF...)
-	b.mu.Unlock()
+	b.unlock()
 }
 
 // AppendBulkString appends a bulk string to the output buffer
 func (b *bufioW) AppendBulkString(s string) {
-	b.mu.Lock()
+	b.lock()
 	b.appendSize('$', int64(len(s)))
 	b.buf = append(b.buf, s...)
 	b.buf = append(b.buf, binCRLF...)
-	b.mu.Unlock()
+	b.unlock()
 }
 
 // AppendInline appends inline bytes to the output buffer
 func (b *bufioW) AppendInline(p []byte) {
-	b.mu.Lock()
+	b.lock()
 	b.buf = append(b.buf, '+')
 	b.buf = append(b.buf, p...)
 	b.buf = append(b.buf, binCRLF...)
-	b.mu.Unlock()
+	b.unlock()
 }
 
 // AppendInlineString appends an inline string to the output buffer
 func (b *bufioW) AppendInlineString(s string) {
-	b.mu.Lock()
+	b.lock()
 	b.buf = append(b.buf, '+')
 	b.buf = append(b.buf, s...)
 	b.buf = append(b.buf, binCRLF...)
-	b.mu.Unlock()
+	b.unlock()
 }
 
 // AppendError appends an error message to the output buffer
 func (b *bufioW) AppendError(msg string) {
-	b.mu.Lock()
+	b.lock()
 	b.buf = append(b.buf, '-')
 	b.buf = append(b.buf, msg...)
 	b.buf = append(b.buf, binCRLF...)
-	b.mu.Unlock()
+	b.unlock()
 }
 
 // AppendErrorf appends an error message to the output buffer
@@ -504,7 +662,7 @@ func (b *bufioW) AppendErrorf(pattern string, args ...interface{}) {
 
 // AppendInt appends a numeric response to the output buffer
 func (b *bufioW) AppendInt(n int64) {
-	b.mu.Lock()
+	b.lock()
 	switch n {
 	case 0:
 		b.buf = append(b.buf, binZERO...)
@@ -512,31 +670,31 @@ func (b *bufioW) AppendInt(n int64) {
 		b.buf = append(b.buf, binONE...)
 	default:
 		b.buf = append(b.buf, ':')
-		b.buf = append(b.buf, strconv.FormatInt(n, 10)...)
+		b.buf = strconv.AppendInt(b.buf, n, 10)
 		b.buf = append(b.buf, binCRLF...)
 	}
-	b.mu.Unlock()
+	b.unlock()
 }
 
 // AppendNil appends a nil-value to the output buffer
 func (b *bufioW) AppendNil() {
-	b.mu.Lock()
+	b.lock()
 	b.buf = append(b.buf, binNIL...)
-	b.mu.Unlock()
+	b.unlock()
 }
 
 // AppendOK appends "OK" to the output buffer
 func (b *bufioW) AppendOK() {
-	b.mu.Lock()
+	b.lock()
 	b.buf = append(b.buf, binOK...)
-	b.mu.Unlock()
+	b.unlock()
 }
 
 // CopyBulk flushes the existing buffer and read n bytes from the reader directly to
 // the client connection.
 func (b *bufioW) CopyBulk(src io.Reader, n int64) error {
-	b.mu.Lock()
-	defer b.mu.Unlock()
+	b.lock()
+	defer b.unlock()
 
 	b.appendSize('$', n)
 	if start := len(b.buf); int64(cap(b.buf)-start) >= n+2 {
@@ -567,6 +725,9 @@ func (b *bufioW) CopyBulk(src io.Reader, n int64) error {
 func (b *bufioW) Flush() error {
 	b.mu.Lock()
 	err := b.flush()
+	if err == nil {
+		b.release()
+	}
 	b.mu.Unlock()
 	return err
 }
@@ -591,10 +752,27 @@ func (b *bufioW) flush() error {
 
 func (b *bufioW) appendSize(c byte, n int64) {
 	b.buf = append(b.buf, c)
-	b.buf = append(b.buf, strconv.FormatInt(n, 10)...)
+	b.buf = strconv.AppendInt(b.buf, n, 10)
 	b.buf = append(b.buf, binCRLF...)
 }
 
+// release hands a drained buffer back to the pool.
+func (b *bufioW) release() {
+	if b.pool != nil && b.buf != nil && len(b.buf) == 0 {
+		b.pool.put(b.buf)
+		b.buf, b.held = nil, 0
+	}
+}
+
 func (b *bufioW) reset(buf []byte, wr io.Writer) {
-	*b = bufioW{buf: buf[:0], Writer: wr}
+	if b.pool != nil {
+		b.buf = b.buf[:0]
+		b.release()
+		buf = nil
+	}
+	size := cap(buf)
+	if b.pool != nil {
+		size = b.pool.size
+	}
+	*b = bufioW{buf: buf[:0], Writer: wr, pool: b.pool, size: size}
 }
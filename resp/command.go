@@ -37,7 +37,8 @@ type Command struct {
 	// Args returns arguments
 	Args []CommandArgument
 
-	ctx context.Context
+	ctx  context.Context
+	keys keySpec
 }
 
 // NewCommand returns a new command instance;
@@ -59,6 +60,21 @@ func (c *Command) ArgN() int {
 	return len(c.Args)
 }
 
+// Keys returns the key arguments, as defined by the key spec. Returns nil if
+// no key spec was set.
+func (c *Command) Keys() []CommandArgument {
+	return c.keys.Extract(c.Args)
+}
+
+// SetKeySpec sets the key spec, using the redis convention of first key, last
+// key and step count positions. Positions are counted from the command name,
+// i.e. first=1 refers to the first argument. A negative last position is
+// counted backwards from the last argument.
+// See https://redis.io/commands/command#first-key-in-argument-list.
+func (c *Command) SetKeySpec(first, last, step int64) {
+	c.keys = keySpec{First: first, Last: last, Step: step}
+}
+
 // Reset discards all data and resets all state
 func (c *Command) Reset() {
 	args := c.Args
@@ -135,6 +151,38 @@ func (c *Command) readInline(r *bufioR) (bool, error) {
 
 // --------------------------------------------------------------------
 
+type keySpec struct {
+	First, Last, Step int64
+}
+
+// Extract extracts keys from args.
+func (s keySpec) Extract(args []CommandArgument) []CommandArgument {
+	if s.First < 1 {
+		return nil
+	}
+
+	step := s.Step
+	if step < 1 {
+		step = 1
+	}
+
+	last := s.Last
+	if last < 0 {
+		last += int64(len(args)) + 1
+	}
+	if last > int64(len(args)) {
+		last = int64(len(args))
+	}
+
+	var keys []CommandArgument
+	for pos := s.First; pos <= last; pos += step {
+		keys = append(keys, args[pos-1])
+	}
+	return keys
+}
+
+// --------------------------------------------------------------------
+
 func readCommand(c interface {
 	readInline(*bufioR) (bool, error)
 	readMultiBulk(*bufioR, string, int) error
@@ -186,6 +234,7 @@ type CommandStream struct {
 	nargs int
 	pos   int
 	arg   io.ReadCloser
+	err   error // sticky read error
 
 	rd *bufioR
 }
@@ -205,7 +254,7 @@ func (c *CommandStream) Discard() error {
 		}
 	}
 
-	var err error
+	err := c.err
 	if c.arg != nil {
 		if e := c.arg.Close(); e != nil {
 			err = e
@@ -213,7 +262,7 @@ func (c *CommandStream) Discard() error {
 		c.arg = nil
 	}
 
-	if c.rd != nil {
+	if c.rd != nil && c.err == nil {
 		for ; c.pos < c.nargs; c.pos++ {
 			if e := c.rd.SkipBulk(); e != nil {
 				err = e
@@ -253,10 +302,13 @@ func (c *CommandStream) Next() (io.Reader, error) {
 		return arg, nil
 	}
 
-	var err error
-	c.arg, err = c.rd.StreamBulk()
+	if c.err != nil {
+		return nil, c.err
+	}
+
+	c.arg, c.err = c.rd.StreamBulk()
 	c.pos++
-	return c.arg, err
+	return c.arg, c.err
 }
 
 // Context returns the context
@@ -0,0 +1,42 @@
+package resp_test
+
+import (
+	. "github.com/bsm/ginkgo/v2"
+	. "github.com/bsm/gomega"
+	"github.com/bsm/redeo/v2/resp"
+)
+
+var _ = Describe("Command", func() {
+	args := func(ss ...string) []resp.CommandArgument {
+		aa := make([]resp.CommandArgument, 0, len(ss))
+		for _, s := range ss {
+			aa = append(aa, resp.CommandArgument(s))
+		}
+		return aa
+	}
+
+	DescribeTable("should extract keys",
+		func(first, last, step int64, cmd *resp.Command, exp []resp.CommandArgument) {
+			cmd.SetKeySpec(first, last, step)
+			Expect(cmd.Keys()).To(Equal(exp))
+		},
+
+		Entry("no spec", int64(0), int64(0), int64(0), resp.NewCommand("PING"), nil),
+		Entry("single", int64(1), int64(1), int64(1), resp.NewCommand("GET", args("k1")...), args("k1")),
+		Entry("missing", int64(1), int64(1), int64(1), resp.NewCommand("GET"), nil),
+		Entry("all", int64(1), int64(-1), int64(1), resp.NewCommand("DEL", args("k1", "k2", "k3")...), args("k1", "k2", "k3")),
+		Entry("stepped", int64(1), int64(-1), int64(2), resp.NewCommand("MSET", args("k1", "v1", "k2", "v2")...), args("k1", "k2")),
+		Entry("trailing", int64(1), int64(-2), int64(1), resp.NewCommand("BLPOP", args("k1", "k2", "0")...), args("k1", "k2")),
+		Entry("offset", int64(2), int64(2), int64(1), resp.NewCommand("OBJECT", args("encoding", "k1")...), args("k1")),
+	)
+
+	It("should reset key specs", func() {
+		cmd := resp.NewCommand("GET", resp.CommandArgument("k1"))
+		cmd.SetKeySpec(1, 1, 1)
+		Expect(cmd.Keys()).To(HaveLen(1))
+
+		cmd.Reset()
+		cmd.Args = args("k1")
+		Expect(cmd.Keys()).To(BeNil())
+	})
+})
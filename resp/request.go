@@ -4,6 +4,43 @@ import (
 	"io"
 )
 
+// RequestLimits limits the size of requests accepted by RequestReader.
+// Requests exceeding the limits are rejected with protocol errors, see
+// IsLimitError.
+type RequestLimits struct {
+	// MaxBulkLen is the maximum length of a bulk argument,
+	// like proto-max-bulk-len in redis.
+	// Default: 512MB
+	MaxBulkLen int64
+
+	// MaxMultiBulkLen is the maximum number of arguments per request,
+	// including the command name.
+	// Default: 1048576
+	MaxMultiBulkLen int
+
+	// MaxInlineLen is the maximum length of inline requests
+	// and protocol lines.
+	// Default: 64KB (MaxBufferSize)
+	MaxInlineLen int
+}
+
+func (l *RequestLimits) norm() RequestLimits {
+	var ll RequestLimits
+	if l != nil {
+		ll = *l
+	}
+	if ll.MaxBulkLen <= 0 {
+		ll.MaxBulkLen = 512 * 1024 * 1024
+	}
+	if ll.MaxMultiBulkLen <= 0 {
+		ll.MaxMultiBulkLen = 1024 * 1024
+	}
+	if ll.MaxInlineLen <= 0 {
+		ll.MaxInlineLen = MaxBufferSize
+	}
+	return ll
+}
+
 // RequestReader is used by servers to wrap a client connection and convert
 // requests into commands.
 type RequestReader struct {
@@ -12,9 +49,27 @@ type RequestReader struct {
 
 // NewRequestReader wraps any reader interface
 func NewRequestReader(rd io.Reader) *RequestReader {
+	return NewRequestReaderSize(rd, MaxBufferSize)
+}
+
+// NewRequestReaderSize wraps any reader interface, using a buffer of
+// (at least) the given size. Buffers grow as needed to accommodate
+// large requests.
+func NewRequestReaderSize(rd io.Reader, size int) *RequestReader {
 	r := new(bufioR)
-	r.reset(mkStdBuffer(), rd)
-	return &RequestReader{r: r}
+	r.reset(mkBuffer(size), rd)
+
+	rr := &RequestReader{r: r}
+	rr.SetLimits(nil)
+	return rr
+}
+
+// SetLimits applies request limits. Pass nil to restore the defaults.
+func (r *RequestReader) SetLimits(limits *RequestLimits) {
+	l := limits.norm()
+	r.r.maxBulkLen = l.MaxBulkLen
+	r.r.maxMultiBulkLen = l.MaxMultiBulkLen
+	r.r.maxLineLen = l.MaxInlineLen
 }
 
 // Buffered returns the number of unread bytes.
@@ -99,6 +154,9 @@ func (r *RequestReader) peekCmd(offset int) (string, error) {
 	if err != nil {
 		return "", err
 	}
+	if err := r.r.checkMultiBulkLen(n); err != nil {
+		return "", err
+	}
 
 	if n < 1 {
 		return r.peekCmd(offset)
@@ -114,6 +172,9 @@ func (r *RequestReader) peekCmd(offset int) (string, error) {
 	if err != nil {
 		return "", err
 	}
+	if err := r.r.checkBulkLen(n); err != nil {
+		return "", err
+	}
 
 	data, err := r.r.PeekN(offset, int(n))
 	return string(data), err
@@ -128,8 +189,14 @@ type RequestWriter struct {
 
 // NewRequestWriter wraps any Writer interface
 func NewRequestWriter(wr io.Writer) *RequestWriter {
+	return NewRequestWriterSize(wr, MaxBufferSize)
+}
+
+// NewRequestWriterSize wraps any Writer interface, using a buffer
+// of the given initial size.
+func NewRequestWriterSize(wr io.Writer, size int) *RequestWriter {
 	w := new(bufioW)
-	w.reset(mkStdBuffer(), wr)
+	w.reset(mkBuffer(size), wr)
 	return &RequestWriter{w: w}
 }
 
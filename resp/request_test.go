@@ -328,6 +328,129 @@ var _ = Describe("RequestReader", func() {
 			"*2\r\n$4\r\nECHO\r\n$100000\r\n"+strings.Repeat("x", 100000)+"\r\n"),
 	)
 
+	It("should support custom buffer sizes", func() {
+		buf := new(bytes.Buffer)
+		w := resp.NewRequestWriterSize(buf, 8)
+		w.WriteCmdString("ECHO", strings.Repeat("x", 30))
+		w.WriteCmdString("PING")
+		Expect(w.Flush()).To(Succeed())
+		buf.WriteString("ECHO " + strings.Repeat("y", 20) + "\r\n")
+
+		r := resp.NewRequestReaderSize(buf, 8)
+		Expect(r.PeekCmd()).To(Equal("ECHO"))
+		cmd, err := r.ReadCmd(nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cmd).To(MatchCommand("ECHO", strings.Repeat("x", 30)))
+		Expect(r.SkipCmd()).To(Succeed())
+		cmd, err = r.ReadCmd(cmd)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cmd).To(MatchCommand("ECHO", strings.Repeat("y", 20)))
+	})
+
+	It("should support pooled buffers", func() {
+		pool := resp.NewBufferPool(1024)
+		buf := new(bytes.Buffer)
+		w := resp.NewRequestWriter(buf)
+		for i := 0; i < 10; i++ {
+			w.WriteCmdString("ECHO", strings.Repeat("x", 300*i))
+		}
+		Expect(w.Flush()).To(Succeed())
+
+		r := resp.NewPooledRequestReader(buf, pool)
+		var cmd *resp.Command
+		for i := 0; i < 10; i++ {
+			var err error
+			cmd, err = r.ReadCmd(cmd)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cmd).To(MatchCommand("ECHO", strings.Repeat("x", 300*i)))
+		}
+		Expect(pool.InUse()).To(BeNumerically(">", 1024), "grown buffers are accounted")
+
+		_, err := r.PeekCmd()
+		Expect(err).To(MatchError(io.EOF))
+		Expect(pool.InUse()).To(BeZero())
+	})
+
+	It("should read inline requests in chunks", func() {
+		pr, pw := io.Pipe()
+		defer pr.Close()
+
+		go func() {
+			defer pw.Close()
+			_, _ = pw.Write([]byte("ECHO "))
+			_, _ = pw.Write([]byte("HELLO\r\n"))
+		}()
+
+		cmd, err := resp.NewRequestReader(pr).ReadCmd(nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cmd).To(MatchCommand("ECHO", "HELLO"))
+	})
+
+	DescribeTable("should enforce limits",
+		func(s string, err error) {
+			r := setup(s)
+			r.SetLimits(&resp.RequestLimits{MaxBulkLen: 8, MaxMultiBulkLen: 3, MaxInlineLen: 16})
+
+			_, err1 := r.PeekCmd()
+			Expect(err1).To(Equal(err))
+
+			r = setup(s)
+			r.SetLimits(&resp.RequestLimits{MaxBulkLen: 8, MaxMultiBulkLen: 3, MaxInlineLen: 16})
+			_, err2 := r.ReadCmd(nil)
+			Expect(err2).To(Equal(err))
+			Expect(resp.IsLimitError(err2)).To(BeTrue())
+			Expect(resp.IsProtocolError(err2)).To(BeTrue())
+
+			r = setup(s)
+			r.SetLimits(&resp.RequestLimits{MaxBulkLen: 8, MaxMultiBulkLen: 3, MaxInlineLen: 16})
+			_, err3 := r.StreamCmd(nil)
+			Expect(err3).To(Equal(err))
+		},
+
+		Entry("bulk length", "*2\r\n$123456789\r\n", resp.ErrBulkTooLarge),
+		Entry("multibulk length", "*2147483647\r\n", resp.ErrMultiBulkTooLarge),
+		Entry("inline length", "ECHO "+strings.Repeat("x", 20)+"\r\n", resp.ErrInlineTooLarge),
+		Entry("unterminated inline", "ECHO "+strings.Repeat("x", 20), resp.ErrInlineTooLarge),
+	)
+
+	It("should enforce bulk limits on streamed arguments", func() {
+		r := setup("*3\r\n$4\r\nECHO\r\n$3\r\nabc\r\n$9\r\nxxxxxxxxx\r\n")
+		r.SetLimits(&resp.RequestLimits{MaxBulkLen: 8})
+
+		cmd, err := r.StreamCmd(nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cmd.Name).To(Equal("ECHO"))
+
+		arg, err := cmd.Next()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(io.ReadAll(arg)).To(Equal([]byte("abc")))
+		_, err = cmd.Next()
+		Expect(err).To(Equal(resp.ErrBulkTooLarge))
+	})
+
+	It("should accept requests within limits", func() {
+		r := setup("*3\r\n$4\r\nECHO\r\n$8\r\nxxxxxxxx\r\n$1\r\ny\r\nECHO " + strings.Repeat("x", 9) + "\r\n")
+		r.SetLimits(&resp.RequestLimits{MaxBulkLen: 8, MaxMultiBulkLen: 3, MaxInlineLen: 16})
+
+		cmd, err := r.ReadCmd(nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cmd).To(MatchCommand("ECHO", "xxxxxxxx", "y"))
+
+		cmd, err = r.ReadCmd(cmd)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cmd).To(MatchCommand("ECHO", "xxxxxxxxx"))
+	})
+
+	It("should read inline requests larger than the buffer, if permitted", func() {
+		r := setup("ECHO " + strings.Repeat("x", 100000) + "\r\n")
+		r.SetLimits(&resp.RequestLimits{MaxInlineLen: 200000})
+
+		cmd, err := r.ReadCmd(nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cmd.Name).To(Equal("ECHO"))
+		Expect(cmd.Arg(0)).To(HaveLen(100000))
+	})
+
 })
 
 var _ = Describe("RequestWriter", func() {
@@ -25,6 +25,8 @@ func (t ResponseType) String() string {
 		return "Int"
 	case TypeNil:
 		return "Nil"
+	case TypeMap:
+		return "Map"
 	}
 	return "Unknown"
 }
@@ -38,6 +40,7 @@ const (
 	TypeError
 	TypeInt
 	TypeNil
+	TypeMap
 )
 
 // --------------------------------------------------------------------
@@ -92,6 +95,23 @@ const (
 	errBadResponseType        = protoError("Protocol error: bad response type")
 )
 
+// Errors returned by RequestReader when requests exceed RequestLimits.
+const (
+	ErrBulkTooLarge      = protoError("Protocol error: bulk length exceeds limit")
+	ErrMultiBulkTooLarge = protoError("Protocol error: multibulk length exceeds limit")
+	ErrInlineTooLarge    = errInlineRequestTooLong
+)
+
+// IsLimitError returns true if the error was caused by a request
+// exceeding RequestLimits.
+func IsLimitError(err error) bool {
+	switch err {
+	case ErrBulkTooLarge, ErrMultiBulkTooLarge, ErrInlineTooLarge:
+		return true
+	}
+	return false
+}
+
 var (
 	binCRLF = []byte("\r\n")
 	binOK   = []byte("+OK\r\n")
@@ -100,7 +120,14 @@ var (
 	binNIL  = []byte("$-1\r\n")
 )
 
-// MaxBufferSize is the max request/response buffer size
+// MaxBufferSize is the default request/response buffer size
 const MaxBufferSize = 64 * 1024
 
-func mkStdBuffer() []byte { return make([]byte, MaxBufferSize) }
+// mkBuffer creates a buffer of the given size, falling back
+// to MaxBufferSize for non-positive sizes.
+func mkBuffer(size int) []byte {
+	if size <= 0 {
+		size = MaxBufferSize
+	}
+	return make([]byte, size)
+}
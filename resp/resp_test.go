@@ -3,8 +3,10 @@ package resp_test
 import (
 	"bytes"
 	"fmt"
+	"net"
 	"reflect"
 	"testing"
+	"time"
 
 	. "github.com/bsm/ginkgo/v2"
 	. "github.com/bsm/gomega"
@@ -127,3 +129,55 @@ func (s *ScannableStruct) ScanResponse(t resp.ResponseType, r resp.ResponseReade
 
 	return r.Scan(&s.Name, &s.Arity, &s.Flags, &s.FirstKey, &s.LastKey, &s.KeyStep)
 }
+
+type ScanAddress struct {
+	City string `resp:"city"`
+	Zip  int    `resp:"zip"`
+}
+
+type ScanUser struct {
+	Name    string        `resp:"name"`
+	Age     int           `resp:"age"`
+	Tags    []string      `resp:"tags"`
+	Created time.Time     `resp:"created"`
+	TTL     time.Duration `resp:"ttl"`
+	PTTL    time.Duration `resp:"pttl,ms"`
+	Addr    ScanAddress   `resp:"addr"`
+	Home    *ScanAddress  `resp:"home"`
+	IP      net.IP        `resp:"ip"`
+	Raw     ScanBinary    `resp:"raw"`
+	Skip    string        `resp:"-"`
+}
+
+type ScanBinary struct{ Data string }
+
+func (b *ScanBinary) UnmarshalBinary(data []byte) error {
+	if len(data) == 0 {
+		return fmt.Errorf("empty data")
+	}
+	b.Data = string(data)
+	return nil
+}
+
+type AppendTags []string
+
+func (t AppendTags) String() string { return fmt.Sprint(len(t), " tags") }
+
+type AppendMeta struct {
+	Version int `resp:"version"`
+}
+
+type AppendUser struct {
+	AppendMeta
+	Name    string        `resp:"name"`
+	Email   string        `resp:"email,omitempty"`
+	Admin   bool          `resp:"admin"`
+	Created time.Time     `resp:"created,omitempty"`
+	TTL     time.Duration `resp:"ttl"`
+	PTTL    time.Duration `resp:"pttl,ms,omitempty"`
+	Addr    *ScanAddress  `resp:"addr"`
+	IP      net.IP        `resp:"ip,omitempty"`
+	Tags    AppendTags    `resp:"tags,string,omitempty"`
+	Skip    string        `resp:"-"`
+	private string
+}
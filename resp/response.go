@@ -5,7 +5,8 @@ import (
 )
 
 // CustomResponse values implement custom serialization and can be passed
-// to ResponseWriter.Append.
+// to ResponseWriter.Append. Implementations for structs and other reply
+// types can be generated with cmd/redeo-gen-append.
 type CustomResponse interface {
 	// AppendTo must be implemented by custom response types
 	AppendTo(w ResponseWriter)
@@ -16,7 +17,8 @@ type CustomResponse interface {
 type ResponseWriter interface {
 	io.Writer
 
-	// AppendArrayLen appends an array header to the output buffer.
+	// AppendArrayLen appends an array header to the output buffer. Please
+	// see NewArrayWriter for arrays of unknown length.
 	AppendArrayLen(n int)
 	// AppendBulk appends bulk bytes to the output buffer.
 	AppendBulk(p []byte)
@@ -47,7 +49,16 @@ type ResponseWriter interface {
 	//   * int, int8, int16, int32, int64
 	//   * uint, uint8, uint16, uint32, uint64
 	//   * CustomResponse instances
+	//   * time.Time (RFC3339) and time.Duration (seconds)
+	//   * encoding.TextMarshaler instances
 	//   * slices and maps of any of the above
+	//   * structs and pointers to structs
+	// Structs and maps are encoded as RESP3 maps for writers which use
+	// RESP3 (see ProtocolWriter) or as flat arrays of keys and values. Struct fields are
+	// named following the same `resp` tags as Scan. Fields tagged with "omitempty" are omitted
+	// if empty; "ms" encodes durations and times as milliseconds and "string"
+	// encodes fmt.Stringer fields via their String method. Nil pointers are
+	// encoded as nil. Encoders are cached per type.
 	Append(v interface{}) error
 	// CopyBulk copies n bytes from a reader.
 	// This call may flush pending buffer to prevent overflows.
@@ -60,11 +71,55 @@ type ResponseWriter interface {
 	Reset(w io.Writer)
 }
 
+// MapWriter is an optional interface of ResponseWriters which support
+// RESP3 maps. Writers created by this package implement it.
+type MapWriter interface {
+	// AppendMapLen appends a map header for n key/value pairs to the output
+	// buffer. RESP2 writers append an array header of n*2 elements instead.
+	AppendMapLen(n int)
+}
+
+// ProtocolWriter is an optional interface of ResponseWriters which are
+// aware of the protocol version. Writers created by this package implement
+// it.
+type ProtocolWriter interface {
+	// Protocol returns the protocol version of the writer, either 2 or 3.
+	Protocol() int
+	// SetProtocol sets the protocol version. Writers use RESP2 by default.
+	SetProtocol(v int)
+}
+
+// AppendMapLen appends a map header for n key/value pairs to w. Writers
+// which do not implement MapWriter receive an array header of n*2
+// elements instead.
+func AppendMapLen(w ResponseWriter, n int) {
+	if mw, ok := w.(MapWriter); ok {
+		mw.AppendMapLen(n)
+	} else {
+		w.AppendArrayLen(n * 2)
+	}
+}
+
+// Protocol returns the protocol version of w. Writers which do not
+// implement ProtocolWriter use RESP2.
+func Protocol(w ResponseWriter) int {
+	if pw, ok := w.(ProtocolWriter); ok {
+		return pw.Protocol()
+	}
+	return 2
+}
+
 // NewResponseWriter wraps any writer interface, but
 // normally a net.Conn.
 func NewResponseWriter(wr io.Writer) ResponseWriter {
+	return NewResponseWriterSize(wr, MaxBufferSize)
+}
+
+// NewResponseWriterSize wraps any writer interface, using a buffer
+// of the given initial size.
+func NewResponseWriterSize(wr io.Writer, size int) ResponseWriter {
 	w := new(bufioW)
-	w.reset(mkStdBuffer(), wr)
+	w.reset(mkBuffer(size), wr)
 	return w
 }
 
@@ -92,9 +147,26 @@ type ResponseParser interface {
 	// ReadInlineString reads a status string
 	ReadInlineString() (string, error)
 	// Scan scans results into the given values.
+	//
+	// Flat field/value arrays and RESP3 maps can be scanned into structs
+	// and maps, RESP3 maps into slices as flat key/value pairs. Fields are
+	// matched by their `resp:"name"` tags (or names), case-insensitively as
+	// a fallback; the "-" tag skips a field. Nested arrays are scanned into
+	// nested structs. Struct fields of type time.Time accept unix
+	// timestamps and RFC3339 strings, time.Duration fields accept seconds
+	// and duration strings; add the "ms" tag option for integers in
+	// milliseconds. Fields implementing encoding.TextUnmarshaler or
+	// encoding.BinaryUnmarshaler are decoded from their string values.
 	Scan(vv ...interface{}) error
 }
 
+// MapReader is an optional interface of ResponseParsers which support
+// RESP3 maps. Readers created by this package implement it.
+type MapReader interface {
+	// ReadMapLen reads the number of key/value pairs of a RESP3 map
+	ReadMapLen() (int, error)
+}
+
 // ResponseReader is used by clients to wrap a server connection and
 // parse responses.
 type ResponseReader interface {
@@ -109,7 +181,13 @@ type ResponseReader interface {
 // NewResponseReader returns ResponseReader, which wraps any reader interface, but
 // normally a net.Conn.
 func NewResponseReader(rd io.Reader) ResponseReader {
+	return NewResponseReaderSize(rd, MaxBufferSize)
+}
+
+// NewResponseReaderSize returns ResponseReader, using a buffer of (at least)
+// the given size. Buffers grow as needed to accommodate large responses.
+func NewResponseReaderSize(rd io.Reader, size int) ResponseReader {
 	r := new(bufioR)
-	r.reset(mkStdBuffer(), rd)
+	r.reset(mkBuffer(size), rd)
 	return r
 }
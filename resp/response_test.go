@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"net"
 	"reflect"
 	"strconv"
 	"strings"
@@ -125,10 +126,89 @@ var _ = Describe("ResponseWriter", func() {
 		Entry("map[int64]float64", map[int64]float64{1: 1.1}, "*2\r\n:1\r\n+1.1\r\n"),
 		Entry("custom response", &customResponse{Host: "foo", Port: 8888}, "$17\r\ncustom 'foo:8888'\r\n"),
 		Entry("custom error", customErrorResponse("bar"), "-WRONG bar\r\n"),
+		Entry("time", time.Date(2020, 5, 1, 12, 30, 0, 0, time.UTC), "$20\r\n2020-05-01T12:30:00Z\r\n"),
+		Entry("text marshaler", net.IPv4(10, 0, 0, 1), "$8\r\n10.0.0.1\r\n"),
+		Entry("nil pointer", (*ScanAddress)(nil), "$-1\r\n"),
+		Entry("struct", ScanAddress{City: "Berlin", Zip: 10115}, "*4\r\n$4\r\ncity\r\n$6\r\nBerlin\r\n$3\r\nzip\r\n:10115\r\n"),
+		Entry("struct pointer", &ScanAddress{City: "Rome"}, "*4\r\n$4\r\ncity\r\n$4\r\nRome\r\n$3\r\nzip\r\n:0\r\n"),
+		Entry("struct (omitempty)", AppendUser{Name: "joe"},
+			"*10\r\n$7\r\nversion\r\n:0\r\n$4\r\nname\r\n$3\r\njoe\r\n$5\r\nadmin\r\n:0\r\n$3\r\nttl\r\n:0\r\n$4\r\naddr\r\n$-1\r\n"),
+		Entry("struct (all fields)", AppendUser{
+			AppendMeta: AppendMeta{Version: 2},
+			Name:       "joe",
+			Email:      "joe@example.com",
+			Admin:      true,
+			Created:    time.Date(2020, 5, 1, 12, 30, 0, 0, time.UTC),
+			TTL:        time.Minute,
+			PTTL:       1500 * time.Millisecond,
+			Addr:       &ScanAddress{City: "Rome", Zip: 100},
+			IP:         net.IPv4(10, 0, 0, 1),
+			Tags:       AppendTags{"a", "b"},
+			Skip:       "x",
+			private:    "y",
+		}, "*20\r\n"+
+			"$7\r\nversion\r\n:2\r\n"+
+			"$4\r\nname\r\n$3\r\njoe\r\n"+
+			"$5\r\nemail\r\n$15\r\njoe@example.com\r\n"+
+			"$5\r\nadmin\r\n:1\r\n"+
+			"$7\r\ncreated\r\n$20\r\n2020-05-01T12:30:00Z\r\n"+
+			"$3\r\nttl\r\n:60\r\n"+
+			"$4\r\npttl\r\n:1500\r\n"+
+			"$4\r\naddr\r\n*4\r\n$4\r\ncity\r\n$4\r\nRome\r\n$3\r\nzip\r\n:100\r\n"+
+			"$2\r\nip\r\n$8\r\n10.0.0.1\r\n"+
+			"$4\r\ntags\r\n$6\r\n2 tags\r\n"),
+		Entry("slice of structs", []ScanAddress{{City: "a"}}, "*1\r\n*4\r\n$4\r\ncity\r\n$1\r\na\r\n$3\r\nzip\r\n:0\r\n"),
 	)
 
+	It("should encode structs and maps as RESP3 maps", func() {
+		Expect(resp.Protocol(subject)).To(Equal(2))
+		subject.(resp.ProtocolWriter).SetProtocol(3)
+		Expect(resp.Protocol(subject)).To(Equal(3))
+
+		Expect(subject.Append(ScanAddress{City: "Rome"})).To(Succeed())
+		Expect(subject.Append(map[string]int{"a": 1})).To(Succeed())
+		Expect(subject.Append([]ScanAddress{{City: "a"}})).To(Succeed())
+		Expect(subject.Flush()).To(Succeed())
+		Expect(strconv.Quote(buf.String())).To(Equal(strconv.Quote("" +
+			"%2\r\n$4\r\ncity\r\n$4\r\nRome\r\n$3\r\nzip\r\n:0\r\n" +
+			"%1\r\n$1\r\na\r\n:1\r\n" +
+			"*1\r\n%2\r\n$4\r\ncity\r\n$1\r\na\r\n$3\r\nzip\r\n:0\r\n")))
+
+		var addr ScanAddress
+		r := resp.NewResponseReader(bytes.NewReader(buf.Bytes()))
+		Expect(r.Scan(&addr)).To(Succeed())
+		Expect(addr).To(Equal(ScanAddress{City: "Rome"}))
+	})
+
 	It("should reject bad custom types", func() {
-		Expect(subject.Append(time.Time{})).To(MatchError(`resp: unsupported type time.Time`))
+		Expect(subject.Append(make(chan int))).To(MatchError(`resp: unsupported type chan int`))
+		Expect(subject.Append(struct {
+			C chan int `resp:"c"`
+		}{})).To(MatchError(`resp: unsupported type chan int`))
+	})
+
+	It("should account pooled buffers", func() {
+		pool := resp.NewBufferPool(16)
+		w := resp.NewPooledResponseWriter(buf, pool)
+		Expect(pool.InUse()).To(BeZero())
+
+		w.AppendOK()
+		Expect(pool.InUse()).To(Equal(int64(16)))
+		w.AppendBulkString(strings.Repeat("x", 20))
+		Expect(pool.InUse()).To(BeNumerically(">=", 32))
+
+		Expect(w.Flush()).To(Succeed())
+		Expect(pool.InUse()).To(BeZero())
+		Expect(buf.String()).To(Equal("+OK\r\n$20\r\n" + strings.Repeat("x", 20) + "\r\n"))
+	})
+
+	It("should support custom buffer sizes", func() {
+		w := resp.NewResponseWriterSize(buf, 16)
+		w.AppendBulkString(strings.Repeat("x", 20))
+		Expect(w.CopyBulk(strings.NewReader(strings.Repeat("y", 40)), 40)).To(Succeed())
+		Expect(buf.Len()).To(Equal(27 + 5 + 40))
+		Expect(w.Flush()).To(Succeed())
+		Expect(buf.String()).To(Equal("$20\r\n" + strings.Repeat("x", 20) + "\r\n$40\r\n" + strings.Repeat("y", 40) + "\r\n"))
 	})
 
 })
@@ -252,6 +332,26 @@ var _ = Describe("ResponseReader", func() {
 		Expect(t).To(Equal(resp.TypeInline))
 	})
 
+	It("should read maps", func() {
+		buf.WriteString("%1\r\n$5\r\nHeLLo\r\n:1\r\n+OK\r\n")
+
+		t, err := subject.PeekType()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(t).To(Equal(resp.TypeMap))
+
+		n, err := subject.(resp.MapReader).ReadMapLen()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n).To(Equal(1))
+
+		Expect(subject.ReadBulkString()).To(Equal("HeLLo"))
+		Expect(subject.ReadInt()).To(Equal(int64(1)))
+
+		// ensure we have consumed everything
+		t, err = subject.PeekType()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(t).To(Equal(resp.TypeInline))
+	})
+
 	It("should read errors", func() {
 		buf.WriteString("-WRONGTYPE expected hash\r\n+OK\r\n")
 
@@ -286,6 +386,29 @@ var _ = Describe("ResponseReader", func() {
 		Expect(t).To(Equal(resp.TypeInline))
 	})
 
+	It("should account pooled buffers", func() {
+		pool := resp.NewBufferPool(16)
+		w := resp.NewPooledResponseWriter(buf, pool)
+		Expect(pool.InUse()).To(BeZero())
+
+		w.AppendOK()
+		Expect(pool.InUse()).To(Equal(int64(16)))
+		w.AppendBulkString(strings.Repeat("x", 20))
+		Expect(pool.InUse()).To(BeNumerically(">=", 32))
+
+		Expect(w.Flush()).To(Succeed())
+		Expect(pool.InUse()).To(BeZero())
+		Expect(buf.String()).To(Equal("+OK\r\n$20\r\n" + strings.Repeat("x", 20) + "\r\n"))
+	})
+
+	It("should support custom buffer sizes", func() {
+		buf.WriteString("+" + strings.Repeat("x", 40) + "\r\n$30\r\n" + strings.Repeat("y", 30) + "\r\n:1\r\n")
+		subject = resp.NewResponseReaderSize(buf, 8)
+		Expect(subject.ReadInlineString()).To(Equal(strings.Repeat("x", 40)))
+		Expect(subject.ReadBulkString()).To(Equal(strings.Repeat("y", 30)))
+		Expect(subject.ReadInt()).To(Equal(int64(1)))
+	})
+
 	It("should read statuses across buffer overflows", func() {
 		s := strings.Repeat("x", 4000)
 		buf.WriteString("+")
@@ -379,6 +502,11 @@ var _ = Describe("ResponseReader", func() {
 				"foo": {"bar": 1},
 				"baz": {"boo": 2},
 			}),
+			Entry("maps (RESP3)", "%2\r\n+foo\r\n%1\r\n+bar\r\n:1\r\n+baz\r\n*2\r\n+boo\r\n:2\r\n", new(map[string]map[string]int), map[string]map[string]int{
+				"foo": {"bar": 1},
+				"baz": {"boo": 2},
+			}),
+			Entry("slices (from RESP3 maps)", "%1\r\n+foo\r\n:1\r\n", new([]string), []string{"foo", "1"}),
 			Entry("slice of maps", "*2\r\n*2\r\n+bar\r\n:1\r\n*2\r\n+boo\r\n:2\r\n", new([]map[string]int), []map[string]int{
 				{"bar": 1},
 				{"boo": 2},
@@ -394,6 +522,56 @@ var _ = Describe("ResponseReader", func() {
 					{Name: "llen", Arity: 2, Flags: []string{"readonly", "fast"}, FirstKey: 1, LastKey: 1, KeyStep: 1},
 					{Name: "mset", Arity: -3, Flags: []string{"write"}, FirstKey: 1, LastKey: -1, KeyStep: 2},
 				}),
+
+			Entry("structs", "*24\r\n"+
+				"+name\r\n$5\r\nalice\r\n"+
+				"+age\r\n:33\r\n"+
+				"+tags\r\n*2\r\n+a\r\n+b\r\n"+
+				"+created\r\n:1700000000\r\n"+
+				"+ttl\r\n:60\r\n"+
+				"+pttl\r\n:1500\r\n"+
+				"+addr\r\n*4\r\n+city\r\n+Berlin\r\n+zip\r\n:10115\r\n"+
+				"+home\r\n$-1\r\n"+
+				"+ip\r\n+10.0.0.1\r\n"+
+				"+raw\r\n$3\r\nxyz\r\n"+
+				"+unknown\r\n*1\r\n+ignored\r\n"+
+				"+Skip\r\n+nope\r\n",
+				new(ScanUser), ScanUser{
+					Name:    "alice",
+					Age:     33,
+					Tags:    []string{"a", "b"},
+					Created: time.Unix(1700000000, 0),
+					TTL:     time.Minute,
+					PTTL:    1500 * time.Millisecond,
+					Addr:    ScanAddress{City: "Berlin", Zip: 10115},
+					IP:      net.ParseIP("10.0.0.1"),
+					Raw:     ScanBinary{Data: "xyz"},
+				}),
+			Entry("structs (from strings)", "*8\r\n"+
+				"+CREATED\r\n+2024-01-02T03:04:05Z\r\n"+
+				"+ttl\r\n+1m30s\r\n"+
+				"+home\r\n*2\r\n+city\r\n+Paris\r\n"+
+				"+Age\r\n+21\r\n",
+				new(ScanUser), ScanUser{
+					Created: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+					TTL:     90 * time.Second,
+					Home:    &ScanAddress{City: "Paris"},
+					Age:     21,
+				}),
+			Entry("structs (RESP3)", "%3\r\n"+
+				"+name\r\n$5\r\nalice\r\n"+
+				"+addr\r\n%1\r\n+city\r\n+Berlin\r\n"+
+				"+unknown\r\n%1\r\n+a\r\n+b\r\n",
+				new(ScanUser), ScanUser{
+					Name: "alice",
+					Addr: ScanAddress{City: "Berlin"},
+				}),
+			Entry("slice of structs", "*2\r\n*2\r\n+name\r\n+a\r\n*2\r\n+name\r\n+b\r\n", new([]ScanAddress), []ScanAddress{
+				{}, {},
+			}),
+			Entry("slice of structs (matching)", "*2\r\n*2\r\n+city\r\n+a\r\n*2\r\n+city\r\n+b\r\n", new([]ScanAddress), []ScanAddress{
+				{City: "a"}, {City: "b"},
+			}),
 		)
 
 		DescribeTable("failure",
@@ -423,6 +601,15 @@ var _ = Describe("ResponseReader", func() {
 
 			Entry("slices (bad type)", "+hello\r\n", new([]string), `resp: error on Scan into *[]string: unsupported conversion from "hello"`),
 			Entry("maps (odd number)", "*3\r\n+foo\r\n+bar\r\n+ba\r\n", new(map[string]string), `resp: error on Scan into *map[string]string: unsupported conversion from array[3]`),
+
+			Entry("structs (odd number)", "*3\r\n+foo\r\n+bar\r\n+ba\r\n", new(ScanUser), `resp: error on Scan into *resp_test.ScanUser: unsupported conversion from array[3]`),
+			Entry("structs (bad field)", "*2\r\n+age\r\n+abc\r\n", new(ScanUser), `resp: error on Scan into *resp_test.ScanUser: field "age": unsupported conversion from "abc"`),
+			Entry("structs (bad nested field)", "*2\r\n+addr\r\n*2\r\n+zip\r\n+x\r\n", new(ScanUser), `resp: error on Scan into *resp_test.ScanUser: field "addr.zip": unsupported conversion from "x"`),
+			Entry("structs (bad time)", "*2\r\n+created\r\n+yesterday\r\n", new(ScanUser), `resp: error on Scan into *resp_test.ScanUser: field "created": unsupported conversion from "yesterday"`),
+			Entry("structs (bad duration)", "*2\r\n+ttl\r\n*0\r\n", new(ScanUser), `resp: error on Scan into *resp_test.ScanUser: field "ttl": unsupported conversion from array[0]`),
+			Entry("structs (map as time)", "%1\r\n+created\r\n%1\r\n+a\r\n+b\r\n", new(ScanUser), `resp: error on Scan into *resp_test.ScanUser: field "created": unsupported conversion from map[1]`),
+			Entry("structs (unmarshaler)", "*2\r\n+raw\r\n+\r\n", new(ScanUser), `resp: error on Scan into *resp_test.ScanUser: field "raw": empty data`),
+			Entry("time (from array)", "*2\r\n+foo\r\n+bar\r\n", new(time.Time), `resp: error on Scan into *time.Time: unsupported conversion from array[2]`),
 		)
 
 		DescribeTable("nil",
@@ -437,6 +624,17 @@ var _ = Describe("ResponseReader", func() {
 			Entry("nil (from array)", "*1\r\n+foo\r\n", nil),
 		)
 
+		It("should consume structs on failures", func() {
+			_, err := buf.WriteString("*6\r\n+age\r\n+abc\r\n+name\r\n+bob\r\n+tags\r\n*1\r\n+x\r\n+next\r\n")
+			Expect(err).NotTo(HaveOccurred())
+
+			var u ScanUser
+			Expect(subject.Scan(&u)).To(MatchError(`resp: error on Scan into *resp_test.ScanUser: field "age": unsupported conversion from "abc"`))
+			Expect(u.Name).To(Equal("bob"))
+			Expect(u.Tags).To(Equal([]string{"x"}))
+			Expect(subject.ReadInlineString()).To(Equal("next"))
+		})
+
 	})
 
 })
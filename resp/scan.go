@@ -1,10 +1,13 @@
 package resp
 
 import (
+	"encoding"
 	"fmt"
 	"reflect"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
 const (
@@ -47,6 +50,12 @@ func (b *bufioR) scan(dst interface{}) error {
 			return err
 		}
 		return b.scanArray(dst, sz)
+	case TypeMap:
+		sz, err := b.ReadMapLen()
+		if err != nil {
+			return err
+		}
+		return b.scanArray(dst, 2*sz)
 	case TypeNil:
 		if err := b.ReadNil(); err != nil {
 			return err
@@ -122,6 +131,11 @@ func (b *bufioR) scanArray(dst interface{}, sz int) error {
 			}
 		}
 		return err
+	case reflect.Struct:
+		if isScalarStruct(dv.Type()) {
+			break
+		}
+		return b.scanStruct(dpv, dv, sz)
 	case reflect.Map:
 		if sz%2 != 0 {
 			break
@@ -149,9 +163,22 @@ func (b *bufioR) scanArray(dst interface{}, sz int) error {
 	return scanErrf(dst, "unsupported conversion from array[%d]", sz)
 }
 
+// scanError is returned when values cannot be converted.
+type scanError struct {
+	dst   string // destination type
+	field string // optional struct field path
+	msg   string
+}
+
+func (e *scanError) Error() string {
+	if e.field != "" {
+		return "resp: error on Scan into " + e.dst + ": field " + strconv.Quote(e.field) + ": " + e.msg
+	}
+	return "resp: error on Scan into " + e.dst + ": " + e.msg
+}
+
 func scanErrf(dst interface{}, format string, vv ...interface{}) error {
-	vv = append([]interface{}{dst}, vv...)
-	return fmt.Errorf("resp: error on Scan into %T: "+format, vv...)
+	return &scanError{dst: fmt.Sprintf("%T", dst), msg: fmt.Sprintf(format, vv...)}
 }
 
 func scanNil(dst interface{}) error {
@@ -434,3 +461,319 @@ func assignBytes(v *[]byte, src []byte) error {
 	*v = src
 	return nil
 }
+
+// --------------------------------------------------------------------
+
+var (
+	timeType            = reflect.TypeOf(time.Time{})
+	durationType        = reflect.TypeOf(time.Duration(0))
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	binUnmarshalerType  = reflect.TypeOf((*encoding.BinaryUnmarshaler)(nil)).Elem()
+	scannableType       = reflect.TypeOf((*Scannable)(nil)).Elem()
+)
+
+// isScalarStruct returns true for struct types which
+// are decoded from scalar values, such as time.Time.
+func isScalarStruct(t reflect.Type) bool {
+	pt := reflect.PtrTo(t)
+	return t == timeType || pt.Implements(textUnmarshalerType) || pt.Implements(binUnmarshalerType)
+}
+
+type structField struct {
+	name      string
+	index     []int
+	ms        bool // integers represent milliseconds
+	omitEmpty bool // omit empty values when encoding
+	str       bool // encode fmt.Stringer values as strings
+}
+
+type structSpec struct {
+	fields []structField
+	byName map[string]*structField
+}
+
+func (s *structSpec) lookup(name string) *structField {
+	if f, ok := s.byName[name]; ok {
+		return f
+	}
+	for i := range s.fields {
+		if strings.EqualFold(s.fields[i].name, name) {
+			return &s.fields[i]
+		}
+	}
+	return nil
+}
+
+var structSpecs sync.Map
+
+func cachedStructSpec(t reflect.Type) *structSpec {
+	if v, ok := structSpecs.Load(t); ok {
+		return v.(*structSpec)
+	}
+
+	spec := &structSpec{byName: make(map[string]*structField)}
+	spec.fields = appendStructFields(spec.fields, t, nil)
+	for i := range spec.fields {
+		f := &spec.fields[i]
+		if _, ok := spec.byName[f.name]; !ok {
+			spec.byName[f.name] = f
+		}
+	}
+
+	v, _ := structSpecs.LoadOrStore(t, spec)
+	return v.(*structSpec)
+}
+
+// appendStructFields collects fields according to their `resp` tags.
+// Untagged embedded structs are flattened.
+func appendStructFields(fields []structField, t reflect.Type, index []int) []structField {
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag, hasTag := sf.Tag.Lookup("resp")
+		if tag == "-" {
+			continue
+		}
+
+		idx := make([]int, len(index)+1)
+		copy(idx, index)
+		idx[len(index)] = i
+
+		if sf.Anonymous && !hasTag && sf.Type.Kind() == reflect.Struct {
+			fields = appendStructFields(fields, sf.Type, idx)
+			continue
+		}
+		if sf.PkgPath != "" {
+			continue
+		}
+
+		parts := strings.Split(tag, ",")
+		field := structField{name: parts[0], index: idx}
+		if field.name == "" {
+			field.name = sf.Name
+		}
+		for _, opt := range parts[1:] {
+			switch opt {
+			case "ms":
+				field.ms = true
+			case "omitempty":
+				field.omitEmpty = true
+			case "string":
+				field.str = true
+			}
+		}
+		fields = append(fields, field)
+	}
+	return fields
+}
+
+// scanStruct scans a flat field/value array into a struct. RESP3 maps are
+// passed as arrays of 2n elements.
+func (b *bufioR) scanStruct(dpv, dv reflect.Value, sz int) error {
+	if sz%2 != 0 {
+		for i := 0; i < sz; i++ {
+			if err := b.scan(nil); err != nil {
+				return err
+			}
+		}
+		return scanErrf(dpv.Interface(), "unsupported conversion from array[%d]", sz)
+	}
+
+	spec := cachedStructSpec(dv.Type())
+
+	var err error
+	for i := 0; i < sz; i += 2 {
+		var name string
+		if e := b.scan(&name); e != nil {
+			if err == nil {
+				err = e
+			}
+			if e = b.scan(nil); e != nil {
+				return e
+			}
+			continue
+		}
+
+		field := spec.lookup(name)
+		if field == nil {
+			if e := b.scan(nil); e != nil {
+				return e
+			}
+			continue
+		}
+
+		if e := b.scanField(fieldByIndex(dv, field.index), field); e != nil && err == nil {
+			if se, ok := e.(*scanError); ok {
+				path := field.name
+				if se.field != "" {
+					path += "." + se.field
+				}
+				e = &scanError{dst: dv.Addr().Type().String(), field: path, msg: se.msg}
+			}
+			err = e
+		}
+	}
+	return err
+}
+
+// fieldByIndex returns the nested field, allocating embedded pointers.
+func fieldByIndex(v reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v
+}
+
+func (b *bufioR) scanField(fv reflect.Value, field *structField) error {
+	pt, err := b.PeekType()
+	if err != nil {
+		return err
+	}
+
+	if fv.Kind() == reflect.Ptr {
+		if pt == TypeNil {
+			fv.Set(reflect.Zero(fv.Type()))
+			return b.ReadNil()
+		}
+		if fv.IsNil() {
+			fv.Set(reflect.New(fv.Type().Elem()))
+		}
+		fv = fv.Elem()
+	}
+
+	ptr := fv.Addr()
+	if ptr.Type().Implements(scannableType) {
+		return b.scan(ptr.Interface())
+	}
+
+	switch {
+	case fv.Type() == timeType:
+		return b.scanTime(ptr.Interface().(*time.Time), field.ms)
+	case fv.Type() == durationType:
+		return b.scanDuration(ptr.Interface().(*time.Duration), field.ms)
+	case ptr.Type().Implements(textUnmarshalerType):
+		src, ok, err := b.readScalar(ptr.Interface())
+		if err != nil || !ok {
+			return err
+		}
+		if err := ptr.Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(src)); err != nil {
+			return scanErrf(ptr.Interface(), "%v", err)
+		}
+		return nil
+	case ptr.Type().Implements(binUnmarshalerType):
+		src, ok, err := b.readScalar(ptr.Interface())
+		if err != nil || !ok {
+			return err
+		}
+		if err := ptr.Interface().(encoding.BinaryUnmarshaler).UnmarshalBinary([]byte(src)); err != nil {
+			return scanErrf(ptr.Interface(), "%v", err)
+		}
+		return nil
+	}
+	return b.scan(ptr.Interface())
+}
+
+// readScalar reads a scalar response as a string. It returns false for nil
+// responses and fails on arrays.
+func (b *bufioR) readScalar(dst interface{}) (string, bool, error) {
+	pt, err := b.PeekType()
+	if err != nil {
+		return "", false, err
+	}
+
+	switch pt {
+	case TypeInt:
+		n, err := b.ReadInt()
+		return strconv.FormatInt(n, 10), err == nil, err
+	case TypeInline:
+		s, err := b.ReadInlineString()
+		return s, err == nil, err
+	case TypeBulk:
+		s, err := b.ReadBulkString()
+		return s, err == nil, err
+	case TypeNil:
+		return "", false, b.ReadNil()
+	case TypeError:
+		return "", false, b.scan(dst)
+	case TypeArray:
+		sz, err := b.ReadArrayLen()
+		if err != nil {
+			return "", false, err
+		}
+		for i := 0; i < sz; i++ {
+			if err := b.scan(nil); err != nil {
+				return "", false, err
+			}
+		}
+		return "", false, scanErrf(dst, "unsupported conversion from array[%d]", sz)
+	case TypeMap:
+		sz, err := b.ReadMapLen()
+		if err != nil {
+			return "", false, err
+		}
+		for i := 0; i < 2*sz; i++ {
+			if err := b.scan(nil); err != nil {
+				return "", false, err
+			}
+		}
+		return "", false, scanErrf(dst, "unsupported conversion from map[%d]", sz)
+	}
+	return "", false, errBadResponseType
+}
+
+// scanTime scans unix timestamps (in seconds or milliseconds) and
+// RFC3339 formatted strings.
+func (b *bufioR) scanTime(dst *time.Time, ms bool) error {
+	src, ok, err := b.readScalar(dst)
+	if err != nil {
+		return err
+	} else if !ok {
+		*dst = time.Time{}
+		return nil
+	}
+
+	if n, err := strconv.ParseInt(src, 10, 64); err == nil {
+		if ms {
+			*dst = time.Unix(n/1000, n%1000*int64(time.Millisecond))
+		} else {
+			*dst = time.Unix(n, 0)
+		}
+		return nil
+	}
+	if t, err := time.Parse(time.RFC3339Nano, src); err == nil {
+		*dst = t
+		return nil
+	}
+	return scanErrf(dst, "unsupported conversion from %q", src)
+}
+
+// scanDuration scans integers (as seconds or milliseconds) and
+// duration strings, such as "1m30s".
+func (b *bufioR) scanDuration(dst *time.Duration, ms bool) error {
+	src, ok, err := b.readScalar(dst)
+	if err != nil {
+		return err
+	} else if !ok {
+		*dst = 0
+		return nil
+	}
+
+	if n, err := strconv.ParseInt(src, 10, 64); err == nil {
+		if ms {
+			*dst = time.Duration(n) * time.Millisecond
+		} else {
+			*dst = time.Duration(n) * time.Second
+		}
+		return nil
+	}
+	if d, err := time.ParseDuration(src); err == nil {
+		*dst = d
+		return nil
+	}
+	return scanErrf(dst, "unsupported conversion from %q", src)
+}
@@ -1,10 +1,13 @@
 package resp
 
 import (
+	"encoding"
 	"fmt"
 	"reflect"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
 // Append implements ResponseWriter
@@ -53,35 +56,387 @@ func (w *bufioW) Append(v interface{}) error {
 	case CommandArgument:
 		w.AppendBulk(v)
 	case float32:
-		w.AppendInlineString(strconv.FormatFloat(float64(v), 'f', -1, 32))
+		w.appendFloat(float64(v), 32)
 	case float64:
-		w.AppendInlineString(strconv.FormatFloat(v, 'f', -1, 64))
+		w.appendFloat(v, 64)
 	default:
-		switch reflect.TypeOf(v).Kind() {
-		case reflect.Slice:
-			s := reflect.ValueOf(v)
-
-			w.AppendArrayLen(s.Len())
-			for i := 0; i < s.Len(); i++ {
-				if err := w.Append(s.Index(i).Interface()); err != nil {
-					return err
-				}
+		return cachedEncoder(reflect.TypeOf(v))(w, reflect.ValueOf(v))
+	}
+	return nil
+}
+
+// AppendFloat appends a float as an inline string, in the same format as
+// Append. It is used by generated code and does not allocate, unless w is
+// a custom ResponseWriter implementation.
+func AppendFloat(w ResponseWriter, f float64, bitSize int) {
+	if b, ok := w.(*bufioW); ok {
+		b.appendFloat(f, bitSize)
+		return
+	}
+	w.AppendInlineString(strconv.FormatFloat(f, 'f', -1, bitSize))
+}
+
+// AppendTime appends a time as an RFC3339 bulk string, in the same format
+// as Append. It is used by generated code and does not allocate, unless w
+// is a custom ResponseWriter implementation.
+func AppendTime(w ResponseWriter, t time.Time) {
+	if b, ok := w.(*bufioW); ok {
+		b.appendTime(t)
+		return
+	}
+	w.AppendBulkString(t.Format(time.RFC3339Nano))
+}
+
+func (w *bufioW) appendFloat(f float64, bitSize int) {
+	var buf [32]byte
+	w.AppendInline(strconv.AppendFloat(buf[:0], f, 'f', -1, bitSize))
+}
+
+func (w *bufioW) appendTime(t time.Time) {
+	var buf [64]byte
+	w.AppendBulk(t.AppendFormat(buf[:0], time.RFC3339Nano))
+}
+
+// --------------------------------------------------------------------
+
+// encoderFunc appends a reflected value.
+type encoderFunc func(w *bufioW, v reflect.Value) error
+
+var (
+	customResponseType = reflect.TypeOf((*CustomResponse)(nil)).Elem()
+	errorType          = reflect.TypeOf((*error)(nil)).Elem()
+	textMarshalerType  = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	stringerType       = reflect.TypeOf((*fmt.Stringer)(nil)).Elem()
+)
+
+var encoders sync.Map // map[reflect.Type]encoderFunc
+
+// cachedEncoder returns the encoder for a type. Encoders are built once per
+// type, recursive types are supported.
+func cachedEncoder(t reflect.Type) encoderFunc {
+	if f, ok := encoders.Load(t); ok {
+		return f.(encoderFunc)
+	}
+
+	// install a placeholder to support recursive types
+	var (
+		wg sync.WaitGroup
+		fn encoderFunc
+	)
+	wg.Add(1)
+	f, loaded := encoders.LoadOrStore(t, encoderFunc(func(w *bufioW, v reflect.Value) error {
+		wg.Wait()
+		return fn(w, v)
+	}))
+	if loaded {
+		return f.(encoderFunc)
+	}
+
+	fn = newEncoder(t)
+	wg.Done()
+	encoders.Store(t, fn)
+	return fn
+}
+
+func newEncoder(t reflect.Type) encoderFunc {
+	switch {
+	case t.Implements(customResponseType):
+		return encodeCustom
+	case t.Kind() != reflect.Ptr && reflect.PtrTo(t).Implements(customResponseType):
+		return addrEncoder(encodeCustom)
+	case t.Kind() != reflect.Interface && t.Implements(errorType):
+		return encodeError
+	case t == timeType:
+		return encodeTime
+	case t == durationType:
+		return encodeDuration
+	case t.Implements(textMarshalerType):
+		return encodeText
+	case t.Kind() != reflect.Ptr && reflect.PtrTo(t).Implements(textMarshalerType):
+		return addrEncoder(encodeText)
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return encodeBool
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return encodeInt
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return encodeUint
+	case reflect.Float32, reflect.Float64:
+		return encodeFloat
+	case reflect.String:
+		return encodeString
+	case reflect.Interface:
+		return encodeInterface
+	case reflect.Ptr:
+		return newPtrEncoder(t)
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return encodeBytes
+		}
+		return newSliceEncoder(t)
+	case reflect.Array:
+		return newSliceEncoder(t)
+	case reflect.Map:
+		return newMapEncoder(t)
+	case reflect.Struct:
+		return newStructEncoder(t)
+	}
+	return func(_ *bufioW, _ reflect.Value) error {
+		return fmt.Errorf("resp: unsupported type %s", t)
+	}
+}
+
+func encodeCustom(w *bufioW, v reflect.Value) error {
+	if v.Kind() == reflect.Ptr && v.IsNil() {
+		w.AppendNil()
+		return nil
+	}
+	v.Interface().(CustomResponse).AppendTo(w)
+	return nil
+}
+
+func encodeError(w *bufioW, v reflect.Value) error {
+	if v.Kind() == reflect.Ptr && v.IsNil() {
+		w.AppendNil()
+		return nil
+	}
+	return w.Append(v.Interface().(error))
+}
+
+func encodeText(w *bufioW, v reflect.Value) error {
+	if v.Kind() == reflect.Ptr && v.IsNil() {
+		w.AppendNil()
+		return nil
+	}
+
+	b, err := v.Interface().(encoding.TextMarshaler).MarshalText()
+	if err != nil {
+		return err
+	}
+	w.AppendBulk(b)
+	return nil
+}
+
+// addrEncoder wraps encoders of methods with pointer receivers.
+func addrEncoder(fn encoderFunc) encoderFunc {
+	return func(w *bufioW, v reflect.Value) error {
+		if !v.CanAddr() {
+			pv := reflect.New(v.Type())
+			pv.Elem().Set(v)
+			v = pv.Elem()
+		}
+		return fn(w, v.Addr())
+	}
+}
+
+func encodeTime(w *bufioW, v reflect.Value) error {
+	w.appendTime(v.Interface().(time.Time))
+	return nil
+}
+
+func encodeDuration(w *bufioW, v reflect.Value) error {
+	w.AppendInt(int64(time.Duration(v.Int()) / time.Second))
+	return nil
+}
+
+func encodeBool(w *bufioW, v reflect.Value) error {
+	if v.Bool() {
+		w.AppendInt(1)
+	} else {
+		w.AppendInt(0)
+	}
+	return nil
+}
+
+func encodeInt(w *bufioW, v reflect.Value) error {
+	w.AppendInt(v.Int())
+	return nil
+}
+
+func encodeUint(w *bufioW, v reflect.Value) error {
+	w.AppendInt(int64(v.Uint()))
+	return nil
+}
+
+func encodeFloat(w *bufioW, v reflect.Value) error {
+	w.appendFloat(v.Float(), v.Type().Bits())
+	return nil
+}
+
+func encodeString(w *bufioW, v reflect.Value) error {
+	w.AppendBulkString(v.String())
+	return nil
+}
+
+func encodeBytes(w *bufioW, v reflect.Value) error {
+	w.AppendBulk(v.Bytes())
+	return nil
+}
+
+func encodeInterface(w *bufioW, v reflect.Value) error {
+	if v.IsNil() {
+		w.AppendNil()
+		return nil
+	}
+	return w.Append(v.Elem().Interface())
+}
+
+func newPtrEncoder(t reflect.Type) encoderFunc {
+	elem := cachedEncoder(t.Elem())
+	return func(w *bufioW, v reflect.Value) error {
+		if v.IsNil() {
+			w.AppendNil()
+			return nil
+		}
+		return elem(w, v.Elem())
+	}
+}
+
+func newSliceEncoder(t reflect.Type) encoderFunc {
+	elem := cachedEncoder(t.Elem())
+	return func(w *bufioW, v reflect.Value) error {
+		n := v.Len()
+		w.AppendArrayLen(n)
+		for i := 0; i < n; i++ {
+			if err := elem(w, v.Index(i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+func newMapEncoder(t reflect.Type) encoderFunc {
+	key, elem := cachedEncoder(t.Key()), cachedEncoder(t.Elem())
+	return func(w *bufioW, v reflect.Value) error {
+		w.AppendMapLen(v.Len())
+
+		iter := v.MapRange()
+		for iter.Next() {
+			if err := key(w, iter.Key()); err != nil {
+				return err
 			}
-		case reflect.Map:
-			s := reflect.ValueOf(v)
-
-			w.AppendArrayLen(s.Len() * 2)
-			for _, key := range s.MapKeys() {
-				if err := w.Append(key.Interface()); err != nil {
-					return err
-				}
-				if err := w.Append(s.MapIndex(key).Interface()); err != nil {
-					return err
-				}
+			if err := elem(w, iter.Value()); err != nil {
+				return err
 			}
+		}
+		return nil
+	}
+}
+
+type fieldEncoder struct {
+	name      string
+	index     []int
+	omitEmpty bool
+	encode    encoderFunc
+}
+
+// newStructEncoder encodes structs as maps or, for RESP2 writers, flat
+// field/value arrays, using the same `resp` tags as Scan.
+func newStructEncoder(t reflect.Type) encoderFunc {
+	spec := cachedStructSpec(t)
+	fields := make([]fieldEncoder, 0, len(spec.fields))
+	for _, f := range spec.fields {
+		ft := t.FieldByIndex(f.index).Type
+
+		var enc encoderFunc
+		switch {
+		case f.str && ft.Implements(stringerType):
+			enc = encodeStringer
+		case f.ms && ft == durationType:
+			enc = encodeDurationMs
+		case f.ms && ft == timeType:
+			enc = encodeTimeMs
 		default:
-			return fmt.Errorf("resp: unsupported type %T", v)
+			enc = cachedEncoder(ft)
+		}
+
+		fields = append(fields, fieldEncoder{
+			name:      f.name,
+			index:     f.index,
+			omitEmpty: f.omitEmpty,
+			encode:    enc,
+		})
+	}
+
+	return func(w *bufioW, v reflect.Value) error {
+		n := 0
+		for i := range fields {
+			if fv, ok := structFieldValue(v, fields[i].index); ok && !(fields[i].omitEmpty && isEmptyValue(fv)) {
+				n++
+			}
 		}
+
+		w.AppendMapLen(n)
+		for i := range fields {
+			f := &fields[i]
+			fv, ok := structFieldValue(v, f.index)
+			if !ok || (f.omitEmpty && isEmptyValue(fv)) {
+				continue
+			}
+
+			w.AppendBulkString(f.name)
+			if err := f.encode(w, fv); err != nil {
+				return err
+			}
+		}
+		return nil
 	}
+}
+
+// structFieldValue returns a (nested) field value. It returns false if an
+// embedded pointer is nil.
+func structFieldValue(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+func encodeStringer(w *bufioW, v reflect.Value) error {
+	if v.Kind() == reflect.Ptr && v.IsNil() {
+		w.AppendNil()
+		return nil
+	}
+	w.AppendBulkString(v.Interface().(fmt.Stringer).String())
 	return nil
 }
+
+func encodeDurationMs(w *bufioW, v reflect.Value) error {
+	w.AppendInt(int64(time.Duration(v.Int()) / time.Millisecond))
+	return nil
+}
+
+func encodeTimeMs(w *bufioW, v reflect.Value) error {
+	t := v.Interface().(time.Time)
+	w.AppendInt(t.UnixNano() / int64(time.Millisecond))
+	return nil
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	case reflect.Struct:
+		return v.IsZero()
+	}
+	return false
+}
@@ -0,0 +1,91 @@
+// Code generated by redeo-gen-append. DO NOT EDIT.
+
+package resp_test
+
+import (
+	"time"
+
+	"github.com/bsm/redeo/v2/resp"
+)
+
+// AppendTo implements resp.CustomResponse.
+func (r *benchUser) AppendTo(w resp.ResponseWriter) {
+	n := 7
+	if len(r.Email) != 0 {
+		n++
+	}
+	if r.Score != 0 {
+		n++
+	}
+	if !r.Created.IsZero() {
+		n++
+	}
+	if len(r.Attrs) != 0 {
+		n++
+	}
+	if len(r.Raw) != 0 {
+		n++
+	}
+	resp.AppendMapLen(w, n)
+	w.AppendBulkString("version")
+	w.AppendInt(int64(r.AppendMeta.Version))
+	w.AppendBulkString("id")
+	w.AppendInt(r.ID)
+	w.AppendBulkString("name")
+	w.AppendBulkString(r.Name)
+	if len(r.Email) != 0 {
+		w.AppendBulkString("email")
+		w.AppendBulkString(r.Email)
+	}
+	w.AppendBulkString("admin")
+	if r.Admin {
+		w.AppendInt(1)
+	} else {
+		w.AppendInt(0)
+	}
+	if r.Score != 0 {
+		w.AppendBulkString("score")
+		resp.AppendFloat(w, r.Score, 64)
+	}
+	if !r.Created.IsZero() {
+		w.AppendBulkString("created")
+		resp.AppendTime(w, r.Created)
+	}
+	w.AppendBulkString("ttl")
+	w.AppendInt(int64(r.TTL / time.Millisecond))
+	w.AppendBulkString("tags")
+	w.AppendArrayLen(len(r.Tags))
+	for i := range r.Tags {
+		w.AppendBulkString(r.Tags[i])
+	}
+	w.AppendBulkString("addr")
+	if r.Addr == nil {
+		w.AppendNil()
+	} else {
+		resp.AppendMapLen(w, 2)
+		w.AppendBulkString("city")
+		w.AppendBulkString(r.Addr.City)
+		w.AppendBulkString("zip")
+		w.AppendInt(int64(r.Addr.Zip))
+	}
+	if len(r.Attrs) != 0 {
+		w.AppendBulkString("attrs")
+		resp.AppendMapLen(w, len(r.Attrs))
+		for k, v := range r.Attrs {
+			w.AppendBulkString(k)
+			w.AppendBulkString(v)
+		}
+	}
+	if len(r.Raw) != 0 {
+		w.AppendBulkString("raw")
+		w.AppendBulk(r.Raw)
+	}
+}
+
+// AppendTo implements resp.CustomResponse.
+func (r benchUsers) AppendTo(w resp.ResponseWriter) {
+	w.AppendArrayLen(len(r))
+	for i := range r {
+		r[i].AppendTo(w)
+	}
+}
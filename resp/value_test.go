@@ -0,0 +1,136 @@
+package resp_test
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	. "github.com/bsm/ginkgo/v2"
+	. "github.com/bsm/gomega"
+	"github.com/bsm/redeo/v2/resp"
+)
+
+//go:generate go run ../cmd/redeo-gen-append -output value_gen_test.go
+
+//redeo:append
+type benchUser struct {
+	AppendMeta
+	ID      int64             `resp:"id"`
+	Name    string            `resp:"name"`
+	Email   string            `resp:"email,omitempty"`
+	Admin   bool              `resp:"admin"`
+	Score   float64           `resp:"score,omitempty"`
+	Created time.Time         `resp:"created,omitempty"`
+	TTL     time.Duration     `resp:"ttl,ms"`
+	Tags    []string          `resp:"tags"`
+	Addr    *ScanAddress      `resp:"addr"`
+	Attrs   map[string]string `resp:"attrs,omitempty"`
+	Raw     []byte            `resp:"raw,omitempty"`
+	Skip    string            `resp:"-"`
+}
+
+//redeo:append
+type benchUsers []benchUser
+
+// reflectUser has the same layout as benchUser, but no AppendTo method.
+type reflectUser benchUser
+
+var _ = Describe("generated encoders", func() {
+	var user *benchUser
+
+	BeforeEach(func() {
+		user = &benchUser{
+			AppendMeta: AppendMeta{Version: 3},
+			ID:         1001,
+			Name:       "joe",
+			Email:      "joe@example.com",
+			Admin:      true,
+			Score:      9.5,
+			Created:    time.Date(2020, 5, 1, 12, 30, 0, 0, time.UTC),
+			TTL:        90 * time.Second,
+			Tags:       []string{"a", "b"},
+			Addr:       &ScanAddress{City: "Rome", Zip: 100},
+			Attrs:      map[string]string{"lang": "it"},
+			Raw:        []byte("raw"),
+			Skip:       "skipped",
+		}
+	})
+
+	It("should match the reflective encoder", func() {
+		Expect(appendString(user)).To(Equal(appendString((*reflectUser)(user))))
+		Expect(appendString(&benchUser{})).To(Equal(appendString(&reflectUser{})))
+		Expect(appendString(benchUsers{*user, {}})).To(Equal(appendString([]reflectUser{reflectUser(*user), {}})))
+	})
+
+	It("should not allocate", func() {
+		w := resp.NewResponseWriter(io.Discard)
+		Expect(testing.AllocsPerRun(100, func() {
+			_ = w.Append(user)
+			_ = w.Flush()
+		})).To(BeZero())
+	})
+})
+
+func appendString(v interface{}) string {
+	buf := new(bytes.Buffer)
+	w := resp.NewResponseWriter(buf)
+	Expect(w.Append(v)).To(Succeed())
+	Expect(w.Flush()).To(Succeed())
+	return buf.String()
+}
+
+// --------------------------------------------------------------------
+
+func BenchmarkResponseWriter_Append(b *testing.B) {
+	user := &benchUser{
+		ID:    1001,
+		Name:  "joe",
+		Email: "joe@example.com",
+		TTL:   time.Minute,
+		Tags:  []string{"a", "b", "c"},
+		Addr:  &ScanAddress{City: "Rome", Zip: 100},
+		Attrs: map[string]string{"lang": "it"},
+	}
+	users := make(benchUsers, 100)
+	reflectUsers := make([]reflectUser, len(users))
+	for i := range users {
+		users[i] = *user
+		reflectUsers[i] = reflectUser(*user)
+	}
+	strs := make([]string, 100)
+	for i := range strs {
+		strs[i] = "value"
+	}
+
+	b.Run("strings", func(b *testing.B) {
+		benchmarkAppend(b, strs)
+	})
+	b.Run("struct/reflect", func(b *testing.B) {
+		benchmarkAppend(b, (*reflectUser)(user))
+	})
+	b.Run("struct/generated", func(b *testing.B) {
+		benchmarkAppend(b, user)
+	})
+	b.Run("slice/reflect", func(b *testing.B) {
+		benchmarkAppend(b, reflectUsers)
+	})
+	b.Run("slice/generated", func(b *testing.B) {
+		benchmarkAppend(b, users)
+	})
+}
+
+func benchmarkAppend(b *testing.B, v interface{}) {
+	w := resp.NewResponseWriter(io.Discard)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := w.Append(v); err != nil {
+			b.Fatal(err)
+		}
+		if err := w.Flush(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -1,7 +1,12 @@
 package redeo
 
 import (
+	"context"
+	"errors"
+	"io"
 	"net"
+	"os"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -9,13 +14,36 @@ import (
 	"github.com/bsm/redeo/v2/resp"
 )
 
+// ErrServerClosed is returned by Serve and ListenAndServe after a call to
+// Shutdown.
+var ErrServerClosed = errors.New("redeo: server closed")
+
 // Server configuration
 type Server struct {
 	config *Config
 	info   *ServerInfo
 
-	cmds map[string]interface{}
-	mu   sync.RWMutex
+	rbufs *resp.BufferPool // client read buffers
+	wbufs *resp.BufferPool // client write buffers
+
+	cmds       map[string]*command
+	categories map[string]*Limiter
+	observer   Observer
+	mu         sync.RWMutex
+
+	rates    rateLimits
+	tracking *tracker
+	repl     *replication
+	aof      *AOF
+
+	// writes serializes write commands, including their recording in the
+	// replication log and the append-only file, snapshots and rewrites
+	writes sync.Mutex
+
+	listeners map[net.Listener]struct{}
+	loop      *eventLoop
+	closed    bool
+	lmu       sync.Mutex
 }
 
 // NewServer creates a new server instance
@@ -24,46 +52,150 @@ func NewServer(config *Config) *Server {
 		config = new(Config)
 	}
 
-	return &Server{
-		config: config,
-		info:   newServerInfo(),
-		cmds:   make(map[string]interface{}),
+	srv := &Server{
+		config:     config,
+		info:       newServerInfo(),
+		rbufs:      resp.NewBufferPool(config.readBufferSize()),
+		wbufs:      resp.NewBufferPool(config.writeBufferSize()),
+		cmds:       make(map[string]*command),
+		categories: make(map[string]*Limiter),
+		listeners:  make(map[net.Listener]struct{}),
 	}
+	srv.tracking = newTracker(srv.info)
+	srv.repl = newReplication(config.replBacklogSize(), config.replPingInterval(), &srv.writes)
+	srv.info.initMemory(srv.rbufs, srv.wbufs)
+	srv.info.initTracking(srv.tracking)
+	srv.info.initReplication(srv.repl)
+	return srv
 }
 
 // Info returns the server info registry
 func (srv *Server) Info() *ServerInfo { return srv.info }
 
-// Handle registers a handler for a command.
-func (srv *Server) Handle(name string, h Handler) {
-	srv.mu.Lock()
-	srv.cmds[strings.ToLower(name)] = h
-	srv.mu.Unlock()
+// Handle registers a handler for a command. An optional command description
+// may be passed, which enables arity validation before the handler is
+// invoked, as well as key extraction via resp.Command.Keys().
+func (srv *Server) Handle(name string, h Handler, desc ...CommandDescription) {
+	srv.register(name, h, desc)
 }
 
 // HandleFunc registers a handler func for a command.
-func (srv *Server) HandleFunc(name string, fn HandlerFunc) {
-	srv.Handle(name, fn)
+func (srv *Server) HandleFunc(name string, fn HandlerFunc, desc ...CommandDescription) {
+	srv.Handle(name, fn, desc...)
 }
 
 // HandleStream registers a handler for a streaming command.
-func (srv *Server) HandleStream(name string, h StreamHandler) {
+func (srv *Server) HandleStream(name string, h StreamHandler, desc ...CommandDescription) {
+	srv.register(name, h, desc)
+}
+
+// HandleStreamFunc registers a handler func for a command
+func (srv *Server) HandleStreamFunc(name string, fn StreamHandlerFunc, desc ...CommandDescription) {
+	srv.HandleStream(name, fn, desc...)
+}
+
+// CommandDescriptions returns descriptions of all registered commands,
+// sorted by name. Commands registered without a description are included
+// by name only. Sub-commands of SubCommands handlers are described
+// automatically, unless explicitly specified.
+func (srv *Server) CommandDescriptions() CommandDescriptions {
+	srv.mu.RLock()
+	defer srv.mu.RUnlock()
+
+	descs := make(CommandDescriptions, 0, len(srv.cmds))
+	for _, cmd := range srv.cmds {
+		desc := cmd.desc
+		describeSubCommands(&desc, cmd.handler)
+		descs = append(descs, desc)
+	}
+	sort.Slice(descs, func(i, j int) bool { return descs[i].Name < descs[j].Name })
+	return descs
+}
+
+func (srv *Server) register(name string, h interface{}, desc []CommandDescription) {
+	norm := strings.ToLower(name)
+	cmd := &command{handler: h, desc: CommandDescription{Name: norm}}
+	if len(desc) != 0 {
+		cmd.desc = desc[0]
+		cmd.desc.Name = norm
+	}
+	cmd.write = cmd.desc.hasFlag("write")
+
 	srv.mu.Lock()
-	srv.cmds[strings.ToLower(name)] = h
+	cmd.limiters = srv.limiters(&cmd.desc)
+	srv.cmds[norm] = cmd
 	srv.mu.Unlock()
+
+	if cmd.desc.Limiter != nil {
+		srv.info.trackLimiter(cmd.desc.Limiter)
+	}
 }
 
-// HandleStreamFunc registers a handler func for a command
-func (srv *Server) HandleStreamFunc(name string, fn StreamHandlerFunc) {
-	srv.HandleStream(name, fn)
+// LimitCategory limits the number of concurrent invocations of all commands
+// with a given flag or ACL category, i.e. "write" or "@slow". The limiter
+// applies to commands registered before and after the call. Pass a nil
+// limiter to remove the limit.
+func (srv *Server) LimitCategory(category string, l *Limiter) {
+	srv.mu.Lock()
+	if l != nil {
+		srv.categories[category] = l
+	} else {
+		delete(srv.categories, category)
+	}
+	for _, cmd := range srv.cmds {
+		cmd.limiters = srv.limiters(&cmd.desc)
+	}
+	srv.mu.Unlock()
+
+	if l != nil {
+		srv.info.trackLimiter(l)
+	}
+}
+
+// limiters resolves the limiters of a command. It must be
+// called while holding the lock.
+func (srv *Server) limiters(desc *CommandDescription) limiters {
+	ll := limiters(nil).add(desc.Limiter)
+	for _, cat := range desc.Flags {
+		ll = ll.add(srv.categories[cat])
+	}
+	for _, cat := range desc.ACLCategories {
+		ll = ll.add(srv.categories[cat])
+	}
+	return ll
+}
+
+// Observe registers an observer which is notified about processed pipelines
+// and commands. It replaces any previously registered observer.
+func (srv *Server) Observe(o Observer) {
+	srv.mu.Lock()
+	srv.observer = o
+	srv.mu.Unlock()
 }
 
 // Serve accepts incoming connections on a listener, creating a
-// new service goroutine for each.
+// new service goroutine for each. If Config.EventLoop is enabled,
+// connections are handed to the event loop instead.
 func (srv *Server) Serve(lis net.Listener) error {
+	if !srv.track(lis) {
+		return ErrServerClosed
+	}
+	defer srv.untrack(lis)
+
+	var loop *eventLoop
+	if srv.config.EventLoop {
+		var err error
+		if loop, err = srv.eventLoop(); err != nil {
+			return err
+		}
+	}
+
 	for {
 		cn, err := lis.Accept()
 		if err != nil {
+			if srv.isClosed() {
+				return ErrServerClosed
+			}
 			return err
 		}
 
@@ -74,54 +206,300 @@ func (srv *Server) Serve(lis net.Listener) error {
 			}
 		}
 
-		go srv.serveClient(newClient(cn))
+		c := newClient(cn, srv.rbufs, srv.wbufs)
+		if loop != nil {
+			loop.add(c)
+		} else {
+			go srv.serveClient(c)
+		}
+	}
+}
+
+// ListenAndServe listens on all given addresses and serves clients on each of
+// them. Addresses may be prefixed with a network scheme, i.e.
+// "tcp://127.0.0.1:6379", "tcp6://[::1]:6379" or "unix:///tmp/redeo.sock".
+// Addresses without a scheme default to "tcp". Permissions of unix sockets are
+// set according to Config.UnixSocketPerm.
+//
+// ListenAndServe blocks until either one of the listeners fails or Shutdown
+// is called. In both cases, all listeners are closed together. At least one
+// address is required.
+func (srv *Server) ListenAndServe(addrs ...string) error {
+	if len(addrs) == 0 {
+		return errors.New("redeo: no addresses to listen on")
+	}
+
+	listeners := make([]net.Listener, 0, len(addrs))
+	closeAll := func() {
+		for _, lis := range listeners {
+			_ = lis.Close()
+		}
+	}
+
+	for _, addr := range addrs {
+		lis, err := srv.listen(addr)
+		if err != nil {
+			closeAll()
+			return err
+		}
+		listeners = append(listeners, lis)
+	}
+
+	errs := make(chan error, len(listeners))
+	for _, lis := range listeners {
+		go func(lis net.Listener) {
+			errs <- srv.Serve(lis)
+		}(lis)
+	}
+
+	err := <-errs
+	closeAll()
+	for i := 1; i < len(listeners); i++ {
+		<-errs
 	}
+	return err
+}
+
+// Addrs returns the addresses of all active listeners.
+func (srv *Server) Addrs() []net.Addr {
+	srv.lmu.Lock()
+	defer srv.lmu.Unlock()
+
+	addrs := make([]net.Addr, 0, len(srv.listeners))
+	for lis := range srv.listeners {
+		addrs = append(addrs, lis.Addr())
+	}
+	return addrs
+}
+
+// Shutdown closes all active listeners. Serve and ListenAndServe
+// will return ErrServerClosed. Connected clients are not affected.
+func (srv *Server) Shutdown() error {
+	srv.lmu.Lock()
+	defer srv.lmu.Unlock()
+
+	srv.closed = true
+
+	var err error
+	for lis := range srv.listeners {
+		if e := lis.Close(); e != nil && err == nil {
+			err = e
+		}
+		delete(srv.listeners, lis)
+	}
+	return err
+}
+
+func (srv *Server) listen(addr string) (net.Listener, error) {
+	network := "tcp"
+	if pos := strings.Index(addr, "://"); pos > -1 {
+		network, addr = addr[:pos], addr[pos+3:]
+	}
+
+	if network != "unix" {
+		return net.Listen(network, addr)
+	}
+
+	// remove stale sockets
+	if fi, err := os.Stat(addr); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		_ = os.Remove(addr)
+	}
+
+	lis, err := net.Listen(network, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if perm := srv.config.UnixSocketPerm; perm != 0 {
+		if err := os.Chmod(addr, perm); err != nil {
+			_ = lis.Close()
+			return nil, err
+		}
+	}
+	return lis, nil
+}
+
+func (srv *Server) track(lis net.Listener) bool {
+	srv.lmu.Lock()
+	defer srv.lmu.Unlock()
+
+	if srv.closed {
+		return false
+	}
+	srv.listeners[lis] = struct{}{}
+	return true
+}
+
+func (srv *Server) untrack(lis net.Listener) {
+	srv.lmu.Lock()
+	delete(srv.listeners, lis)
+	srv.lmu.Unlock()
+}
+
+// eventLoop returns the event loop, starting it on first use.
+func (srv *Server) eventLoop() (*eventLoop, error) {
+	srv.lmu.Lock()
+	defer srv.lmu.Unlock()
+
+	if srv.loop == nil {
+		loop, err := newEventLoop(srv)
+		if err != nil {
+			return nil, err
+		}
+		srv.loop = loop
+	}
+	return srv.loop, nil
+}
+
+func (srv *Server) isClosed() bool {
+	srv.lmu.Lock()
+	closed := srv.closed
+	srv.lmu.Unlock()
+	return closed
 }
 
 // Starts a new session, serving client
 func (srv *Server) serveClient(c *Client) {
-	// Release client on exit
-	defer c.release()
+	srv.initClient(c)
+	defer srv.releaseClient(c)
+
+	for srv.serveOnce(c) {
+	}
+}
 
-	// Register client
+// initClient registers the client and applies request limits.
+func (srv *Server) initClient(c *Client) {
 	srv.info.register(c)
-	defer srv.info.deregister(c.id)
+	c.rd.SetLimits(srv.config.requestLimits())
+}
+
+// releaseClient deregisters and releases the client.
+func (srv *Server) releaseClient(c *Client) {
+	srv.info.deregister(c.id)
+	srv.rates.Forget(c)
+	srv.tracking.disable(c)
+	srv.repl.detach(c)
+	c.release()
+}
+
+// serveOnce performs a single pipeline and flushes the responses. It returns
+// false once the client is closed or must be disconnected.
+func (srv *Server) serveOnce(c *Client) bool {
+	if c.closed {
+		return false
+	}
 
-	// Create perform callback
-	perform := func(name string) error {
-		return srv.perform(c, name)
+	// set deadline
+	if d := srv.config.Timeout; d > 0 {
+		_ = c.cn.SetDeadline(time.Now().Add(d))
 	}
 
-	// Init request/response loop
-	for !c.closed {
-		// set deadline
-		if d := srv.config.Timeout; d > 0 {
-			_ = c.cn.SetDeadline(time.Now().Add(d))
+	// perform pipeline
+	if err := srv.pipeline(c); err != nil {
+		c.wr.AppendError("ERR " + err.Error())
+
+		// the remainder of oversized requests cannot be skipped safely
+		if resp.IsLimitError(err) {
+			srv.info.reject()
+			_ = c.wr.Flush()
+			return false
 		}
 
-		// perform pipeline
-		if err := c.pipeline(perform); err != nil {
-			c.wr.AppendError("ERR " + err.Error())
+		if !resp.IsProtocolError(err) {
+			_ = c.wr.Flush()
+			return false
+		}
+	}
 
-			if !resp.IsProtocolError(err) {
-				_ = c.wr.Flush()
-				return
-			}
+	// flush buffer, return on errors
+	if err := c.wr.Flush(); err != nil {
+		return false
+	}
+	return !c.closed
+}
+
+type command struct {
+	handler  interface{}
+	desc     CommandDescription
+	limiters limiters
+	write    bool // flagged as "write"
+}
+
+// serveWrite serves a write command and records it in the replication
+// log and the append-only file, unless the handler replied with an error.
+// Write commands are performed one at a time, so they are recorded in the
+// order in which they were performed.
+func (srv *Server) serveWrite(w resp.ResponseWriter, h Handler, c *Client, aof *AOF) {
+	srv.writes.Lock()
+	defer srv.writes.Unlock()
+
+	c.wrec.reset(w)
+	h.ServeRedeo(&c.wrec, c.cmd)
+	if c.wrec.msg == "" {
+		srv.repl.record(c.cmd)
+		if aof != nil {
+			_ = aof.Append(c.cmd)
 		}
+	}
+}
 
-		// flush buffer, return on errors
-		if err := c.wr.Flush(); err != nil {
-			return
+// applyCmd applies a logged or replicated command through its handler,
+// discarding the reply. Commands without a Handler are ignored.
+func (srv *Server) applyCmd(w resp.ResponseWriter, cmd *resp.Command) {
+	srv.mu.RLock()
+	c, ok := srv.cmds[strings.ToLower(cmd.Name)]
+	srv.mu.RUnlock()
+	if !ok {
+		return
+	}
+
+	h, ok := c.handler.(Handler)
+	if !ok {
+		return
+	}
+
+	cmd.SetKeySpec(c.desc.FirstKey, c.desc.LastKey, c.desc.KeyStepCount)
+	h.ServeRedeo(w, cmd)
+	w.Reset(io.Discard)
+
+	if keys := cmd.Keys(); len(keys) != 0 && c.write {
+		srv.tracking.invalidate(keyStrings(keys), nil)
+	}
+}
+
+func (srv *Server) pipeline(c *Client) (err error) {
+	ctx := c.Context()
+
+	srv.mu.RLock()
+	observer := srv.observer
+	srv.mu.RUnlock()
+
+	// wait for the first command before observing
+	if observer != nil {
+		if _, err := c.rd.PeekCmd(); err == nil {
+			var done func(error)
+			ctx, done = observer.ObservePipeline(ctx, c)
+			defer func() { done(err) }()
 		}
 	}
+
+	return c.pipeline(func(name string) error {
+		return srv.perform(ctx, c, name)
+	})
 }
 
-func (srv *Server) perform(c *Client, name string) (err error) {
+func (srv *Server) perform(ctx context.Context, c *Client, name string) (err error) {
 	norm := strings.ToLower(name)
 
 	// find handler
 	srv.mu.RLock()
-	h, ok := srv.cmds[norm]
+	cmd, ok := srv.cmds[norm]
+	var limiters limiters
+	if ok {
+		limiters = cmd.limiters
+	}
+	observer := srv.observer
+	aof := srv.aof
 	srv.mu.RUnlock()
 
 	if !ok {
@@ -130,27 +508,85 @@ func (srv *Server) perform(c *Client, name string) (err error) {
 		return
 	}
 
+	// reject writes while following a master
+	if cmd.write && srv.repl.Role() == "slave" {
+		c.wr.AppendError(ErrReadOnlyReplica.Error())
+		_ = c.rd.SkipCmd()
+		return
+	}
+
+	// reject writes once the append-only file is broken
+	if cmd.write && aof != nil {
+		if aofErr := aof.Err(); aofErr != nil {
+			c.wr.AppendError("MISCONF Errors writing to the AOF file: " + aofErr.Error())
+			_ = c.rd.SkipCmd()
+			return
+		}
+	}
+
+	// apply rate limits
+	if delay, limit := srv.rates.Take(c, norm, time.Now()); limit != nil {
+		c.wr.AppendError(limit.errorString())
+		_ = c.rd.SkipCmd()
+		return
+	} else if delay > 0 {
+		waitRateLimit(ctx, delay)
+	}
+
+	// wait for concurrency slots
+	if len(limiters) != 0 {
+		if !limiters.acquire(ctx) {
+			c.wr.AppendError(Busy(name))
+			_ = c.rd.SkipCmd()
+			return
+		}
+		defer limiters.release()
+	}
+
 	// register call
 	srv.info.command(c.id, norm)
 
-	switch handler := h.(type) {
+	switch handler := cmd.handler.(type) {
 	case Handler:
-		if c.cmd, err = c.readCmd(c.cmd); err != nil {
+		if c.cmd, err = c.readCmd(ctx, c.cmd); err != nil {
 			return
 		}
-		handler.ServeRedeo(c.wr, c.cmd)
+		c.cmd.SetKeySpec(cmd.desc.FirstKey, cmd.desc.LastKey, cmd.desc.KeyStepCount)
+
+		w, done := c.observe(c.cmd.Context(), observer, name, c.cmd.ArgN(), c.cmd.SetContext)
+		if !cmd.desc.acceptsArgs(c.cmd.ArgN()) {
+			w.AppendError(WrongNumberOfArgs(name))
+		} else if cmd.write {
+			srv.serveWrite(w, handler, c, aof)
+			srv.tracking.command(c, &cmd.desc, c.cmd)
+		} else {
+			handler.ServeRedeo(w, c.cmd)
+			srv.tracking.command(c, &cmd.desc, c.cmd)
+		}
+		done()
 
 	case StreamHandler:
-		if c.scmd, err = c.streamCmd(c.scmd); err != nil {
+		if c.scmd, err = c.streamCmd(ctx, c.scmd); err != nil {
 			return
 		}
-		defer c.scmd.Discard()
+		defer func() {
+			// oversized arguments cannot be discarded
+			if e := c.scmd.Discard(); err == nil && resp.IsLimitError(e) {
+				err = e
+			}
+		}()
 
-		handler.ServeRedeoStream(c.wr, c.scmd)
+		w, done := c.observe(c.scmd.Context(), observer, name, c.scmd.ArgN(), c.scmd.SetContext)
+		if cmd.desc.acceptsArgs(c.scmd.ArgN()) {
+			handler.ServeRedeoStream(w, c.scmd)
+		} else {
+			w.AppendError(WrongNumberOfArgs(name))
+		}
+		done()
 	}
 
 	// flush when buffer is large enough
-	if n := c.wr.Buffered(); n > resp.MaxBufferSize/2 {
+	if n := c.wr.Buffered(); n > srv.config.writeBufferSize()/2 {
 		err = c.wr.Flush()
 	}
 	return
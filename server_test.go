@@ -2,14 +2,19 @@ package redeo
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
 
 	. "github.com/bsm/ginkgo/v2"
 	. "github.com/bsm/gomega"
+	"github.com/bsm/redeo/v2/redeotest"
 	"github.com/bsm/redeo/v2/resp"
 )
 
@@ -274,6 +279,62 @@ var _ = Describe("Server", func() {
 		})
 	})
 
+	DescribeTable("should reject requests exceeding limits",
+		func(req string, msgs ...string) {
+			subject = NewServer(&Config{MaxBulkLen: 8, MaxMultiBulkLen: 3, MaxInlineLen: 16})
+			subject.HandleFunc("echo", echo)
+			subject.HandleStreamFunc("stream", stream)
+
+			runServer(subject, func(cn net.Conn, cw *resp.RequestWriter, cr resp.ResponseReader) {
+				cw.WriteCmdString("ECHO", "12345678")
+				Expect(cw.Flush()).To(Succeed())
+				Expect(cr.ReadBulkString()).To(Equal("12345678"))
+
+				_, err := cn.Write([]byte(req))
+				Expect(err).NotTo(HaveOccurred())
+
+				for _, msg := range msgs {
+					s, err := cr.ReadError()
+					Expect(err).NotTo(HaveOccurred())
+					Expect(s).To(Equal(msg))
+				}
+
+				// connection should be closed
+				_, err = cr.PeekType()
+				Expect(err).To(MatchError("EOF"))
+			})
+			Expect(subject.Info().TotalRejectedRequests()).To(Equal(int64(1)))
+			Expect(subject.Info().Find("Stats").String()).To(ContainSubstring("total_rejected_requests:1\n"))
+		},
+
+		Entry("bulk", "*2\r\n$4\r\nECHO\r\n$9\r\n123456789\r\n", "ERR Protocol error: bulk length exceeds limit"),
+		Entry("streamed bulk", "*2\r\n$6\r\nSTREAM\r\n$9\r\n123456789\r\n",
+			"ERR unable to parse argument: Protocol error: bulk length exceeds limit",
+			"ERR Protocol error: bulk length exceeds limit"),
+		Entry("multibulk", "*4\r\n$4\r\nECHO\r\n$1\r\na\r\n$1\r\nb\r\n$1\r\nc\r\n", "ERR Protocol error: multibulk length exceeds limit"),
+		Entry("inline", "ECHO 12345678901234567890\r\n", "ERR Protocol error: too big inline request"),
+	)
+
+	It("should support custom buffer sizes", func() {
+		subject = NewServer(&Config{ReadBufferSize: 16, WriteBufferSize: 32})
+		subject.HandleFunc("echo", echo)
+
+		runServer(subject, func(cn net.Conn, cw *resp.RequestWriter, cr resp.ResponseReader) {
+			for i := 0; i < 10; i++ {
+				cw.WriteCmdString("ECHO", strings.Repeat("x", 100))
+			}
+			Expect(cw.Flush()).To(Succeed())
+
+			for i := 0; i < 10; i++ {
+				Expect(cr.ReadBulkString()).To(Equal(strings.Repeat("x", 100)))
+			}
+
+			// idle clients release their buffers
+			Eventually(subject.Info().BufferBytes).Should(BeZero())
+			Expect(subject.Info().Find("Memory").String()).To(ContainSubstring("client_buffers_bytes:0\n"))
+		})
+	})
+
 	It("should close connections on EOF errors", func() {
 		runServer(subject, func(cn net.Conn, cw *resp.RequestWriter, cr resp.ResponseReader) {
 			_, err := cn.Write([]byte("*1\r\n$4\r\nPI"))
@@ -303,12 +364,172 @@ var _ = Describe("Server", func() {
 		})
 	})
 
+	It("should validate arity and extract keys", func() {
+		subject.HandleFunc("mget", func(w resp.ResponseWriter, c *resp.Command) {
+			keys := c.Keys()
+			w.AppendArrayLen(len(keys))
+			for _, key := range keys {
+				w.AppendBulk(key)
+			}
+		}, CommandDescription{Arity: -2, Flags: []string{"readonly"}, FirstKey: 1, LastKey: -1, KeyStepCount: 1})
+		subject.HandleStreamFunc("stream", stream, CommandDescription{Arity: 2})
+
+		runServer(subject, func(cn net.Conn, cw *resp.RequestWriter, cr resp.ResponseReader) {
+			cw.WriteCmdString("MGET", "k1", "k2")
+			cw.WriteCmdString("MGET")
+			cw.WriteCmdString("STREAM", `{"n":8,"s":"hello"}`, "x")
+			cw.WriteCmdString("PING")
+			Expect(cw.Flush()).To(Succeed())
+
+			var keys []string
+			Expect(cr.Scan(&keys)).To(Succeed())
+			Expect(keys).To(Equal([]string{"k1", "k2"}))
+			Expect(cr.ReadError()).To(Equal("ERR wrong number of arguments for 'MGET' command"))
+			Expect(cr.ReadError()).To(Equal("ERR wrong number of arguments for 'STREAM' command"))
+			Expect(cr.ReadInlineString()).To(Equal("PONG"))
+		})
+
+		descs := subject.CommandDescriptions()
+		Expect(descs).To(HaveLen(6))
+		Expect(descs[1]).To(Equal(CommandDescription{Name: "flush"}))
+		Expect(descs[2]).To(Equal(CommandDescription{Name: "mget", Arity: -2, Flags: []string{"readonly"}, FirstKey: 1, LastKey: -1, KeyStepCount: 1}))
+	})
+
+	It("should notify observers", func() {
+		obs := new(mockObserver)
+		subject.Observe(obs)
+
+		runServer(subject, func(cn net.Conn, cw *resp.RequestWriter, cr resp.ResponseReader) {
+			cw.WriteCmd("PING")
+			cw.WriteCmd("ECHO")
+			cw.WriteCmdString("STREAM", `{"n":8,"s":"hello"}`)
+			Expect(cw.Flush()).To(Succeed())
+
+			s, err := cr.ReadInlineString()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(s).To(Equal("PONG"))
+
+			s, err = cr.ReadError()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(s).To(Equal("ERR wrong number of arguments for 'ECHO' command"))
+
+			s, err = cr.ReadInlineString()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(s).To(Equal("hello.8"))
+		})
+
+		Expect(obs.Events()).To(Equal([]string{
+			"pipeline:start",
+			"PING(0):start",
+			"PING(0):done",
+			"ECHO(0):start",
+			"ECHO(0):done:ERR wrong number of arguments for 'ECHO' command",
+			"STREAM(1):start",
+			"STREAM(1):done",
+			"pipeline:done",
+		}))
+	})
+
+	It("should record top-level errors only", func() {
+		var rec errorRecorder
+		rec.reset(redeotest.NewRecorder())
+
+		rec.AppendArrayLen(2)
+		rec.AppendOK()
+		rec.AppendError("ERR nested")
+		rec.AppendArrayLen(1)
+		rec.AppendMapLen(1)
+		rec.AppendBulkString("k")
+		Expect(rec.Append(errors.New("nested"))).To(Succeed())
+		Expect(rec.msg).To(BeEmpty())
+
+		a := resp.NewStreamedArrayWriter(&rec)
+		a.AppendArrayLen(1)
+		a.AppendError("ERR streamed")
+		a.AppendError("ERR streamed")
+		Expect(a.Close()).To(Succeed())
+		Expect(rec.msg).To(BeEmpty())
+
+		a = resp.NewArrayWriter(&rec)
+		a.AppendError("ERR collected")
+		Expect(a.Close()).To(Succeed())
+		Expect(rec.msg).To(BeEmpty())
+
+		rec.AppendError("ERR top-level")
+		Expect(rec.msg).To(Equal("ERR top-level"))
+
+		rec.reset(redeotest.NewRecorder())
+		Expect(rec.msg).To(BeEmpty())
+		Expect(rec.nested).To(BeEmpty())
+	})
+
+	It("should listen and serve on multiple addresses", func() {
+		dir, err := os.MkdirTemp("", "redeo-test")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.RemoveAll(dir)
+
+		sock := filepath.Join(dir, "redeo.sock")
+		subject = NewServer(&Config{UnixSocketPerm: 0o700})
+		subject.HandleFunc("ping", pong)
+
+		errs := make(chan error, 1)
+		go func() { errs <- subject.ListenAndServe("127.0.0.1:0", "tcp4://127.0.0.1:0", "unix://"+sock) }()
+		Eventually(subject.Addrs).Should(HaveLen(3))
+
+		fi, err := os.Stat(sock)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fi.Mode().Perm()).To(Equal(os.FileMode(0o700)))
+
+		for _, addr := range subject.Addrs() {
+			cn, err := net.Dial(addr.Network(), addr.String())
+			Expect(err).NotTo(HaveOccurred())
+			defer cn.Close()
+
+			cw, cr := resp.NewRequestWriter(cn), resp.NewResponseReader(cn)
+			cw.WriteCmd("PING")
+			Expect(cw.Flush()).To(Succeed())
+			Expect(cr.ReadInlineString()).To(Equal("PONG"))
+		}
+
+		clients := subject.Info().ClientInfo()
+		Expect(clients).To(HaveLen(3))
+
+		laddrs := make([]string, 0, len(clients))
+		for _, ci := range clients {
+			laddrs = append(laddrs, ci.LocalAddr)
+		}
+		Expect(laddrs).To(ContainElement(sock + ":0"))
+		Expect(clients[0].String()).To(ContainSubstring(" laddr=" + clients[0].LocalAddr + " "))
+
+		Expect(subject.Shutdown()).To(Succeed())
+		Eventually(errs).Should(Receive(Equal(ErrServerClosed)))
+		Expect(subject.Addrs()).To(BeEmpty())
+
+		_, err = os.Stat(sock)
+		Expect(os.IsNotExist(err)).To(BeTrue())
+		Expect(subject.Serve(nil)).To(Equal(ErrServerClosed))
+	})
+
+	It("should close all listeners on listen errors", func() {
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+		defer lis.Close()
+
+		err = subject.ListenAndServe("127.0.0.1:0", lis.Addr().String())
+		Expect(err).To(HaveOccurred())
+		Expect(subject.Addrs()).To(BeEmpty())
+	})
+
+	It("should require addresses to listen on", func() {
+		Expect(subject.ListenAndServe()).To(MatchError("redeo: no addresses to listen on"))
+	})
+
 })
 
 // --------------------------------------------------------------------
 
 func BenchmarkServer_inline(b *testing.B) {
-	benchmarkServer(b, []byte(
+	benchmarkServer(b, nil, []byte(
 		"ECHO HELLO\r\n"+
 			"ECHO CRUEL\r\n"+
 			"ECHO WORLD\r\n",
@@ -316,35 +537,17 @@ func BenchmarkServer_inline(b *testing.B) {
 }
 
 func BenchmarkServer_bulk(b *testing.B) {
-	benchmarkServer(b, []byte(
+	benchmarkServer(b, nil, []byte(
 		"*2\r\n$4\r\nECHO\r\n$5\r\nHELLO\r\n"+
 			"*2\r\n$4\r\nECHO\r\n$5\r\nCRUEL\r\n"+
 			"*2\r\n$4\r\nECHO\r\n$5\r\nWORLD\r\n",
 	), 24)
 }
 
-func benchmarkServer(b *testing.B, pipe []byte, expN int) {
-	lis, err := net.Listen("tcp", "127.0.0.1:0")
-	if err != nil {
-		b.Fatal(err)
-	}
+func benchmarkServer(b *testing.B, config *Config, pipe []byte, expN int) {
+	lis := startBenchServer(b, config)
 	defer lis.Close()
 
-	srv := NewServer(nil)
-	srv.HandleFunc("echo", func(w resp.ResponseWriter, cmd *resp.Command) {
-		if len(cmd.Args) != 1 {
-			w.AppendError(WrongNumberOfArgs(cmd.Name))
-		}
-		w.AppendInline(cmd.Arg(0))
-	})
-
-	// start listening
-	go func() {
-		defer GinkgoRecover()
-
-		Expect(srv.Serve(lis)).To(Succeed())
-	}()
-
 	conn, err := net.Dial("tcp", lis.Addr().String())
 	if err != nil {
 		b.Fatal(err)
@@ -365,3 +568,66 @@ func benchmarkServer(b *testing.B, pipe []byte, expN int) {
 		}
 	}
 }
+
+// benchmarkServerConns benchmarks PINGs over many concurrent connections.
+func benchmarkServerConns(b *testing.B, config *Config, numConns int) {
+	lis := startBenchServer(b, config)
+	defer lis.Close()
+
+	conns := make(chan net.Conn, numConns)
+	for i := 0; i < numConns; i++ {
+		cn, err := net.Dial("tcp", lis.Addr().String())
+		if err != nil {
+			b.Fatal(err)
+		}
+		defer cn.Close()
+		conns <- cn
+	}
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		buf := make([]byte, 16)
+		for pb.Next() {
+			cn := <-conns
+			if _, err := cn.Write([]byte("PING\r\n")); err != nil {
+				b.Error(err)
+				return
+			}
+			if _, err := io.ReadFull(cn, buf[:7]); err != nil {
+				b.Error(err)
+				return
+			}
+			conns <- cn
+		}
+	})
+}
+
+func startBenchServer(b *testing.B, config *Config) net.Listener {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	srv := NewServer(config)
+	srv.HandleFunc("echo", func(w resp.ResponseWriter, cmd *resp.Command) {
+		if len(cmd.Args) != 1 {
+			w.AppendError(WrongNumberOfArgs(cmd.Name))
+		}
+		w.AppendInline(cmd.Arg(0))
+	})
+	srv.HandleFunc("ping", func(w resp.ResponseWriter, _ *resp.Command) {
+		w.AppendInlineString("PONG")
+	})
+
+	// start listening
+	go func() { _ = srv.Serve(lis) }()
+	return lis
+}
+
+func BenchmarkServer_conns(b *testing.B) {
+	for _, n := range []int{10, 1000} {
+		b.Run(fmt.Sprintf("goroutines/%d", n), func(b *testing.B) {
+			benchmarkServerConns(b, nil, n)
+		})
+	}
+}
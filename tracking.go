@@ -0,0 +1,398 @@
+package redeo
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/bsm/redeo/v2/resp"
+)
+
+// invalidateChannel is the pub/sub channel used to deliver invalidation
+// messages to RESP2 clients.
+const invalidateChannel = "__redis__:invalidate"
+
+// ClientTracking returns a CLIENT TRACKING handler, enabling server-assisted
+// client-side caching. It supports the default mode, as well as BCAST (with
+// PREFIX), OPTIN, OPTOUT, NOLOOP and REDIRECT options. The handler is meant to
+// be registered as a sub-command of CLIENT:
+//
+//	srv.Handle("client", redeo.SubCommands{
+//		"tracking": srv.ClientTracking(),
+//		"caching":  srv.ClientCaching(),
+//	})
+//
+// In the default mode, the server remembers the keys read by each client,
+// as determined by the key specs of the command descriptions. Keys are
+// invalidated when commands flagged as "write" are called, or explicitly via
+// InvalidateKeys. Invalidations are pushed to RESP3 clients, RESP2 clients
+// must REDIRECT them to a client subscribed to __redis__:invalidate via a
+// PubSubBroker. Invalidations for RESP2 clients which are not subscribed
+// are dropped.
+//
+// https://redis.io/commands/client-tracking
+func (srv *Server) ClientTracking() Handler {
+	return HandlerFunc(func(w resp.ResponseWriter, c *resp.Command) {
+		if c.ArgN() == 0 {
+			w.AppendError(WrongNumberOfArgs(c.Name))
+			return
+		}
+
+		client := GetClient(c.Context())
+		if client == nil {
+			w.AppendError("ERR client tracking requires a client connection")
+			return
+		}
+
+		switch strings.ToLower(c.Arg(0).String()) {
+		case "on":
+			opts, err := parseTrackingOptions(c.Args[1:])
+			if err != "" {
+				w.AppendError(err)
+				return
+			}
+			if opts.redirect != 0 && opts.redirect != client.id && srv.info.clients.Get(opts.redirect) == nil {
+				w.AppendError("ERR The client ID you want redirect to does not exist")
+				return
+			}
+			srv.tracking.enable(client, opts)
+		case "off":
+			if c.ArgN() != 1 {
+				w.AppendError("ERR syntax error")
+				return
+			}
+			srv.tracking.disable(client)
+		default:
+			w.AppendError("ERR syntax error")
+			return
+		}
+		w.AppendOK()
+	})
+}
+
+// ClientCaching returns a CLIENT CACHING handler, which controls whether the
+// keys read by the next command are tracked in OPTIN or OPTOUT mode.
+// https://redis.io/commands/client-caching
+func (srv *Server) ClientCaching() Handler {
+	return HandlerFunc(func(w resp.ResponseWriter, c *resp.Command) {
+		if c.ArgN() != 1 {
+			w.AppendError(WrongNumberOfArgs(c.Name))
+			return
+		}
+
+		var yes bool
+		switch strings.ToLower(c.Arg(0).String()) {
+		case "yes":
+			yes = true
+		case "no":
+		default:
+			w.AppendError("ERR syntax error")
+			return
+		}
+
+		if msg := srv.tracking.caching(GetClient(c.Context()), yes); msg != "" {
+			w.AppendError(msg)
+			return
+		}
+		w.AppendOK()
+	})
+}
+
+// InvalidateKeys notifies all clients that have been tracking any of the
+// given keys that these keys have been modified.
+func (srv *Server) InvalidateKeys(keys ...string) {
+	srv.tracking.invalidate(keys, nil)
+}
+
+// --------------------------------------------------------------------
+
+type trackingOptions struct {
+	redirect uint64
+	prefixes []string
+	bcast    bool
+	optin    bool
+	optout   bool
+	noloop   bool
+}
+
+func parseTrackingOptions(args []resp.CommandArgument) (opts trackingOptions, err string) {
+	for i := 0; i < len(args); i++ {
+		switch strings.ToLower(args[i].String()) {
+		case "redirect":
+			if i++; i == len(args) {
+				return opts, "ERR syntax error"
+			}
+			id, e := strconv.ParseUint(args[i].String(), 10, 64)
+			if e != nil {
+				return opts, "ERR Invalid client ID"
+			}
+			opts.redirect = id
+		case "prefix":
+			if i++; i == len(args) {
+				return opts, "ERR syntax error"
+			}
+			opts.prefixes = append(opts.prefixes, args[i].String())
+		case "bcast":
+			opts.bcast = true
+		case "optin":
+			opts.optin = true
+		case "optout":
+			opts.optout = true
+		case "noloop":
+			opts.noloop = true
+		default:
+			return opts, "ERR syntax error"
+		}
+	}
+
+	switch {
+	case len(opts.prefixes) != 0 && !opts.bcast:
+		return opts, "ERR PREFIX option requires BCAST mode to be enabled"
+	case opts.optin && opts.optout:
+		return opts, "ERR You can't use OPTIN and OPTOUT at the same time"
+	case opts.bcast && (opts.optin || opts.optout):
+		return opts, "ERR OPTIN and OPTOUT are not compatible with BCAST"
+	}
+	return opts, ""
+}
+
+type trackedClient struct {
+	*Client
+	trackingOptions
+
+	keys       map[string]struct{} // keys remembered on behalf of the client
+	caching    int8                // CLIENT CACHING state for the next command, 1 (yes) or -1 (no)
+	cachingCmd bool                // CLIENT CACHING was called by the current command
+}
+
+// tracks returns true if keys read by the current command should be tracked.
+func (tc *trackedClient) tracks() bool {
+	switch {
+	case tc.bcast:
+		return false
+	case tc.optin:
+		return tc.caching > 0
+	case tc.optout:
+		return tc.caching >= 0
+	}
+	return true
+}
+
+// matches returns true if a key matches the BCAST prefixes.
+func (tc *trackedClient) matches(key string) bool {
+	if len(tc.prefixes) == 0 {
+		return true
+	}
+	for _, prefix := range tc.prefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+type tracker struct {
+	info    *ServerInfo
+	clients map[uint64]*trackedClient      // clients with tracking enabled
+	keys    map[string]map[uint64]struct{} // keys read by clients in default mode
+	active  int64                          // number of clients with tracking enabled
+	mu      sync.Mutex
+}
+
+func newTracker(info *ServerInfo) *tracker {
+	return &tracker{
+		info:    info,
+		clients: make(map[uint64]*trackedClient),
+		keys:    make(map[string]map[uint64]struct{}),
+	}
+}
+
+// NumClients returns the number of clients with tracking enabled.
+func (t *tracker) NumClients() int64 { return atomic.LoadInt64(&t.active) }
+
+// NumKeys returns the number of tracked keys.
+func (t *tracker) NumKeys() int {
+	t.mu.Lock()
+	n := len(t.keys)
+	t.mu.Unlock()
+	return n
+}
+
+func (t *tracker) enable(c *Client, opts trackingOptions) {
+	t.mu.Lock()
+	tc := &trackedClient{Client: c, trackingOptions: opts}
+	if prev, ok := t.clients[c.id]; ok {
+		tc.keys = prev.keys
+	} else {
+		atomic.AddInt64(&t.active, 1)
+	}
+	t.clients[c.id] = tc
+	t.mu.Unlock()
+}
+
+// disable disables tracking for a client and forgets the keys remembered
+// on its behalf.
+func (t *tracker) disable(c *Client) {
+	t.mu.Lock()
+	if tc, ok := t.clients[c.id]; ok {
+		for key := range tc.keys {
+			if ids := t.keys[key]; ids != nil {
+				if delete(ids, c.id); len(ids) == 0 {
+					delete(t.keys, key)
+				}
+			}
+		}
+		delete(t.clients, c.id)
+		atomic.AddInt64(&t.active, -1)
+	}
+	t.mu.Unlock()
+}
+
+func (t *tracker) caching(c *Client, yes bool) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var tc *trackedClient
+	if c != nil {
+		tc = t.clients[c.id]
+	}
+
+	switch {
+	case tc == nil || (!tc.optin && !tc.optout):
+		return "ERR CLIENT CACHING can be called only when the client is in tracking mode with OPTIN or OPTOUT mode enabled"
+	case yes && !tc.optin:
+		return "ERR CLIENT CACHING YES is only valid when tracking is enabled in OPTIN mode."
+	case !yes && !tc.optout:
+		return "ERR CLIENT CACHING NO is only valid when tracking is enabled in OPTOUT mode."
+	}
+
+	if tc.caching = -1; yes {
+		tc.caching = 1
+	}
+	tc.cachingCmd = true
+	return ""
+}
+
+// command is called after each command. Keys of commands flagged as "write"
+// are invalidated, keys of other commands are remembered for the client.
+func (t *tracker) command(c *Client, desc *CommandDescription, cmd *resp.Command) {
+	if t.NumClients() == 0 {
+		return
+	}
+
+	if desc.hasFlag("write") {
+		if keys := cmd.Keys(); len(keys) != 0 {
+			t.invalidate(keyStrings(keys), c)
+		}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	tc, ok := t.clients[c.id]
+	if !ok {
+		return
+	}
+
+	if !desc.hasFlag("write") && tc.tracks() {
+		for _, key := range cmd.Keys() {
+			ids, ok := t.keys[string(key)]
+			if !ok {
+				ids = make(map[uint64]struct{}, 1)
+				t.keys[string(key)] = ids
+			}
+			ids[c.id] = struct{}{}
+
+			if tc.keys == nil {
+				tc.keys = make(map[string]struct{})
+			}
+			tc.keys[string(key)] = struct{}{}
+		}
+	}
+
+	// CLIENT CACHING only applies to the command immediately after
+	if tc.cachingCmd {
+		tc.cachingCmd = false
+	} else {
+		tc.caching = 0
+	}
+}
+
+// invalidate sends invalidation messages for keys, skipping the originating
+// client if it has NOLOOP enabled.
+func (t *tracker) invalidate(keys []string, origin *Client) {
+	if len(keys) == 0 || t.NumClients() == 0 {
+		return
+	}
+
+	var order []*trackedClient
+	pending := make(map[*trackedClient][]string)
+	add := func(tc *trackedClient, key string) {
+		if tc.noloop && tc.Client == origin {
+			return
+		}
+		if _, ok := pending[tc]; !ok {
+			order = append(order, tc)
+		}
+		pending[tc] = append(pending[tc], key)
+	}
+
+	t.mu.Lock()
+	for _, key := range keys {
+		for id := range t.keys[key] {
+			if tc, ok := t.clients[id]; ok {
+				delete(tc.keys, key)
+				if !tc.bcast {
+					add(tc, key)
+				}
+			}
+		}
+		delete(t.keys, key)
+
+		for _, tc := range t.clients {
+			if tc.bcast && tc.matches(key) {
+				add(tc, key)
+			}
+		}
+	}
+	t.mu.Unlock()
+
+	for _, tc := range order {
+		t.send(tc, pending[tc])
+	}
+}
+
+// send delivers invalidated keys to the client, or its redirect target. RESP2
+// targets only receive invalidations once subscribed to __redis__:invalidate.
+func (t *tracker) send(tc *trackedClient, keys []string) {
+	target := tc.Client
+	if tc.redirect != 0 && tc.redirect != tc.id {
+		if target = t.info.clients.Get(tc.redirect); target == nil {
+			if tc.Protocol() >= 3 {
+				_ = tc.Push("tracking-redir-broken", int64(tc.redirect))
+			}
+			return
+		}
+	}
+
+	if target.Protocol() >= 3 {
+		_ = target.Push("invalidate", keys)
+	} else if target.subscribedToInvalidations() {
+		_ = target.Push("message", invalidateChannel, keys)
+	}
+}
+
+// subscribedToInvalidations returns true if the client is subscribed to
+// __redis__:invalidate.
+func (c *Client) subscribedToInvalidations() bool {
+	return atomic.LoadInt32(&c.invalidations) != 0
+}
+
+func keyStrings(keys []resp.CommandArgument) []string {
+	strs := make([]string, len(keys))
+	for i, key := range keys {
+		strs[i] = string(key)
+	}
+	return strs
+}
@@ -0,0 +1,232 @@
+package redeo
+
+import (
+	"bufio"
+	"net"
+
+	. "github.com/bsm/ginkgo/v2"
+	. "github.com/bsm/gomega"
+	"github.com/bsm/redeo/v2/resp"
+)
+
+var _ = Describe("Tracking", func() {
+	var subject *Server
+	var lis net.Listener
+
+	type conn struct {
+		*resp.RequestWriter
+		rd *bufio.Reader
+	}
+
+	dial := func() *conn {
+		cn, err := net.Dial("tcp", lis.Addr().String())
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(cn.Close)
+		return &conn{RequestWriter: resp.NewRequestWriter(cn), rd: bufio.NewReader(cn)}
+	}
+
+	// call sends a command (if any) and reads n lines of the response.
+	call := func(cn *conn, n int, args ...string) string {
+		if len(args) != 0 {
+			cn.WriteCmdString(args[0], args[1:]...)
+			Expect(cn.Flush()).To(Succeed())
+		}
+
+		var s string
+		for i := 0; i < n; i++ {
+			line, err := cn.rd.ReadString('\n')
+			Expect(err).NotTo(HaveOccurred())
+			s += line
+		}
+		return s
+	}
+
+	BeforeEach(func() {
+		subject = NewServer(nil)
+		subject.HandleFunc("hello", func(w resp.ResponseWriter, c *resp.Command) {
+			GetClient(c.Context()).SetProtocol(3)
+			w.AppendOK()
+		})
+		subject.Handle("client", SubCommands{
+			"id": HandlerFunc(func(w resp.ResponseWriter, c *resp.Command) {
+				w.AppendInt(int64(GetClient(c.Context()).ID()))
+			}),
+			"tracking": subject.ClientTracking(),
+			"caching":  subject.ClientCaching(),
+		})
+		subject.HandleFunc("get", func(w resp.ResponseWriter, c *resp.Command) {
+			w.AppendNil()
+		}, CommandDescription{Arity: 2, Flags: []string{"readonly"}, FirstKey: 1, LastKey: 1, KeyStepCount: 1})
+		subject.HandleFunc("set", func(w resp.ResponseWriter, c *resp.Command) {
+			w.AppendOK()
+		}, CommandDescription{Arity: 3, Flags: []string{"write"}, FirstKey: 1, LastKey: 1, KeyStepCount: 1})
+		subject.Handle("ping", Ping())
+
+		broker := NewPubSubBroker()
+		subject.Handle("subscribe", broker.Subscribe())
+		subject.Handle("unsubscribe", broker.Unsubscribe())
+
+		var err error
+		lis, err = net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+		go func(srv *Server, lis net.Listener) { _ = srv.Serve(lis) }(subject, lis)
+		DeferCleanup(subject.Shutdown)
+	})
+
+	It("should parse options", func() {
+		parse := func(args ...string) (trackingOptions, string) {
+			cmd := resp.NewCommand("TRACKING")
+			for _, arg := range args {
+				cmd.Args = append(cmd.Args, resp.CommandArgument(arg))
+			}
+			return parseTrackingOptions(cmd.Args)
+		}
+
+		Expect(parse()).To(Equal(trackingOptions{}))
+		Expect(parse("BCAST", "PREFIX", "a", "prefix", "b", "NOLOOP")).To(Equal(trackingOptions{
+			prefixes: []string{"a", "b"},
+			bcast:    true,
+			noloop:   true,
+		}))
+		Expect(parse("redirect", "12", "optin")).To(Equal(trackingOptions{redirect: 12, optin: true}))
+
+		_, err := parse("PREFIX", "a")
+		Expect(err).To(Equal("ERR PREFIX option requires BCAST mode to be enabled"))
+		_, err = parse("OPTIN", "OPTOUT")
+		Expect(err).To(Equal("ERR You can't use OPTIN and OPTOUT at the same time"))
+		_, err = parse("BCAST", "OPTIN")
+		Expect(err).To(Equal("ERR OPTIN and OPTOUT are not compatible with BCAST"))
+		_, err = parse("REDIRECT", "x")
+		Expect(err).To(Equal("ERR Invalid client ID"))
+		_, err = parse("REDIRECT")
+		Expect(err).To(Equal("ERR syntax error"))
+		_, err = parse("BOGUS")
+		Expect(err).To(Equal("ERR syntax error"))
+	})
+
+	It("should push invalidations to RESP3 clients", func() {
+		c1, c2 := dial(), dial()
+		Expect(call(c1, 1, "HELLO", "3")).To(Equal("+OK\r\n"))
+		Expect(call(c1, 1, "CLIENT", "TRACKING", "on")).To(Equal("+OK\r\n"))
+		Expect(call(c1, 1, "GET", "foo")).To(Equal("$-1\r\n"))
+		Expect(call(c1, 1, "GET", "bar")).To(Equal("$-1\r\n"))
+		Expect(subject.Info().String()).To(ContainSubstring("tracking_clients:1\n"))
+		Expect(subject.Info().String()).To(ContainSubstring("tracking_total_keys:2\n"))
+
+		Expect(call(c2, 1, "SET", "foo", "x")).To(Equal("+OK\r\n"))
+		Expect(call(c1, 6, "PING")).To(Equal(">2\r\n$10\r\ninvalidate\r\n*1\r\n$3\r\nfoo\r\n"))
+		Expect(call(c1, 1)).To(Equal("+PONG\r\n"))
+
+		// keys are only invalidated once
+		Expect(call(c2, 1, "SET", "foo", "x")).To(Equal("+OK\r\n"))
+		Expect(call(c1, 1, "PING")).To(Equal("+PONG\r\n"))
+
+		// own writes are invalidated, unless NOLOOP
+		Expect(call(c1, 7, "SET", "bar", "x")).To(Equal("+OK\r\n>2\r\n$10\r\ninvalidate\r\n*1\r\n$3\r\nbar\r\n"))
+		Expect(call(c1, 1, "CLIENT", "TRACKING", "on", "NOLOOP")).To(Equal("+OK\r\n"))
+		Expect(call(c1, 1, "GET", "bar")).To(Equal("$-1\r\n"))
+		Expect(call(c1, 1, "SET", "bar", "x")).To(Equal("+OK\r\n"))
+		Expect(call(c1, 1, "PING")).To(Equal("+PONG\r\n"))
+
+		Expect(call(c1, 1, "CLIENT", "TRACKING", "off")).To(Equal("+OK\r\n"))
+		Expect(subject.Info().String()).To(ContainSubstring("tracking_clients:0\n"))
+	})
+
+	It("should redirect invalidations", func() {
+		c1, c2 := dial(), dial()
+		id := call(c2, 1, "CLIENT", "ID")
+		Expect(id).To(HavePrefix(":"))
+		id = id[1 : len(id)-2]
+
+		Expect(call(c1, 1, "CLIENT", "TRACKING", "on", "REDIRECT", "999999")).To(Equal("-ERR The client ID you want redirect to does not exist\r\n"))
+		Expect(call(c1, 1, "CLIENT", "TRACKING", "on", "REDIRECT", id)).To(Equal("+OK\r\n"))
+		Expect(call(c1, 1, "GET", "foo")).To(Equal("$-1\r\n"))
+
+		// not subscribed yet, invalidations are dropped
+		subject.InvalidateKeys("foo")
+		Expect(call(c2, 6, "SUBSCRIBE", "__redis__:invalidate")).To(Equal("*3\r\n$9\r\nsubscribe\r\n$20\r\n__redis__:invalidate\r\n:1\r\n"))
+
+		Expect(call(c1, 1, "GET", "foo")).To(Equal("$-1\r\n"))
+		subject.InvalidateKeys("bar", "foo")
+		Expect(call(c2, 8)).To(Equal("*3\r\n$7\r\nmessage\r\n$20\r\n__redis__:invalidate\r\n*1\r\n$3\r\nfoo\r\n"))
+
+		Expect(call(c2, 6, "UNSUBSCRIBE")).To(Equal("*3\r\n$11\r\nunsubscribe\r\n$20\r\n__redis__:invalidate\r\n:0\r\n"))
+		Expect(call(c1, 1, "GET", "foo")).To(Equal("$-1\r\n"))
+		subject.InvalidateKeys("foo")
+		Expect(call(c2, 1, "CLIENT", "ID")).To(HavePrefix(":"))
+	})
+
+	It("should broadcast prefixes", func() {
+		c1 := dial()
+		Expect(call(c1, 1, "HELLO", "3")).To(Equal("+OK\r\n"))
+		Expect(call(c1, 1, "CLIENT", "TRACKING", "on", "BCAST", "PREFIX", "user:", "PREFIX", "post:")).To(Equal("+OK\r\n"))
+
+		subject.InvalidateKeys("user:1", "other", "post:2")
+		Expect(call(c1, 8, "PING")).To(Equal(">2\r\n$10\r\ninvalidate\r\n*2\r\n$6\r\nuser:1\r\n$6\r\npost:2\r\n"))
+		Expect(call(c1, 1)).To(Equal("+PONG\r\n"))
+		Expect(subject.tracking.NumKeys()).To(BeZero())
+	})
+
+	It("should support OPTIN and OPTOUT", func() {
+		c1 := dial()
+		Expect(call(c1, 1, "HELLO", "3")).To(Equal("+OK\r\n"))
+		Expect(call(c1, 1, "CLIENT", "CACHING", "yes")).To(Equal("-ERR CLIENT CACHING can be called only when the client is in tracking mode with OPTIN or OPTOUT mode enabled\r\n"))
+		Expect(call(c1, 1, "CLIENT", "TRACKING", "on", "OPTIN")).To(Equal("+OK\r\n"))
+		Expect(call(c1, 1, "CLIENT", "CACHING", "no")).To(Equal("-ERR CLIENT CACHING NO is only valid when tracking is enabled in OPTOUT mode.\r\n"))
+
+		Expect(call(c1, 1, "GET", "a")).To(Equal("$-1\r\n"))
+		Expect(call(c1, 1, "CLIENT", "CACHING", "yes")).To(Equal("+OK\r\n"))
+		Expect(call(c1, 1, "GET", "b")).To(Equal("$-1\r\n"))
+		Expect(call(c1, 1, "GET", "c")).To(Equal("$-1\r\n"))
+		Expect(subject.tracking.NumKeys()).To(Equal(1))
+
+		Expect(call(c1, 1, "CLIENT", "TRACKING", "on", "OPTOUT")).To(Equal("+OK\r\n"))
+		Expect(call(c1, 1, "CLIENT", "CACHING", "no")).To(Equal("+OK\r\n"))
+		Expect(call(c1, 1, "GET", "d")).To(Equal("$-1\r\n"))
+		Expect(call(c1, 1, "GET", "e")).To(Equal("$-1\r\n"))
+		Expect(subject.tracking.NumKeys()).To(Equal(2))
+
+		subject.InvalidateKeys("a", "b", "c", "d", "e")
+		Expect(call(c1, 8, "PING")).To(Equal(">2\r\n$10\r\ninvalidate\r\n*2\r\n$1\r\nb\r\n$1\r\ne\r\n"))
+	})
+
+	It("should stop tracking disconnected clients", func() {
+		cn, err := net.Dial("tcp", lis.Addr().String())
+		Expect(err).NotTo(HaveOccurred())
+		c1 := &conn{RequestWriter: resp.NewRequestWriter(cn), rd: bufio.NewReader(cn)}
+		Expect(call(c1, 1, "HELLO", "3")).To(Equal("+OK\r\n"))
+		Expect(call(c1, 1, "CLIENT", "TRACKING", "on")).To(Equal("+OK\r\n"))
+		Expect(subject.tracking.NumClients()).To(Equal(int64(1)))
+		Expect(call(c1, 1, "GET", "foo")).To(Equal("$-1\r\n"))
+		Expect(subject.tracking.NumKeys()).To(Equal(1))
+
+		Expect(cn.Close()).To(Succeed())
+		Eventually(subject.tracking.NumClients).Should(BeZero())
+		Expect(subject.tracking.NumKeys()).To(BeZero())
+		subject.InvalidateKeys("foo")
+	})
+
+	It("should forget keys when tracking is disabled", func() {
+		c1, c2 := dial(), dial()
+		Expect(call(c1, 1, "HELLO", "3")).To(Equal("+OK\r\n"))
+		Expect(call(c2, 1, "HELLO", "3")).To(Equal("+OK\r\n"))
+		Expect(call(c1, 1, "CLIENT", "TRACKING", "on")).To(Equal("+OK\r\n"))
+		Expect(call(c2, 1, "CLIENT", "TRACKING", "on")).To(Equal("+OK\r\n"))
+		Expect(call(c1, 1, "GET", "a")).To(Equal("$-1\r\n"))
+		Expect(call(c1, 1, "GET", "b")).To(Equal("$-1\r\n"))
+		Expect(call(c2, 1, "GET", "b")).To(Equal("$-1\r\n"))
+		Expect(subject.tracking.NumKeys()).To(Equal(2))
+
+		Expect(call(c1, 1, "CLIENT", "TRACKING", "on", "OPTOUT")).To(Equal("+OK\r\n"))
+		Expect(subject.tracking.NumKeys()).To(Equal(2))
+
+		Expect(call(c1, 1, "CLIENT", "TRACKING", "off")).To(Equal("+OK\r\n"))
+		Expect(subject.tracking.NumKeys()).To(Equal(1))
+
+		subject.InvalidateKeys("a", "b")
+		Expect(call(c2, 6, "PING")).To(Equal(">2\r\n$10\r\ninvalidate\r\n*1\r\n$1\r\nb\r\n"))
+		Expect(call(c2, 1)).To(Equal("+PONG\r\n"))
+		Expect(call(c1, 1, "PING")).To(Equal("+PONG\r\n"))
+		Expect(subject.tracking.NumKeys()).To(BeZero())
+	})
+})